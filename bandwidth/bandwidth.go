@@ -0,0 +1,266 @@
+// Package bandwidth limits the throughput of HTTP response bodies with a
+// token bucket shared by every request, optionally following a daily
+// schedule.
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/config"
+)
+
+// maxChunk bounds a single read so that concurrent transfers interleave.
+const maxChunk = 32 << 10
+
+// ParseRate parses a rate in bytes per second such as "500K", "2M" or
+// "1.5G". Suffixes are powers of 1024 like curl --limit-rate. An empty string
+// or "0" means unlimited.
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	multiplier := 1.0
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return int64(value * multiplier), nil
+}
+
+// Window applies Limit between From and To, both offsets from local
+// midnight. A window with From after To spans midnight.
+type Window struct {
+	From, To time.Duration
+	Limit    int64
+}
+
+func (w Window) contains(offset time.Duration) bool {
+	if w.From <= w.To {
+		return offset >= w.From && offset < w.To
+	}
+	return offset >= w.From || offset < w.To
+}
+
+// Schedule is a default limit with time windows overriding it. The first
+// matching window wins. A limit of 0 means unlimited.
+type Schedule struct {
+	Default int64
+	Windows []Window
+}
+
+// NewSchedule builds a schedule from the bandwidth section of the config.
+func NewSchedule(conf config.Bandwidth) (Schedule, error) {
+	var s Schedule
+	var err error
+	if s.Default, err = ParseRate(conf.Limit); err != nil {
+		return Schedule{}, err
+	}
+	for _, w := range conf.Schedule {
+		var window Window
+		if window.From, err = parseClock(w.From); err != nil {
+			return Schedule{}, err
+		}
+		if window.To, err = parseClock(w.To); err != nil {
+			return Schedule{}, err
+		}
+		if window.Limit, err = ParseRate(w.Limit); err != nil {
+			return Schedule{}, err
+		}
+		s.Windows = append(s.Windows, window)
+	}
+	return s, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// LimitAt returns the limit in bytes per second in effect at t.
+func (s Schedule) LimitAt(t time.Time) int64 {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	for _, w := range s.Windows {
+		if w.contains(offset) {
+			return w.Limit
+		}
+	}
+	return s.Default
+}
+
+// Unlimited reports whether the schedule never limits anything.
+func (s Schedule) Unlimited() bool {
+	if s.Default > 0 {
+		return false
+	}
+	for _, w := range s.Windows {
+		if w.Limit > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Limiter is a token bucket refilled at the rate the schedule allows, with a
+// burst of one second worth of data.
+type Limiter struct {
+	schedule Schedule
+	now      func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(schedule Schedule) *Limiter {
+	return &Limiter{schedule: schedule, now: time.Now}
+}
+
+// Wait takes n bytes worth of tokens, blocking until the bucket has refilled
+// enough or ctx is done.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := l.now()
+	rate := float64(l.schedule.LimitAt(now))
+	if rate <= 0 {
+		l.tokens, l.last = 0, now
+		l.mu.Unlock()
+		return nil
+	}
+	if !l.last.IsZero() {
+		l.tokens = min(rate, l.tokens+now.Sub(l.last).Seconds()*rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	debt := l.tokens
+	l.mu.Unlock()
+
+	if debt >= 0 {
+		return nil
+	}
+	if t, ok := ctx.Value(timeoutKey{}).(*requestTimeout); ok {
+		t.pause()
+		defer t.resume()
+	}
+	timer := time.NewTimer(time.Duration(-debt / rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type timeoutKey struct{}
+
+// requestTimeout is a timeout that stands still while a Limiter holds the
+// request back.
+type requestTimeout struct {
+	mu        sync.Mutex
+	timer     *time.Timer
+	remaining time.Duration
+	started   time.Time
+	paused    int
+	expired   bool
+}
+
+// WithTimeout returns a context that is cancelled after timeout, not counting
+// the time a Limiter spends holding back the requests made with it. It keeps
+// request timeouts from expiring while a low limit throttles the transfer.
+func WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	t := &requestTimeout{remaining: timeout, started: time.Now()}
+	t.timer = time.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })
+	return context.WithValue(ctx, timeoutKey{}, t), func() {
+		t.timer.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+func (t *requestTimeout) pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused == 0 {
+		if t.timer.Stop() {
+			t.remaining -= time.Since(t.started)
+		} else {
+			t.expired = true
+		}
+	}
+	t.paused++
+}
+
+func (t *requestTimeout) resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.paused--
+	if t.paused == 0 && !t.expired {
+		t.started = time.Now()
+		t.timer.Reset(t.remaining)
+	}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *Limiter
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if len(p) > maxChunk {
+		p = p[:maxChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := b.limiter.Wait(b.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+type transport struct {
+	base    http.RoundTripper
+	limiter *Limiter
+}
+
+// Transport returns a RoundTripper reading every response body through the
+// limiter. A nil base uses http.DefaultTransport.
+func Transport(base http.RoundTripper, limiter *Limiter) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, limiter: limiter}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, ctx: req.Context(), limiter: t.limiter}
+	return resp, nil
+}
@@ -0,0 +1,138 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/config"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"1000", 1000},
+		{"500K", 500 << 10},
+		{"2M", 2 << 20},
+		{"1.5g", 3 << 29},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"fast", "-1M", "2X"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestScheduleLimitAt(t *testing.T) {
+	s, err := NewSchedule(config.Bandwidth{
+		Limit: "2M",
+		Schedule: []config.BandwidthWindow{
+			{From: "01:00", To: "07:00", Limit: "0"},
+			{From: "22:00", To: "00:30", Limit: "100K"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		clock string
+		want  int64
+	}{
+		{"00:15", 100 << 10},
+		{"00:30", 2 << 20},
+		{"01:00", 0},
+		{"06:59", 0},
+		{"07:00", 2 << 20},
+		{"23:00", 100 << 10},
+	}
+	for _, tt := range tests {
+		at, _ := time.ParseInLocation("15:04", tt.clock, time.Local)
+		if got := s.LimitAt(at); got != tt.want {
+			t.Errorf("LimitAt(%s) = %d, want %d", tt.clock, got, tt.want)
+		}
+	}
+
+	if _, err := NewSchedule(config.Bandwidth{Schedule: []config.BandwidthWindow{{From: "25:00", To: "07:00"}}}); err == nil {
+		t.Error("NewSchedule accepted an invalid time")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	body := strings.Repeat("x", 32<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	// A 64 KiB/s bucket starts empty, so two 32 KiB bodies take about 1s;
+	// they share the bucket even when read concurrently.
+	limiter := NewLimiter(Schedule{Default: 64 << 10})
+	client := &http.Client{Transport: Transport(nil, limiter)}
+
+	start := time.Now()
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Body.Close()
+			_, err = io.Copy(io.Discard, resp.Body)
+			errs <- err
+		}()
+	}
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("64 KiB at 64 KiB/s took %v, want about 1s", elapsed)
+	}
+}
+
+func TestLimiterWaitCancel(t *testing.T) {
+	limiter := NewLimiter(Schedule{Default: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, 1000); err == nil {
+		t.Error("Wait on a cancelled context succeeded")
+	}
+}
+
+func TestWithTimeoutPausedByLimiter(t *testing.T) {
+	// 2 KiB at 1 KiB/s takes about 2s, far over the 200ms timeout, but the
+	// limiter's waits do not count against it.
+	limiter := NewLimiter(Schedule{Default: 1 << 10})
+	ctx, cancel := WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	for range 2 {
+		if err := limiter.Wait(ctx, 1<<10); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("context expired while throttled: %v", err)
+	}
+
+	<-ctx.Done()
+	if cause := context.Cause(ctx); cause != context.DeadlineExceeded {
+		t.Errorf("cause = %v, want the timeout", cause)
+	}
+}
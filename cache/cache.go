@@ -0,0 +1,249 @@
+// Package cache stores API responses in memory and on disk with a TTL.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/XiaoMengXinX/spotdl/logger"
+)
+
+// DirName is the name of the cache directory next to the config file.
+const DirName = "cache"
+
+type entry struct {
+	Key      string    `json:"key"`
+	Endpoint string    `json:"endpoint"`
+	Expires  time.Time `json:"expires"`
+	Data     []byte    `json:"data"`
+}
+
+func (e entry) expired() bool {
+	return time.Now().After(e.Expires)
+}
+
+// Cache is a two level response cache: entries are kept in memory for the
+// lifetime of the process and written to one file per key under dir. It is
+// safe for concurrent use.
+type Cache struct {
+	dir string
+
+	mu     sync.RWMutex
+	mem    map[string]entry
+	hits   int
+	misses int
+}
+
+// Stats describes the entries stored on disk.
+type Stats struct {
+	Entries    int
+	Expired    int
+	Bytes      int64
+	ByEndpoint map[string]int
+}
+
+func New(dir string) *Cache {
+	return &Cache{
+		dir: dir,
+		mem: make(map[string]entry),
+	}
+}
+
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Get returns the cached data for key if it has not expired.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	return c.get(key, false)
+}
+
+// GetStale returns the cached data for key even if it has expired.
+func (c *Cache) GetStale(key string) ([]byte, bool) {
+	return c.get(key, true)
+}
+
+func (c *Cache) get(key string, allowExpired bool) ([]byte, bool) {
+	c.mu.RLock()
+	e, ok := c.mem[key]
+	c.mu.RUnlock()
+
+	if !ok {
+		var err error
+		e, err = c.readEntry(c.path(key))
+		ok = err == nil && e.Key == key
+		if ok {
+			c.mu.Lock()
+			c.mem[key] = e
+			c.mu.Unlock()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok || (!allowExpired && e.expired()) {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	return e.Data, true
+}
+
+// Set stores data under key for ttl. The endpoint name is kept for stats.
+func (c *Cache) Set(key, endpoint string, data []byte, ttl time.Duration) {
+	e := entry{
+		Key:      key,
+		Endpoint: endpoint,
+		Expires:  time.Now().Add(ttl),
+		Data:     data,
+	}
+	c.mu.Lock()
+	c.mem[key] = e
+	c.mu.Unlock()
+
+	if err := c.writeEntry(c.path(key), e); err != nil {
+		log.Warnf("Failed to write cache entry: %v", err)
+	}
+}
+
+// Counters returns the number of hits and misses served by this process.
+func (c *Cache) Counters() (hits, misses int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.hits, c.misses
+}
+
+// Clear removes every entry from memory and disk.
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	c.mem = make(map[string]entry)
+	c.mu.Unlock()
+
+	if err := os.RemoveAll(c.dir); err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+	return nil
+}
+
+// Prune removes expired entries from memory and disk and returns how many
+// were removed from disk. Entries are not pruned on their own, since offline
+// metadata mode still serves them.
+func (c *Cache) Prune() (int, error) {
+	c.mu.Lock()
+	for key, e := range c.mem {
+		if e.expired() {
+			delete(c.mem, key)
+		}
+	}
+	c.mu.Unlock()
+
+	removed := 0
+	err := c.walk(func(path string, d fs.DirEntry, e entry) error {
+		if !e.expired() {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to prune cache: %w", err)
+	}
+	return removed, nil
+}
+
+// Stats walks the cache directory.
+func (c *Cache) Stats() (Stats, error) {
+	stats := Stats{ByEndpoint: make(map[string]int)}
+	err := c.walk(func(path string, d fs.DirEntry, e entry) error {
+		if info, err := d.Info(); err == nil {
+			stats.Bytes += info.Size()
+		}
+		stats.Entries++
+		stats.ByEndpoint[e.Endpoint]++
+		if e.expired() {
+			stats.Expired++
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to read cache: %w", err)
+	}
+	return stats, nil
+}
+
+// walk calls fn for every readable entry file in the cache directory.
+func (c *Cache) walk(fn func(path string, d fs.DirEntry, e entry) error) error {
+	return filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		e, err := c.readEntry(path)
+		if err != nil {
+			return nil
+		}
+		return fn(path, d, e)
+	})
+}
+
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name+".json")
+}
+
+func (c *Cache) readEntry(path string) (entry, error) {
+	var e entry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+func (c *Cache) writeEntry(path string, e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Each write gets its own temp file, so concurrent writers of a key
+	// never rename a partly written entry into place.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	c := New(dir)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("empty cache returned a hit")
+	}
+	c.Set("a", "track", []byte("alpha"), time.Hour)
+	c.Set("b", "playlist", []byte("beta"), -time.Second)
+
+	if data, ok := c.Get("a"); !ok || string(data) != "alpha" {
+		t.Fatalf("Get(a) = %q, %v", data, ok)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expired entry returned by Get")
+	}
+	if data, ok := c.GetStale("b"); !ok || string(data) != "beta" {
+		t.Errorf("GetStale(b) = %q, %v", data, ok)
+	}
+
+	// A fresh instance reads entries back from disk.
+	reloaded := New(dir)
+	if data, ok := reloaded.Get("a"); !ok || string(data) != "alpha" {
+		t.Fatalf("reloaded Get(a) = %q, %v", data, ok)
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 || stats.Expired != 1 || stats.ByEndpoint["track"] != 1 || stats.Bytes == 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	if n, err := c.Prune(); err != nil || n != 1 {
+		t.Fatalf("Prune() = %d, %v, want 1 entry removed", n, err)
+	}
+	if _, ok := New(dir).GetStale("b"); ok {
+		t.Errorf("expired entry survived Prune on disk")
+	}
+	if _, ok := c.GetStale("b"); ok {
+		t.Errorf("expired entry survived Prune in memory")
+	}
+	if stats, _ := c.Stats(); stats.Entries != 1 || stats.Expired != 0 {
+		t.Errorf("stats after Prune: %+v", stats)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.GetStale("a"); ok {
+		t.Errorf("entry survived Clear")
+	}
+	if stats, _ := c.Stats(); stats.Entries != 0 {
+		t.Errorf("stats after Clear: %+v", stats)
+	}
+}
+
+func TestCacheConcurrentSet(t *testing.T) {
+	dir := t.TempDir()
+	c := New(dir)
+
+	values := map[string]bool{}
+	var wg sync.WaitGroup
+	for i := range 20 {
+		value := strings.Repeat(strconv.Itoa(i), 1000*(i+1))
+		values[value] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Set("shared", "track", []byte(value), time.Hour)
+		}()
+	}
+	wg.Wait()
+
+	if data, ok := New(dir).Get("shared"); !ok || !values[string(data)] {
+		t.Errorf("Get(shared) = %d bytes, %v, want one of the written values", len(data), ok)
+	}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && strings.HasSuffix(path, ".tmp") {
+			t.Errorf("temp file left behind: %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
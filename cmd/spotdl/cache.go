@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/XiaoMengXinX/spotdl/cache"
+	log "github.com/XiaoMengXinX/spotdl/logger"
+	"github.com/spf13/pflag"
+)
+
+func runCache(args []string) {
+	flags := pflag.NewFlagSet("cache", pflag.ExitOnError)
+	config := flags.StringP("config", "c", "", "Path to configuration file")
+	expired := flags.BoolP("expired", "", false, "Only clear entries that have expired")
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s cache clear [--expired]|stats [-c config]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *config == "" {
+		*config = defaultConfigPath()
+	}
+	c := cache.New(filepath.Join(filepath.Dir(*config), cache.DirName))
+
+	switch flags.Arg(0) {
+	case "clear":
+		if *expired {
+			n, err := c.Prune()
+			if err != nil {
+				log.Fatalf("Failed to clear cache: %v", err)
+			}
+			log.Infof("Cleared %d expired entries from cache: %s", n, c.Dir())
+			return
+		}
+		if err := c.Clear(); err != nil {
+			log.Fatalf("Failed to clear cache: %v", err)
+		}
+		log.Infof("Cleared cache: %s", c.Dir())
+	case "stats":
+		stats, err := c.Stats()
+		if err != nil {
+			log.Fatalf("Failed to read cache: %v", err)
+		}
+		fmt.Printf("Cache: %s\n", c.Dir())
+		fmt.Printf("Entries: %d (%d expired)\n", stats.Entries, stats.Expired)
+		fmt.Printf("Size: %.1f KiB\n", float64(stats.Bytes)/1024)
+		endpoints := make([]string, 0, len(stats.ByEndpoint))
+		for endpoint := range stats.ByEndpoint {
+			endpoints = append(endpoints, endpoint)
+		}
+		sort.Strings(endpoints)
+		for _, endpoint := range endpoints {
+			fmt.Printf("  %-16s %d\n", endpoint, stats.ByEndpoint[endpoint])
+		}
+	default:
+		flags.Usage()
+		os.Exit(1)
+	}
+}
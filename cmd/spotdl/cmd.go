@@ -2,23 +2,47 @@ package main
 
 import (
 	"fmt"
+	"github.com/XiaoMengXinX/spotdl/bandwidth"
+	cfg "github.com/XiaoMengXinX/spotdl/config"
 	log "github.com/XiaoMengXinX/spotdl/logger"
 	"github.com/XiaoMengXinX/spotdl/spotify"
+	"github.com/XiaoMengXinX/spotdl/token"
 	"github.com/spf13/pflag"
 	"os"
 	"path/filepath"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		runCache(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "retag" {
+		runRetag(os.Args[2:])
+		return
+	}
+
 	var (
 		showHelp           = pflag.BoolP("help", "h", false, "Show this help message")
-		id                 = pflag.StringP("id", "i", "", "ID/URL/URI of a spotify track/playlist/album/podcast to download (Required)\nExample: -i https://open.spotify.com/track/4jTrKMoc44RYZsoFsIlQev")
+		id                 = pflag.StringP("id", "i", "", "ID/URL/URI of a spotify track/playlist/album/podcast, or a file tagged by spotdl, to download (Required)\nExample: -i https://open.spotify.com/track/4jTrKMoc44RYZsoFsIlQev")
 		quality            = pflag.StringP("quality", "q", "", "Audio quality level (default \"MP4_128\")\nOptions: MP4_128, MP4_256")
 		output             = pflag.StringP("output", "o", "./", "Output directory for downloaded files")
 		config             = pflag.StringP("config", "c", "", "Path to configuration file")
 		debug              = pflag.BoolP("debug", "d", false, "Debug mode")
 		convertToMP3       = pflag.BoolP("mp3", "", false, "Convert downloaded files to mp3 format")
+		formats            = pflag.StringSliceP("formats", "", nil, "Output formats or transcoding profiles written for each track, downloaded once\nBuilt-in profiles: mp3, mp3-v0, opus-128, aac-256, flac, wav\nExample: m4a,mp3")
+		template           = pflag.StringP("template", "", "", "Output path template without extension (default \"{title} - {artist}\")\nVariables: {title}, {artist}, {album}, {track}, {disc}, {id}, {format}")
 		skipAddingMetadata = pflag.BoolP("no-metadata", "", false, "Skip adding metadata to downloaded files")
+		chapterFile        = pflag.StringP("chapters", "", "", "Write episode chapters to a sidecar file\nOptions: txt, cue")
+		creditsFile        = pflag.BoolP("credits-file", "", false, "Write the full credits of each track to a .credits.json file")
+		feed               = pflag.BoolP("feed", "", false, "Keep a podcast RSS feed (feed.xml) of downloaded episodes in their folder")
+		feedURL            = pflag.StringP("feed-url", "", "", "Base URL the output directory is served at, used for feed enclosures\nExample: http://nas.local/podcasts")
+		replayGain         = pflag.BoolP("replaygain", "", false, "Analyze loudness and add ReplayGain tags, with album gain approximated for albums")
+		tokenFile          = pflag.StringP("token-file", "", "", "Read access tokens from a JSON file instead of using the sp_dc cookie")
+		proxy              = pflag.StringP("proxy", "", "", "Proxy for all requests\nExample: http://127.0.0.1:8080, socks5://127.0.0.1:1080")
+		timeout            = pflag.IntP("timeout", "", 0, "Timeout in seconds for API requests (default 10)")
+		limitRate          = pflag.StringP("limit-rate", "", "", "Maximum download rate in bytes per second\nExample: 500K, 2M")
+		offlineMetadata    = pflag.BoolP("offline-metadata", "", false, "Serve metadata only from the cache without network requests")
 	)
 
 	pflag.Parse()
@@ -29,6 +53,8 @@ func main() {
 	}
 	if *id == "" {
 		fmt.Printf("Usage: %s -i <spotify_id_or_url> [options]\n", os.Args[0])
+		fmt.Printf("       %s cache clear [--expired]|stats [-c config]\n", os.Args[0])
+		fmt.Printf("       %s retag <dir> [--dry-run] [-c config]\n", os.Args[0])
 		fmt.Println("Use -h or --help for more information")
 		os.Exit(1)
 	}
@@ -37,18 +63,7 @@ func main() {
 	}
 
 	if *config == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			*config = "config.json"
-		} else {
-			configDir := filepath.Join(homeDir, ".config", "spotdl")
-			if err := os.MkdirAll(configDir, 0755); err != nil {
-				log.Errorf("Failed to create config directory: %v", err)
-				*config = "config.json"
-			} else {
-				*config = filepath.Join(configDir, "config.json")
-			}
-		}
+		*config = defaultConfigPath()
 	}
 
 	sp := spotify.NewDownloader()
@@ -71,11 +86,81 @@ func main() {
 		log.Infoln("Downloaded music will be converted to mp3")
 	}
 
+	if len(*formats) > 0 {
+		var targets []spotify.Target
+		for _, format := range *formats {
+			targets = append(targets, spotify.Target{Format: format})
+		}
+		if err := sp.SetTargets(targets...); err != nil {
+			log.Fatalf("Failed to set output formats: %v", err)
+		}
+		log.Infof("Set output formats: %v", *formats)
+	}
+
+	if *template != "" {
+		if err := sp.SetTemplate(*template); err != nil {
+			log.Fatalf("Failed to set output template: %v", err)
+		}
+		log.Infof("Set output template: %s", *template)
+	}
+
+	if *chapterFile != "" {
+		if err := sp.SetChapterFile(*chapterFile); err != nil {
+			log.Fatalf("Failed to set chapter file: %v", err)
+		}
+		log.Infof("Episode chapters will be written to %s files", *chapterFile)
+	}
+
+	if *creditsFile {
+		sp.SetCreditsFile(*creditsFile)
+		log.Infoln("Track credits will be written to .credits.json files")
+	}
+
+	if *feed {
+		sp.WritePodcastFeed(*feed)
+		log.Infoln("Podcast feeds will be written for downloaded episodes")
+	}
+
+	if *feedURL != "" {
+		sp.SetFeedBaseURL(*feedURL)
+	}
+
+	if *replayGain {
+		sp.SetReplayGain(*replayGain)
+		log.Infoln("ReplayGain tags will be added to downloaded tracks")
+	}
+
 	if *skipAddingMetadata {
 		sp.SkipAddingMetadata(*skipAddingMetadata)
 		log.Infoln("Skip adding metadata to downloaded files")
 	}
 
+	if *proxy != "" || *timeout > 0 {
+		sp.SetNetwork(cfg.Network{Proxy: *proxy, Timeout: *timeout})
+		if *proxy != "" {
+			log.Infof("Set proxy: %s", *proxy)
+		}
+	}
+
+	if *limitRate != "" {
+		rate, err := bandwidth.ParseRate(*limitRate)
+		if err != nil {
+			log.Fatalf("Failed to set rate limit: %v", err)
+		}
+		sp.SetRateLimit(rate)
+		log.Infof("Set rate limit: %s/s", *limitRate)
+	}
+
+	if *offlineMetadata {
+		sp.SetOfflineMetadata(*offlineMetadata)
+		log.Infoln("Serving metadata from the cache only")
+	}
+
+	if *tokenFile != "" {
+		sp.SetTokenSource(token.FileTokenSource(*tokenFile))
+		log.Infof("Using access tokens from: %s", *tokenFile)
+	}
+
 	log.Infof("Initializing Downloader")
 	sp.Initialize()
 
@@ -88,3 +173,16 @@ func main() {
 		log.Fatalf("Download failed: %v", err)
 	}
 }
+
+func defaultConfigPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "config.json"
+	}
+	configDir := filepath.Join(homeDir, ".config", "spotdl")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		log.Errorf("Failed to create config directory: %v", err)
+		return "config.json"
+	}
+	return filepath.Join(configDir, "config.json")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/XiaoMengXinX/spotdl/logger"
+	"github.com/XiaoMengXinX/spotdl/spotify"
+	"github.com/XiaoMengXinX/spotdl/token"
+	"github.com/spf13/pflag"
+)
+
+func runRetag(args []string) {
+	flags := pflag.NewFlagSet("retag", pflag.ExitOnError)
+	config := flags.StringP("config", "c", "", "Path to configuration file")
+	dryRun := flags.BoolP("dry-run", "n", false, "Print the tag changes without writing them")
+	debug := flags.BoolP("debug", "d", false, "Debug mode")
+	tokenFile := flags.StringP("token-file", "", "", "Read access tokens from a JSON file instead of using the sp_dc cookie")
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s retag <dir> [--dry-run] [-c config]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	dir := flags.Arg(0)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		log.Fatalf("Not a directory: %s", dir)
+	}
+	if *debug {
+		log.SetLevel(log.LevelDebug)
+	}
+	if *config == "" {
+		*config = defaultConfigPath()
+	}
+
+	sp := spotify.NewDownloader()
+	sp.TokenManager.ConfigManager.SetConfigPath(*config)
+	// Covers are fetched into the library while they are embedded.
+	sp.SetOutputPath(dir)
+	if *tokenFile != "" {
+		sp.SetTokenSource(token.FileTokenSource(*tokenFile))
+	}
+	sp.Initialize()
+
+	results, err := sp.Retag(dir, *dryRun)
+	if err != nil {
+		log.Fatalf("Retag failed: %v", err)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			continue
+		}
+		if !*dryRun {
+			continue
+		}
+		fmt.Printf("%s (%s %s, matched by %s)\n", r.Path, r.Type, r.ID, r.Match)
+		if len(r.Changes) == 0 {
+			fmt.Println("  no changes")
+		}
+		for _, c := range r.Changes {
+			fmt.Printf("  %s: %q -> %q\n", c.Tag, displayValue(c.Old), displayValue(c.New))
+		}
+	}
+	log.Infof("Retagged %d of %d file(s)", len(results)-failed, len(results))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// displayValue shows the values of multi-value tags separated by "; ".
+func displayValue(value string) string {
+	return strings.ReplaceAll(value, "\x00", "; ")
+}
@@ -6,19 +6,26 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"sync"
 
 	log "github.com/XiaoMengXinX/spotdl/logger"
 )
 
 type Data struct {
-	DefaultQuality    string   `json:"quality"`
-	SpDc              string   `json:"sp_dc"`
-	AccessToken       string   `json:"accessToken"`
-	ClientID          string   `json:"clientId"`
-	ClientToken       string   `json:"clientToken"`
-	AccessTokenExpire int64    `json:"accessTokenExpire"`
-	AcceptLanguage    []string `json:"accept-language"`
-	TOTP              TOTP     `json:"totp"`
+	DefaultQuality    string    `json:"quality"`
+	SpDc              string    `json:"sp_dc"`
+	AccessToken       string    `json:"accessToken"`
+	ClientID          string    `json:"clientId"`
+	ClientToken       string    `json:"clientToken"`
+	AccessTokenExpire int64     `json:"accessTokenExpire"`
+	AcceptLanguage    []string  `json:"accept-language"`
+	TOTP              TOTP      `json:"totp"`
+	Network           Network   `json:"network"`
+	Cache             Cache     `json:"cache"`
+	Download          Download  `json:"download"`
+	Bandwidth         Bandwidth `json:"bandwidth"`
+	RateLimit         RateLimit `json:"rateLimit"`
+	Output            Output    `json:"output"`
 }
 
 type TOTP struct {
@@ -26,7 +33,120 @@ type TOTP struct {
 	Version int    `json:"version"`
 }
 
+// Network configures the shared HTTP client. Timeouts are in seconds.
+type Network struct {
+	Proxy          string `json:"proxy"`
+	Timeout        int    `json:"timeout"`
+	ConnectTimeout int    `json:"connectTimeout"`
+	DisableHTTP2   bool   `json:"disableHttp2"`
+	// StallTimeout is how many seconds an audio download may go without
+	// receiving data before switching to another CDN.
+	StallTimeout int `json:"stallTimeout"`
+}
+
+// Download configures how audio files are fetched: Segments ranges of
+// SegmentSize bytes are downloaded concurrently.
+type Download struct {
+	Segments    int   `json:"segments"`
+	SegmentSize int64 `json:"segmentSize"`
+}
+
+// Bandwidth limits download throughput. Limit is a rate such as "2M" in
+// bytes per second; windows in Schedule override it between From and To,
+// given as local "HH:MM" times. An empty or "0" limit means unlimited.
+type Bandwidth struct {
+	Limit    string            `json:"limit"`
+	Schedule []BandwidthWindow `json:"schedule"`
+}
+
+type BandwidthWindow struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Limit string `json:"limit"`
+}
+
+// RateLimit spaces out API requests per host. Hosts overrides the default
+// for individual hosts such as "api.spotify.com".
+type RateLimit struct {
+	Disabled          bool                 `json:"disabled"`
+	RequestsPerSecond float64              `json:"requestsPerSecond"`
+	Burst             int                  `json:"burst"`
+	Hosts             map[string]RateLimit `json:"hosts"`
+}
+
+// Output configures the files written for each item. Formats lists the
+// output formats, by default only the downloaded one. Template is the path of
+// each file relative to the output folder, without extension; Templates
+// overrides it per format. Profiles adds or replaces transcoding profiles
+// usable as formats. ReplayGain enables loudness analysis and tagging.
+// ChapterFile writes episode chapters to a "txt" or "cue" sidecar.
+// AudiobookTemplate is the path of audiobook chapters. Feed writes a podcast
+// feed of downloaded episodes. Credits sets how track credits are tagged and
+// Artists how multiple artists are joined.
+type Output struct {
+	Formats           []string           `json:"formats"`
+	Template          string             `json:"template"`
+	Templates         map[string]string  `json:"templates"`
+	AudiobookTemplate string             `json:"audiobookTemplate"`
+	Profiles          map[string]Profile `json:"profiles"`
+	ReplayGain        bool               `json:"replayGain"`
+	ChapterFile       string             `json:"chapterFile"`
+	Feed              Feed               `json:"feed"`
+	Credits           Credits            `json:"credits"`
+	Artists           Artists            `json:"artists"`
+}
+
+// Artists sets how tracks by several artists are written. Separator joins
+// them in the artist tag. With Feat, e.g. "feat.", the first artist is
+// followed by Feat and the others. FileName picks the {artist} of paths:
+// "first", "all" or "album" for the album artist.
+type Artists struct {
+	Separator string `json:"separator"`
+	Feat      string `json:"feat"`
+	FileName  string `json:"fileName"`
+}
+
+// Credits maps credit roles and subroles such as "Producers" or "Lyricist"
+// to one of the tags composer, lyricist, producer, engineer, mixer, arranger
+// or performer, or to "" to leave them out. Roles not listed keep their
+// default mapping. File writes the full credits to a ".credits.json" file.
+type Credits struct {
+	Roles map[string]string `json:"roles"`
+	File  bool              `json:"file"`
+}
+
+// Feed configures the RSS feed kept in each show folder. BaseURL is where the
+// output folder is served, e.g. "http://nas.local/podcasts"; without it,
+// enclosure URLs are relative.
+type Feed struct {
+	Enabled bool   `json:"enabled"`
+	BaseURL string `json:"baseUrl"`
+}
+
+// Profile is a transcoding setting. Codec is an ffmpeg encoder such as
+// "libopus" and Container the file extension. Quality selects VBR quality and
+// takes precedence over Bitrate, e.g. "128k"; with neither, lossy codecs keep
+// the source bitrate. Args are extra ffmpeg output options such as
+// ["-application", "audio"].
+type Profile struct {
+	Codec      string   `json:"codec"`
+	Container  string   `json:"container"`
+	Bitrate    string   `json:"bitrate,omitempty"`
+	Quality    string   `json:"quality,omitempty"`
+	SampleRate int      `json:"sampleRate,omitempty"`
+	Channels   int      `json:"channels,omitempty"`
+	Args       []string `json:"args,omitempty"`
+}
+
+// Cache configures the metadata response cache. TTL overrides the built-in
+// time to live, in seconds, per endpoint name.
+type Cache struct {
+	Disabled bool           `json:"disabled"`
+	TTL      map[string]int `json:"ttl"`
+}
+
 type Manager struct {
+	mu         sync.RWMutex
 	configPath string
 	config     Data
 	defaults   Data
@@ -43,6 +163,31 @@ func NewConfigManager() *Manager {
 		AcceptLanguage:    []string{},
 		DefaultQuality:    "MP4_128",
 		TOTP:              TOTP{},
+		Network: Network{
+			Timeout:        10,
+			ConnectTimeout: 10,
+			StallTimeout:   30,
+		},
+		Cache: Cache{
+			TTL: map[string]int{},
+		},
+		RateLimit: RateLimit{
+			RequestsPerSecond: 10,
+			Burst:             10,
+			Hosts:             map[string]RateLimit{},
+		},
+		Output: Output{
+			Template:          "{title} - {artist}",
+			Templates:         map[string]string{},
+			AudiobookTemplate: "{album}/{track} - {title}",
+			Credits:           Credits{Roles: map[string]string{}},
+			Artists:           Artists{Separator: ", ", FileName: "first"},
+			Profiles:          map[string]Profile{},
+		},
+		Download: Download{
+			Segments:    4,
+			SegmentSize: 4 << 20,
+		},
 	}
 	return &Manager{
 		configPath: "config.json",
@@ -52,6 +197,8 @@ func NewConfigManager() *Manager {
 }
 
 func (cm *Manager) Initialize() *Manager {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	log.Debugf("Initializing Config Manager, config path: %s", cm.configPath)
 	if _, err := os.Stat(cm.configPath); errors.Is(err, os.ErrNotExist) {
 		log.Debugf("Config file not found, trying to create one")
@@ -61,12 +208,23 @@ func (cm *Manager) Initialize() *Manager {
 }
 
 func (cm *Manager) SetConfigPath(path string) *Manager {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	log.Debugf("Set config path to: %s", path)
 	cm.configPath = path
 	return cm
 }
 
+// GetPath returns the path of the config file.
+func (cm *Manager) GetPath() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.configPath
+}
+
 func (cm *Manager) ReadConfig() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	log.Debugf("Reading config file: %s", cm.configPath)
 	data, err := os.ReadFile(cm.configPath)
 	if err != nil {
@@ -87,6 +245,8 @@ func (cm *Manager) ReadConfig() error {
 }
 
 func (cm *Manager) Get() Data {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 	return cm.config
 }
 
@@ -102,6 +262,8 @@ func (cm *Manager) GetDefault() Data {
 }
 
 func (cm *Manager) Set(newConfig Data) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	cm.config = newConfig
 	cm.writeConfig()
 }
@@ -0,0 +1,61 @@
+package config
+
+// Endpoints holds the base URLs of every Spotify service used by the
+// downloader. Fields left empty fall back to DefaultEndpoints.
+type Endpoints struct {
+	WebAPI       string `json:"webApi"`
+	SpClient     string `json:"spClient"`
+	ClientBase   string `json:"clientBase"`
+	Pathfinder   string `json:"pathfinder"`
+	SeekTables   string `json:"seekTables"`
+	Images       string `json:"images"`
+	APResolve    string `json:"apResolve"`
+	SessionToken string `json:"sessionToken"`
+	ServerTime   string `json:"serverTime"`
+	ClientToken  string `json:"clientToken"`
+}
+
+// DefaultEndpoints returns the production Spotify endpoints.
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		WebAPI:       "https://api.spotify.com",
+		SpClient:     "https://spclient.wg.spotify.com",
+		ClientBase:   "https://gew4-spclient.spotify.com",
+		Pathfinder:   "https://api-partner.spotify.com/pathfinder/v1/query",
+		SeekTables:   "https://seektables.scdn.co",
+		Images:       "https://i.scdn.co",
+		APResolve:    "https://apresolve.spotify.com",
+		SessionToken: "https://open.spotify.com/api/token",
+		ServerTime:   "https://open.spotify.com/api/server-time",
+		ClientToken:  "https://clienttoken.spotify.com/v1/clienttoken",
+	}
+}
+
+// Merge returns a copy of e with every non-empty field of override applied.
+func (e Endpoints) Merge(override Endpoints) Endpoints {
+	merge := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	merge(&e.WebAPI, override.WebAPI)
+	merge(&e.SpClient, override.SpClient)
+	merge(&e.ClientBase, override.ClientBase)
+	merge(&e.Pathfinder, override.Pathfinder)
+	merge(&e.SeekTables, override.SeekTables)
+	merge(&e.Images, override.Images)
+	merge(&e.APResolve, override.APResolve)
+	merge(&e.SessionToken, override.SessionToken)
+	merge(&e.ServerTime, override.ServerTime)
+	merge(&e.ClientToken, override.ClientToken)
+	return e
+}
+
+// ResolveEndpoints merges the given overrides, in order, over the defaults.
+func ResolveEndpoints(overrides ...Endpoints) Endpoints {
+	e := DefaultEndpoints()
+	for _, o := range overrides {
+		e = e.Merge(o)
+	}
+	return e
+}
@@ -0,0 +1,411 @@
+// Package download fetches large files with concurrent HTTP range requests.
+// Finished segments are recorded in a sidecar file next to the destination so
+// an interrupted download resumes where it stopped.
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultSegments    = 4
+	DefaultSegmentSize = 4 << 20
+
+	// ProgressSuffix is appended to the destination path to name the file
+	// recording finished segments.
+	ProgressSuffix = ".progress"
+
+	progressInterval = 200 * time.Millisecond
+)
+
+// ErrStalled is returned when no data arrived within Options.StallTimeout.
+var ErrStalled = errors.New("download stalled")
+
+type Options struct {
+	// Segments is the number of ranges fetched concurrently.
+	Segments int
+	// SegmentSize is the size in bytes of each range.
+	SegmentSize int64
+	// StallTimeout aborts the download when no data is received for this
+	// long. Zero disables stall detection.
+	StallTimeout time.Duration
+	// OnProgress is called periodically and once more when the download
+	// completes.
+	OnProgress func(Progress)
+}
+
+type Progress struct {
+	// Written is the number of bytes on disk, including segments finished
+	// by an earlier attempt.
+	Written int64
+	Total   int64
+	// Rate is the current transfer rate in bytes per second.
+	Rate float64
+}
+
+type Downloader struct {
+	client *http.Client
+	opts   Options
+}
+
+func New(client *http.Client, opts Options) *Downloader {
+	if opts.Segments <= 0 {
+		opts.Segments = DefaultSegments
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	return &Downloader{client: client, opts: opts}
+}
+
+// progress is the sidecar file content.
+type progress struct {
+	Size        int64  `json:"size"`
+	SegmentSize int64  `json:"segmentSize"`
+	Done        []bool `json:"done"`
+}
+
+// Download fetches url into path. If path has a matching progress sidecar
+// from an earlier attempt, only the missing segments are fetched; the sidecar
+// is removed once the file is complete. The URL may differ between attempts
+// as long as it serves the same content.
+func (d *Downloader) Download(ctx context.Context, url, path string) error {
+	size, ranged, err := d.probe(ctx, url)
+	if err != nil {
+		return err
+	}
+	if !ranged {
+		return d.downloadWhole(ctx, url, path, size)
+	}
+
+	prog, f, err := d.open(path, size)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	t := &transfer{
+		d:     d,
+		url:   url,
+		file:  f,
+		path:  path,
+		prog:  prog,
+		total: size,
+	}
+	for i, done := range prog.Done {
+		if done {
+			t.written.Add(t.segmentLen(i))
+		}
+	}
+	t.begin()
+	if err := t.run(ctx); err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	_ = os.Remove(path + ProgressSuffix)
+	return nil
+}
+
+// probe requests the first byte to learn the size and whether the server
+// supports range requests.
+func (d *Downloader) probe(ctx context.Context, url string) (size int64, ranged bool, err error) {
+	if d.opts.StallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, d.opts.StallTimeout, ErrStalled)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, false, causeOf(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		size, err := strconv.ParseInt(total, 10, 64)
+		if !ok || err != nil || size <= 0 {
+			return 0, false, fmt.Errorf("invalid Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+		return size, true, nil
+	case http.StatusOK:
+		return resp.ContentLength, false, nil
+	default:
+		return 0, false, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+}
+
+// open returns the progress of an earlier attempt at path, or a fresh one
+// with path truncated to size if there is none, it cannot be parsed or it
+// does not match.
+func (d *Downloader) open(path string, size int64) (*progress, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var prog progress
+	data, err := os.ReadFile(path + ProgressSuffix)
+	if err == nil && json.Unmarshal(data, &prog) == nil && prog.Size == size && prog.SegmentSize == d.opts.SegmentSize {
+		if info, err := f.Stat(); err == nil && info.Size() == size {
+			return &prog, f, nil
+		}
+	}
+
+	prog = progress{
+		Size:        size,
+		SegmentSize: d.opts.SegmentSize,
+		Done:        make([]bool, (size+d.opts.SegmentSize-1)/d.opts.SegmentSize),
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return &prog, f, nil
+}
+
+// downloadWhole is the fallback for servers without range support.
+func (d *Downloader) downloadWhole(ctx context.Context, url, path string, size int64) error {
+	_ = os.Remove(path + ProgressSuffix)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	t := &transfer{d: d, url: url, total: size}
+	t.begin()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	n, err := t.fetch(ctx, cancel, "", f)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("received %d bytes, want %d", n, size)
+	}
+	t.report(true)
+	return nil
+}
+
+type transfer struct {
+	d     *Downloader
+	url   string
+	file  *os.File
+	path  string
+	total int64
+
+	mu   sync.Mutex
+	prog *progress
+
+	written atomic.Int64
+
+	reportMu     sync.Mutex
+	started      time.Time
+	startWritten int64
+	lastReport   time.Time
+	lastWritten  int64
+}
+
+func (t *transfer) segmentLen(i int) int64 {
+	start := int64(i) * t.prog.SegmentSize
+	return min(t.prog.SegmentSize, t.total-start)
+}
+
+func (t *transfer) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	pending := make(chan int, len(t.prog.Done))
+	for i, done := range t.prog.Done {
+		if !done {
+			pending <- i
+		}
+	}
+	close(pending)
+
+	var wg sync.WaitGroup
+	for range t.d.opts.Segments {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := t.segment(ctx, cancel, i); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+	t.report(true)
+	return nil
+}
+
+func (t *transfer) segment(ctx context.Context, cancel context.CancelCauseFunc, i int) error {
+	start := int64(i) * t.prog.SegmentSize
+	length := t.segmentLen(i)
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", start, start+length-1)
+
+	n, err := t.fetch(ctx, cancel, rangeHeader, io.NewOffsetWriter(t.file, start))
+	if err != nil {
+		t.written.Add(-n)
+		return err
+	}
+	if n != length {
+		t.written.Add(-n)
+		return fmt.Errorf("segment %d: received %d bytes, want %d", i, n, length)
+	}
+
+	// The segment must be on disk before the sidecar says it is.
+	if err := t.file.Sync(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prog.Done[i] = true
+	return t.prog.save(t.path + ProgressSuffix)
+}
+
+// save writes the progress to path through a temporary file, so a crash
+// leaves either the old or the new sidecar.
+func (p *progress) save(path string) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFile, path)
+}
+
+// fetch copies the response for rangeHeader into w and returns the number of
+// bytes written. A stall cancels ctx with ErrStalled.
+func (t *transfer) fetch(ctx context.Context, cancel context.CancelCauseFunc, rangeHeader string, w io.Writer) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+
+	var stall *time.Timer
+	if t.d.opts.StallTimeout > 0 {
+		stall = time.AfterFunc(t.d.opts.StallTimeout, func() { cancel(ErrStalled) })
+		defer stall.Stop()
+	}
+
+	resp, err := t.d.client.Do(req)
+	if err != nil {
+		return 0, causeOf(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	want := http.StatusOK
+	if rangeHeader != "" {
+		want = http.StatusPartialContent
+	}
+	if resp.StatusCode != want {
+		return 0, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+
+	var n int64
+	buf := make([]byte, 32<<10)
+	for {
+		m, readErr := resp.Body.Read(buf)
+		if m > 0 {
+			if stall != nil {
+				stall.Reset(t.d.opts.StallTimeout)
+			}
+			if _, err := w.Write(buf[:m]); err != nil {
+				return n, err
+			}
+			n += int64(m)
+			t.written.Add(int64(m))
+			t.report(false)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return n, causeOf(ctx, readErr)
+		}
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return n, fmt.Errorf("received %d bytes, Content-Length is %d", n, resp.ContentLength)
+	}
+	return n, nil
+}
+
+// begin marks the start of the transfer for rate measurement.
+func (t *transfer) begin() {
+	t.started, t.startWritten = time.Now(), t.written.Load()
+	t.lastReport, t.lastWritten = t.started, t.startWritten
+}
+
+// report calls OnProgress at most every progressInterval unless final. The
+// rate is measured since the previous report, or over the whole transfer for
+// the final one.
+func (t *transfer) report(final bool) {
+	if t.d.opts.OnProgress == nil {
+		return
+	}
+	t.reportMu.Lock()
+	defer t.reportMu.Unlock()
+
+	now := time.Now()
+	written := t.written.Load()
+	if !final && now.Sub(t.lastReport) < progressInterval {
+		return
+	}
+
+	since, base := t.lastReport, t.lastWritten
+	if final {
+		since, base = t.started, t.startWritten
+	}
+	var rate float64
+	if elapsed := now.Sub(since).Seconds(); elapsed > 0 {
+		rate = float64(written-base) / elapsed
+	}
+	t.lastReport, t.lastWritten = now, written
+	t.d.opts.OnProgress(Progress{Written: written, Total: t.total, Rate: rate})
+}
+
+// causeOf prefers the cancellation cause, such as ErrStalled, over the
+// generic error it produced.
+func causeOf(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil {
+		return cause
+	}
+	return err
+}
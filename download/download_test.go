@@ -0,0 +1,181 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testContent(n int) []byte {
+	content := make([]byte, n)
+	r := rand.NewChaCha8([32]byte{})
+	_, _ = r.Read(content)
+	return content
+}
+
+func serveContent(content []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "audio", time.Time{}, bytes.NewReader(content))
+	}
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes that do not match the %d byte source", len(got), len(want))
+	}
+	if _, err := os.Stat(path + ProgressSuffix); !os.IsNotExist(err) {
+		t.Errorf("progress file left behind after a complete download")
+	}
+}
+
+func TestDownload(t *testing.T) {
+	content := testContent(1<<20 + 123)
+	srv := httptest.NewServer(serveContent(content))
+	defer srv.Close()
+
+	var written, total int64
+	d := New(srv.Client(), Options{
+		Segments:    3,
+		SegmentSize: 100 << 10,
+		OnProgress:  func(p Progress) { written, total = p.Written, p.Total },
+	})
+	path := filepath.Join(t.TempDir(), "file.tmp")
+	if err := d.Download(context.Background(), srv.URL, path); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	assertFile(t, path, content)
+	if written != int64(len(content)) || total != int64(len(content)) {
+		t.Errorf("final progress = %d/%d, want %d/%d", written, total, len(content), len(content))
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := testContent(10 * 1000)
+	var failing atomic.Bool
+	var requests atomic.Int32
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// The first attempt fails for every segment from the sixth on.
+		if failing.Load() && r.Header.Get("Range") >= "bytes=5000" {
+			http.Error(w, "reset", http.StatusBadGateway)
+			return
+		}
+		serveContent(content)(w, r)
+	}))
+	defer srv.Close()
+
+	d := New(srv.Client(), Options{Segments: 1, SegmentSize: 1000})
+	path := filepath.Join(t.TempDir(), "file.tmp")
+	if err := d.Download(context.Background(), srv.URL, path); err == nil {
+		t.Fatal("first attempt succeeded, want error")
+	}
+	if _, err := os.Stat(path + ProgressSuffix); err != nil {
+		t.Fatalf("progress file missing after interrupted download: %v", err)
+	}
+
+	failing.Store(false)
+	requests.Store(0)
+	if err := d.Download(context.Background(), srv.URL, path); err != nil {
+		t.Fatalf("resumed Download: %v", err)
+	}
+	assertFile(t, path, content)
+	// One probe plus the five missing segments.
+	if n := requests.Load(); n != 6 {
+		t.Errorf("resume made %d requests, want 6", n)
+	}
+}
+
+func TestDownloadCorruptProgress(t *testing.T) {
+	content := testContent(4000)
+	srv := httptest.NewServer(serveContent(content))
+	defer srv.Close()
+
+	// A sidecar cut short by a crash must not mark any segment as done.
+	path := filepath.Join(t.TempDir(), "file.tmp")
+	if err := os.WriteFile(path, make([]byte, len(content)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+ProgressSuffix, []byte(`{"size":4000,"segmentSize":1000,"done":[true,tr`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := New(srv.Client(), Options{Segments: 2, SegmentSize: 1000})
+	if err := d.Download(context.Background(), srv.URL, path); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	assertFile(t, path, content)
+}
+
+func TestDownloadShortSegment(t *testing.T) {
+	content := testContent(4000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=2000-") {
+			w.Header().Set("Content-Range", "bytes 2000-2999/4000")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[2000:2500])
+			return
+		}
+		serveContent(content)(w, r)
+	}))
+	defer srv.Close()
+
+	d := New(srv.Client(), Options{Segments: 2, SegmentSize: 1000})
+	if err := d.Download(context.Background(), srv.URL, filepath.Join(t.TempDir(), "file.tmp")); err == nil {
+		t.Fatal("Download of a truncated segment succeeded")
+	}
+}
+
+func TestDownloadStall(t *testing.T) {
+	content := testContent(4000)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=0-0" {
+			w.Header().Set("Content-Range", "bytes 0-3999/4000")
+			w.Header().Set("Content-Length", "4000")
+			w.WriteHeader(http.StatusPartialContent)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		serveContent(content)(w, r)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	d := New(srv.Client(), Options{StallTimeout: 100 * time.Millisecond})
+	err := d.Download(context.Background(), srv.URL, filepath.Join(t.TempDir(), "file.tmp"))
+	if !errors.Is(err, ErrStalled) {
+		t.Fatalf("Download error = %v, want ErrStalled", err)
+	}
+}
+
+func TestDownloadWithoutRanges(t *testing.T) {
+	content := testContent(5000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "file.tmp")
+	if err := New(srv.Client(), Options{}).Download(context.Background(), srv.URL, path); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	assertFile(t, path, content)
+}
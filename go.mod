@@ -3,9 +3,10 @@ module github.com/XiaoMengXinX/spotdl
 go 1.24
 
 require (
+	github.com/Eyevinn/mp4ff v0.48.0
 	github.com/Sorrow446/go-mp4tag v0.0.0-20240130220823-68ce31d53e37
-	github.com/XiaoMengXinX/SimpleDownloader v0.0.0-20241104184306-5642193c58ed
 	github.com/bogem/id3v2 v1.2.0
+	github.com/chmike/cmac-go v1.1.0
 	github.com/chromedp/cdproto v0.0.0-20250803210736-d308e07a266d
 	github.com/chromedp/chromedp v0.14.1
 	github.com/iyear/gowidevine v0.1.3
@@ -16,10 +17,8 @@ require (
 )
 
 require (
-	github.com/Eyevinn/mp4ff v0.48.0 // indirect
 	github.com/aws/aws-sdk-go v1.55.6 // indirect
 	github.com/boombuler/barcode v1.0.2 // indirect
-	github.com/chmike/cmac-go v1.1.0 // indirect
 	github.com/chromedp/sysutil v1.1.0 // indirect
 	github.com/go-json-experiment/json v0.0.0-20250725192818-e39067aee2d2 // indirect
 	github.com/gobwas/httphead v0.1.0 // indirect
@@ -0,0 +1,91 @@
+// Package httpclient builds the HTTP client shared by the token manager and
+// the downloader.
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/config"
+)
+
+const (
+	defaultTimeout        = 10 * time.Second
+	defaultConnectTimeout = 10 * time.Second
+)
+
+// New returns an HTTP client with a pooled, HTTP/2 capable transport
+// configured from the network settings. An empty proxy falls back to the
+// HTTP_PROXY/HTTPS_PROXY environment variables.
+func New(conf config.Network) (*http.Client, error) {
+	proxy, err := ProxyFunc(conf.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	connectTimeout := seconds(conf.ConnectTimeout, defaultConnectTimeout)
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     !conf.DisableHTTP2,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   connectTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   seconds(conf.Timeout, defaultTimeout),
+	}, nil
+}
+
+// Default returns a client with the default settings.
+func Default() *http.Client {
+	client, _ := New(config.Network{})
+	return client
+}
+
+// WithoutTimeout returns a copy of client sharing its transport but without
+// an overall request timeout, for long running downloads.
+func WithoutTimeout(client *http.Client) *http.Client {
+	c := *client
+	c.Timeout = 0
+	return &c
+}
+
+// ProxyFunc parses a proxy URL. Supported schemes are http, https, socks5
+// and socks5h.
+func ProxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use http, https or socks5", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", proxy)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+func seconds(n int, fallback time.Duration) time.Duration {
+	if n <= 0 {
+		return fallback
+	}
+	return time.Duration(n) * time.Second
+}
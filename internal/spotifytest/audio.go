@@ -0,0 +1,80 @@
+package spotifytest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+
+	"github.com/Eyevinn/mp4ff/aac"
+	"github.com/Eyevinn/mp4ff/mp4"
+	"github.com/iyear/gowidevine/widevinepb"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	audioOnce sync.Once
+	audioData []byte
+)
+
+// Audio returns the fixture audio served by the CDN: a small, unencrypted
+// fragmented MP4 with a single AAC track. Decrypting it with any content key
+// leaves it unchanged.
+func Audio() []byte {
+	audioOnce.Do(func() {
+		audioData = buildAudio()
+	})
+	return audioData
+}
+
+func buildAudio() []byte {
+	init := mp4.CreateEmptyInit()
+	init.AddEmptyTrack(44100, "audio", "und")
+	if err := init.Moov.Trak.SetAACDescriptor(aac.AAClc, 44100); err != nil {
+		panic(err)
+	}
+
+	seg := mp4.NewMediaSegment()
+	frag, err := mp4.CreateFragment(1, mp4.DefaultTrakID)
+	if err != nil {
+		panic(err)
+	}
+	seg.AddFragment(frag)
+
+	payload := bytes.Repeat([]byte{0x21, 0x10, 0x04, 0x60, 0x8c, 0x1c}, 32)
+	for i := 0; i < 16; i++ {
+		frag.AddFullSample(mp4.FullSample{
+			Sample: mp4.Sample{
+				Flags: mp4.SyncSampleFlags,
+				Dur:   1024,
+				Size:  uint32(len(payload)),
+			},
+			DecodeTime: uint64(i * 1024),
+			Data:       payload,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := init.Encode(&buf); err != nil {
+		panic(err)
+	}
+	if err := seg.Encode(&buf); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// psshFor returns a base64 Widevine PSSH box for the given file, as served by
+// the seektable endpoint.
+func psshFor(fileID string) string {
+	keyID, _ := hex.DecodeString(fileID[:32])
+	data, _ := proto.Marshal(&widevinepb.WidevinePsshData{KeyIds: [][]byte{keyID}})
+	systemID, _ := mp4.NewUUIDFromString(mp4.UUIDWidevine)
+	box := &mp4.PsshBox{SystemID: systemID, Data: data}
+
+	var buf bytes.Buffer
+	if err := box.Encode(&buf); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
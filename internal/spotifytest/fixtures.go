@@ -0,0 +1,373 @@
+package spotifytest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const base62Charset = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+type Artist struct {
+	ID   string
+	Name string
+}
+
+type Track struct {
+	ID          string
+	Name        string
+	Artists     []Artist
+	AlbumID     string
+	TrackNumber int
+	DiscNumber  int
+	DurationMS  int
+	ISRC        string
+	Writers     []string
+	// Credits are listed after the performers and writers.
+	Credits []Credit
+	// Unavailable tracks have no audio files in their media manifest.
+	Unavailable bool
+}
+
+// Credit is a person credited for a track in a role such as "Producers".
+type Credit struct {
+	Role     string
+	Name     string
+	Subroles []string
+}
+
+type Album struct {
+	ID          string
+	Name        string
+	Type        string
+	Artists     []Artist
+	ReleaseDate string
+	Label       string
+	UPC         string
+	Genres      []string
+	CoverID     string
+	TrackIDs    []string
+}
+
+type Playlist struct {
+	ID   string
+	Name string
+	// TrackIDs may contain empty strings, which are served as null tracks the
+	// way the Web API reports local files.
+	TrackIDs []string
+}
+
+type Show struct {
+	ID          string
+	Name        string
+	Publisher   string
+	Description string
+	CoverID     string
+	EpisodeIDs  []string
+}
+
+type Episode struct {
+	ID          string
+	Name        string
+	ShowID      string
+	Description string
+	// ReleaseDate is an ISO 8601 timestamp.
+	ReleaseDate string
+	DurationMS  int
+	CoverID     string
+	Chapters    []Chapter
+}
+
+type Chapter struct {
+	Title   string
+	StartMS int
+}
+
+type Audiobook struct {
+	ID           string
+	Name         string
+	Authors      []string
+	Narrators    []string
+	Publisher    string
+	Series       string
+	SeriesNumber string
+	ReleaseDate  string
+	CoverID      string
+	ChapterIDs   []string
+}
+
+// BookChapter is a chapter of an audiobook.
+type BookChapter struct {
+	ID          string
+	Name        string
+	AudiobookID string
+	DurationMS  int
+}
+
+// Fixtures is the catalogue served by a Server. It is safe to modify between
+// requests.
+type Fixtures struct {
+	mu        sync.RWMutex
+	seq       int
+	Tracks    map[string]*Track
+	Albums    map[string]*Album
+	Playlists map[string]*Playlist
+	Shows     map[string]*Show
+	Episodes  map[string]*Episode
+
+	Audiobooks   map[string]*Audiobook
+	BookChapters map[string]*BookChapter
+}
+
+func NewFixtures() *Fixtures {
+	return &Fixtures{
+		Tracks:    make(map[string]*Track),
+		Albums:    make(map[string]*Album),
+		Playlists: make(map[string]*Playlist),
+		Shows:     make(map[string]*Show),
+		Episodes:  make(map[string]*Episode),
+
+		Audiobooks:   make(map[string]*Audiobook),
+		BookChapters: make(map[string]*BookChapter),
+	}
+}
+
+// NewID returns a new, deterministic base62 Spotify ID.
+func (f *Fixtures) NewID() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	return idFromSeed(fmt.Sprintf("spotifytest-%d", f.seq))
+}
+
+// AddAlbum adds an album by a single artist with n tracks.
+func (f *Fixtures) AddAlbum(name string, n int) *Album {
+	artist := Artist{ID: f.NewID(), Name: name + " Artist"}
+	album := &Album{
+		ID:          f.NewID(),
+		Name:        name,
+		Type:        "album",
+		Artists:     []Artist{artist},
+		ReleaseDate: "2024-01-02",
+		Label:       name + " Records",
+		UPC:         "000000000001",
+		Genres:      []string{"pop"},
+		CoverID:     hexFromSeed(name + "-cover"),
+	}
+	for i := 1; i <= n; i++ {
+		track := &Track{
+			ID:          f.NewID(),
+			Name:        fmt.Sprintf("%s Track %d", name, i),
+			Artists:     []Artist{artist},
+			AlbumID:     album.ID,
+			TrackNumber: i,
+			DiscNumber:  1,
+			DurationMS:  180000,
+			ISRC:        fmt.Sprintf("TEST%08d", i),
+			Writers:     []string{artist.Name},
+		}
+		album.TrackIDs = append(album.TrackIDs, track.ID)
+		f.mu.Lock()
+		f.Tracks[track.ID] = track
+		f.mu.Unlock()
+	}
+	f.mu.Lock()
+	f.Albums[album.ID] = album
+	f.mu.Unlock()
+	return album
+}
+
+// AddPlaylist adds a playlist with the given tracks.
+func (f *Fixtures) AddPlaylist(name string, trackIDs []string) *Playlist {
+	playlist := &Playlist{ID: f.NewID(), Name: name, TrackIDs: trackIDs}
+	f.mu.Lock()
+	f.Playlists[playlist.ID] = playlist
+	f.mu.Unlock()
+	return playlist
+}
+
+// AddShow adds a podcast show with n episodes.
+func (f *Fixtures) AddShow(name string, n int) *Show {
+	show := &Show{ID: f.NewID(), Name: name, Publisher: name + " Publisher", Description: "All about " + name + ".", CoverID: f.NewID()}
+	for i := 1; i <= n; i++ {
+		episode := &Episode{
+			ID:          f.NewID(),
+			Name:        fmt.Sprintf("%s Episode %d", name, i),
+			ShowID:      show.ID,
+			Description: fmt.Sprintf("In episode %d of %s, we talk about fixtures.", i, name),
+			ReleaseDate: fmt.Sprintf("2024-01-%02dT06:00:00Z", i),
+			DurationMS:  1800000 + i,
+			CoverID:     f.NewID(),
+		}
+		show.EpisodeIDs = append(show.EpisodeIDs, episode.ID)
+		f.mu.Lock()
+		f.Episodes[episode.ID] = episode
+		f.mu.Unlock()
+	}
+	f.mu.Lock()
+	f.Shows[show.ID] = show
+	f.mu.Unlock()
+	return show
+}
+
+// AddAudiobook adds an audiobook with n chapters.
+func (f *Fixtures) AddAudiobook(name string, n int) *Audiobook {
+	book := &Audiobook{
+		ID:           f.NewID(),
+		Name:         name,
+		Authors:      []string{name + " Author"},
+		Narrators:    []string{name + " Narrator", "Second Narrator"},
+		Publisher:    name + " Publisher",
+		Series:       name + " Series",
+		SeriesNumber: "1",
+		ReleaseDate:  "2023-05-06T00:00:00Z",
+		CoverID:      f.NewID(),
+	}
+	for i := 1; i <= n; i++ {
+		chapter := &BookChapter{
+			ID:          f.NewID(),
+			Name:        fmt.Sprintf("Chapter %d", i),
+			AudiobookID: book.ID,
+			DurationMS:  600000 + i,
+		}
+		book.ChapterIDs = append(book.ChapterIDs, chapter.ID)
+		f.mu.Lock()
+		f.BookChapters[chapter.ID] = chapter
+		f.mu.Unlock()
+	}
+	f.mu.Lock()
+	f.Audiobooks[book.ID] = book
+	f.mu.Unlock()
+	return book
+}
+
+func (f *Fixtures) track(id string) (*Track, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	t, ok := f.Tracks[id]
+	return t, ok
+}
+
+func (f *Fixtures) album(id string) (*Album, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	a, ok := f.Albums[id]
+	return a, ok
+}
+
+func (f *Fixtures) playlist(id string) (*Playlist, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	p, ok := f.Playlists[id]
+	return p, ok
+}
+
+func (f *Fixtures) show(id string) (*Show, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	s, ok := f.Shows[id]
+	return s, ok
+}
+
+func (f *Fixtures) episode(id string) (*Episode, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	e, ok := f.Episodes[id]
+	return e, ok
+}
+
+func (f *Fixtures) audiobook(id string) (*Audiobook, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	a, ok := f.Audiobooks[id]
+	return a, ok
+}
+
+func (f *Fixtures) bookChapter(id string) (*BookChapter, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	c, ok := f.BookChapters[id]
+	return c, ok
+}
+
+func (f *Fixtures) searchTracks(query string) []*Track {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	query = strings.ToLower(query)
+	var tracks []*Track
+	for _, t := range f.Tracks {
+		if isrc, ok := strings.CutPrefix(query, "isrc:"); ok {
+			if strings.EqualFold(t.ISRC, isrc) {
+				tracks = append(tracks, t)
+			}
+		} else if len(t.Artists) > 0 && strings.Contains(query, strings.ToLower(t.Name)) && strings.Contains(query, strings.ToLower(t.Artists[0].Name)) {
+			tracks = append(tracks, t)
+		}
+	}
+	slices.SortFunc(tracks, func(a, b *Track) int { return strings.Compare(a.ID, b.ID) })
+	return tracks
+}
+
+// trackByHex looks a track up by its metadata/4 hex GID.
+func (f *Fixtures) trackByHex(gid string) (*Track, bool) {
+	return f.track(hexToID(gid))
+}
+
+// FileID returns the audio file ID served for a track or episode.
+func FileID(id string) string {
+	return hexFromSeed("file-" + id)
+}
+
+func hexFromSeed(seed string) string {
+	sum := sha1.Sum([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+func idFromSeed(seed string) string {
+	sum := sha1.Sum([]byte(seed))
+	num := new(big.Int).SetBytes(sum[:16])
+	return bigToID(num)
+}
+
+func bigToID(num *big.Int) string {
+	base := big.NewInt(62)
+	num = new(big.Int).Set(num)
+	result := make([]byte, 0, 22)
+	for num.Sign() > 0 {
+		rem := new(big.Int)
+		num.DivMod(num, base, rem)
+		result = append([]byte{base62Charset[rem.Int64()]}, result...)
+	}
+	for len(result) < 22 {
+		result = append([]byte{'0'}, result...)
+	}
+	return string(result)
+}
+
+func idToHex(id string) string {
+	num := big.NewInt(0)
+	base := big.NewInt(62)
+	for i := 0; i < len(id); i++ {
+		idx := int64(0)
+		for j := 0; j < len(base62Charset); j++ {
+			if base62Charset[j] == id[i] {
+				idx = int64(j)
+				break
+			}
+		}
+		num.Mul(num, base).Add(num, big.NewInt(idx))
+	}
+	return fmt.Sprintf("%032s", hex.EncodeToString(num.Bytes()))
+}
+
+func hexToID(gid string) string {
+	b, err := hex.DecodeString(gid)
+	if err != nil {
+		return ""
+	}
+	return bigToID(new(big.Int).SetBytes(b))
+}
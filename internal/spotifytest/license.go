@@ -0,0 +1,123 @@
+package spotifytest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/chmike/cmac-go"
+	"github.com/iyear/gowidevine/widevinepb"
+	"google.golang.org/protobuf/proto"
+)
+
+// contentKey is the key handed out for every file. The fixture audio is not
+// encrypted, so its value does not matter.
+var contentKey = []byte("spotifytest-key!")
+
+// issueLicense answers a Widevine license challenge with a license holding a
+// single content key. The session key is wrapped with the public key from the
+// device certificate in the challenge, so the real CDM accepts the response.
+func issueLicense(challenge []byte) ([]byte, error) {
+	var signed widevinepb.SignedMessage
+	if err := proto.Unmarshal(challenge, &signed); err != nil {
+		return nil, fmt.Errorf("unmarshal challenge: %w", err)
+	}
+	var req widevinepb.LicenseRequest
+	if err := proto.Unmarshal(signed.Msg, &req); err != nil {
+		return nil, fmt.Errorf("unmarshal license request: %w", err)
+	}
+
+	var signedCert widevinepb.SignedDrmCertificate
+	if err := proto.Unmarshal(req.GetClientId().GetToken(), &signedCert); err != nil {
+		return nil, fmt.Errorf("unmarshal device certificate: %w", err)
+	}
+	var cert widevinepb.DrmCertificate
+	if err := proto.Unmarshal(signedCert.DrmCertificate, &cert); err != nil {
+		return nil, fmt.Errorf("unmarshal drm certificate: %w", err)
+	}
+	publicKey := &rsa.PublicKey{}
+	if _, err := asn1.Unmarshal(cert.PublicKey, publicKey); err != nil {
+		return nil, fmt.Errorf("parse device public key: %w", err)
+	}
+
+	sessionKey := make([]byte, 16)
+	_, _ = rand.Read(sessionKey)
+	wrappedSessionKey, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, publicKey, sessionKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrap session key: %w", err)
+	}
+
+	encKey, err := deriveKey(sessionKey, "\x01ENCRYPTION\x00", signed.Msg, 128)
+	if err != nil {
+		return nil, err
+	}
+	authKey1, err := deriveKey(sessionKey, "\x01AUTHENTICATION\x00", signed.Msg, 512)
+	if err != nil {
+		return nil, err
+	}
+	authKey2, err := deriveKey(sessionKey, "\x02AUTHENTICATION\x00", signed.Msg, 512)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, 16)
+	_, _ = rand.Read(iv)
+	block, _ := aes.NewCipher(encKey)
+	padded := pkcs7Pad(contentKey, aes.BlockSize)
+	encryptedKey := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encryptedKey, padded)
+
+	license := &widevinepb.License{
+		Key: []*widevinepb.License_KeyContainer{{
+			Id:   []byte("spotifytest"),
+			Iv:   iv,
+			Key:  encryptedKey,
+			Type: widevinepb.License_KeyContainer_CONTENT.Enum(),
+		}},
+	}
+	msg, err := proto.Marshal(license)
+	if err != nil {
+		return nil, fmt.Errorf("marshal license: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, append(authKey1, authKey2...))
+	mac.Write(msg)
+
+	return proto.Marshal(&widevinepb.SignedMessage{
+		Type:       widevinepb.SignedMessage_LICENSE.Enum(),
+		Msg:        msg,
+		Signature:  mac.Sum(nil),
+		SessionKey: wrappedSessionKey,
+	})
+}
+
+func deriveKey(sessionKey []byte, label string, context []byte, bits uint32) ([]byte, error) {
+	data := make([]byte, 0, len(label)+len(context)+4)
+	data = append(data, label...)
+	data = append(data, context...)
+	data = binary.BigEndian.AppendUint32(data, bits)
+
+	h, err := cmac.New(aes.NewCipher, sessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("create cmac: %w", err)
+	}
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	n := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data), len(data)+n)
+	copy(padded, data)
+	for i := 0; i < n; i++ {
+		padded = append(padded, byte(n))
+	}
+	return padded
+}
@@ -0,0 +1,730 @@
+// Package spotifytest provides a fake Spotify HTTP server for offline tests.
+//
+// A single httptest server stands in for the token endpoints, the Web API,
+// spclient, pathfinder, the seektable and image hosts and the audio CDN. Its
+// Endpoints can be passed straight to spotify.NewDownloader.
+package spotifytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/config"
+)
+
+const (
+	AccessToken = "spotifytest-access-token"
+	ClientToken = "spotifytest-client-token"
+	ClientID    = "spotifytest-client-id"
+)
+
+type Server struct {
+	*httptest.Server
+	Fixtures *Fixtures
+	// MaxPageSize, if set, caps the number of items in every paging object
+	// below the requested limit, like the real Web API sometimes does.
+	MaxPageSize int
+	// RepeatPages, if set, makes every paging object name its own page as
+	// next, like a misbehaving server that never moves on.
+	RepeatPages bool
+	// ExtraClientBases are returned by apresolve ahead of the server itself.
+	ExtraClientBases []string
+	// ExtraCDNs are base URLs whose /cdn/audio/{fileID} URLs storage-resolve
+	// returns ahead of the server's own.
+	ExtraCDNs []string
+
+	mu         sync.Mutex
+	hits       map[string]int
+	throttled  int
+	retryAfter string
+}
+
+// NewServer starts a fake Spotify server serving the given fixtures. The
+// caller must Close it.
+func NewServer(fixtures *Fixtures) *Server {
+	s := &Server{
+		Fixtures: fixtures,
+		hits:     make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	s.handle(mux, "GET /api/server-time", "server-time", false, s.serverTime)
+	s.handle(mux, "GET /api/token", "token", false, s.token)
+	s.handle(mux, "POST /v1/clienttoken", "clienttoken", false, s.clientToken)
+	s.handle(mux, "GET /apresolve", "apresolve", false, s.apResolve)
+
+	s.handle(mux, "GET /v1/tracks", "web-tracks", true, s.webTracks)
+	s.handle(mux, "GET /v1/tracks/{id}", "web-track", true, s.webTrack)
+	s.handle(mux, "GET /v1/search", "web-search", true, s.webSearch)
+	s.handle(mux, "GET /v1/albums", "web-albums", true, s.webAlbums)
+	s.handle(mux, "GET /v1/albums/{id}", "web-album", true, s.webAlbum)
+	s.handle(mux, "GET /v1/albums/{id}/tracks", "web-album-tracks", true, s.webAlbumTracks)
+	s.handle(mux, "GET /v1/playlists/{id}/tracks", "web-playlist-tracks", true, s.webPlaylistTracks)
+	s.handle(mux, "GET /v1/shows/{id}/episodes", "web-show-episodes", true, s.webShowEpisodes)
+	s.handle(mux, "GET /v1/audiobooks/{id}/chapters", "web-audiobook-chapters", true, s.webAudiobookChapters)
+
+	s.handle(mux, "GET /metadata/4/track/{gid}", "metadata", true, s.metadata)
+	s.handle(mux, "GET /track-credits-view/v0/experimental/{id}/credits", "credits", true, s.credits)
+	s.handle(mux, "GET /track-playback/v1/media/{uri}", "manifest", true, s.manifest)
+	s.handle(mux, "GET /storage-resolve/files/audio/interactive/{fileID}", "storage-resolve", true, s.storageResolve)
+	s.handle(mux, "POST /widevine-license/v1/audio/license", "license", true, s.license)
+	s.handle(mux, "GET /pathfinder/v1/query", "pathfinder", true, s.pathfinder)
+
+	s.handle(mux, "GET /seektable/{file}", "seektable", false, s.seektable)
+	s.handle(mux, "GET /image/{id}", "image", false, s.image)
+	s.handle(mux, "GET /cdn/audio/{fileID}", "cdn", false, s.cdn)
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Endpoints returns endpoints pointing every Spotify service at the server.
+func (s *Server) Endpoints() config.Endpoints {
+	return config.Endpoints{
+		WebAPI:       s.URL,
+		SpClient:     s.URL,
+		ClientBase:   s.URL,
+		Pathfinder:   s.URL + "/pathfinder/v1/query",
+		SeekTables:   s.URL,
+		Images:       s.URL,
+		APResolve:    s.URL + "/apresolve",
+		SessionToken: s.URL + "/api/token",
+		ServerTime:   s.URL + "/api/server-time",
+		ClientToken:  s.URL + "/v1/clienttoken",
+	}
+}
+
+// Hits returns how many requests a route has served, e.g. "web-track".
+func (s *Server) Hits(route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[route]
+}
+
+// ResetHits clears all request counters.
+func (s *Server) ResetHits() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hits = make(map[string]int)
+}
+
+func (s *Server) handle(mux *http.ServeMux, pattern, route string, auth bool, h http.HandlerFunc) {
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits[route]++
+		s.mu.Unlock()
+
+		if auth && r.Header.Get("Authorization") != "Bearer "+AccessToken {
+			http.Error(w, "invalid access token", http.StatusUnauthorized)
+			return
+		}
+		if auth {
+			if retryAfter, ok := s.takeThrottle(); ok {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		h(w, r)
+	})
+}
+
+// Throttle answers the next n authenticated requests with 429 Too Many
+// Requests and no Retry-After header.
+func (s *Server) Throttle(n int) {
+	s.ThrottleRetryAfter(n, 0)
+}
+
+// ThrottleRetryAfter answers the next n authenticated requests with 429 Too
+// Many Requests and a Retry-After of the given seconds, if not zero.
+func (s *Server) ThrottleRetryAfter(n, seconds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttled = n
+	s.retryAfter = ""
+	if seconds > 0 {
+		s.retryAfter = strconv.Itoa(seconds)
+	}
+}
+
+func (s *Server) takeThrottle() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.throttled == 0 {
+		return "", false
+	}
+	s.throttled--
+	return s.retryAfter, true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) serverTime(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{"serverTime": time.Now().Unix()})
+}
+
+func (s *Server) token(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"clientId":                         ClientID,
+		"accessToken":                      AccessToken,
+		"accessTokenExpirationTimestampMs": time.Now().Add(time.Hour).UnixMilli(),
+		"isAnonymous":                      false,
+	})
+}
+
+func (s *Server) clientToken(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"response_type": "RESPONSE_GRANTED_TOKEN_RESPONSE",
+		"granted_token": map[string]any{
+			"token":                 ClientToken,
+			"expires_after_seconds": 3600,
+			"refresh_after_seconds": 1800,
+		},
+	})
+}
+
+func (s *Server) apResolve(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{"spclient": append(slices.Clone(s.ExtraClientBases), s.URL)})
+}
+
+func artistsJSON(artists []Artist) []map[string]any {
+	out := make([]map[string]any, 0, len(artists))
+	for _, a := range artists {
+		out = append(out, map[string]any{
+			"id":            a.ID,
+			"name":          a.Name,
+			"external_urls": map[string]string{"spotify": "https://open.spotify.com/artist/" + a.ID},
+		})
+	}
+	return out
+}
+
+func (s *Server) albumJSON(a *Album) map[string]any {
+	return map[string]any{
+		"id":                     a.ID,
+		"name":                   a.Name,
+		"album_type":             a.Type,
+		"total_tracks":           len(a.TrackIDs),
+		"release_date":           a.ReleaseDate,
+		"release_date_precision": "day",
+		"artists":                artistsJSON(a.Artists),
+		"images": []map[string]any{
+			{"url": s.URL + "/image/" + a.CoverID, "width": 640, "height": 640},
+		},
+		"copyrights": []map[string]string{
+			{"text": "(P) 2024 " + a.Label, "type": "P"},
+		},
+		"external_ids":  map[string]string{"upc": a.UPC},
+		"genres":        a.Genres,
+		"label":         a.Label,
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/album/" + a.ID},
+	}
+}
+
+func (s *Server) trackJSON(t *Track) map[string]any {
+	out := map[string]any{
+		"id":            t.ID,
+		"name":          t.Name,
+		"artists":       artistsJSON(t.Artists),
+		"duration_ms":   t.DurationMS,
+		"track_number":  t.TrackNumber,
+		"disc_number":   t.DiscNumber,
+		"external_ids":  map[string]string{"isrc": t.ISRC},
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/track/" + t.ID},
+	}
+	if album, ok := s.Fixtures.album(t.AlbumID); ok {
+		out["album"] = s.albumJSON(album)
+	}
+	return out
+}
+
+func (s *Server) webTrack(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.Fixtures.track(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, s.trackJSON(t))
+}
+
+func (s *Server) webAlbum(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.Fixtures.album(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, s.fullAlbumJSON(a))
+}
+
+// fullAlbumJSON is an album with the first page of its tracks, as returned
+// for album lookups.
+func (s *Server) fullAlbumJSON(a *Album) map[string]any {
+	out := s.albumJSON(a)
+	ids := a.TrackIDs[:min(len(a.TrackIDs), 50)]
+	items := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		if t, ok := s.Fixtures.track(id); ok {
+			items = append(items, map[string]any{"id": t.ID, "track_number": t.TrackNumber, "disc_number": t.DiscNumber})
+		}
+	}
+	var next any
+	if len(a.TrackIDs) > len(ids) {
+		next = fmt.Sprintf("%s/v1/albums/%s/tracks?offset=%d&limit=50", s.URL, a.ID, len(ids))
+	}
+	out["tracks"] = map[string]any{"items": items, "total": len(a.TrackIDs), "offset": 0, "limit": 50, "next": next}
+	return out
+}
+
+// ids splits the ids query parameter, rejecting requests over the Web API
+// limit like the real service does.
+func ids(w http.ResponseWriter, r *http.Request, limit int) ([]string, bool) {
+	list := strings.Split(r.URL.Query().Get("ids"), ",")
+	if r.URL.Query().Get("ids") == "" || len(list) > limit {
+		http.Error(w, "invalid ids", http.StatusBadRequest)
+		return nil, false
+	}
+	return list, true
+}
+
+func (s *Server) webTracks(w http.ResponseWriter, r *http.Request) {
+	list, ok := ids(w, r, 50)
+	if !ok {
+		return
+	}
+	tracks := make([]any, len(list))
+	for i, id := range list {
+		if t, ok := s.Fixtures.track(id); ok {
+			tracks[i] = s.trackJSON(t)
+		}
+	}
+	writeJSON(w, map[string]any{"tracks": tracks})
+}
+
+// webSearch searches tracks by an isrc: filter, or by their name and first
+// artist both appearing in the query.
+func (s *Server) webSearch(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("type") != "track" {
+		http.Error(w, "unsupported search type", http.StatusBadRequest)
+		return
+	}
+	tracks := s.Fixtures.searchTracks(r.URL.Query().Get("q"))
+	writeJSON(w, map[string]any{"tracks": page(s, r, tracks, 50, func(t *Track) any { return s.trackJSON(t) })})
+}
+
+func (s *Server) webAlbums(w http.ResponseWriter, r *http.Request) {
+	list, ok := ids(w, r, 20)
+	if !ok {
+		return
+	}
+	albums := make([]any, len(list))
+	for i, id := range list {
+		if a, ok := s.Fixtures.album(id); ok {
+			albums[i] = s.fullAlbumJSON(a)
+		}
+	}
+	writeJSON(w, map[string]any{"albums": albums})
+}
+
+func (s *Server) pageLimit(limit int) int {
+	if s.MaxPageSize > 0 {
+		return min(limit, s.MaxPageSize)
+	}
+	return limit
+}
+
+// page slices items according to the offset and limit query parameters and
+// wraps them in a Web API paging object.
+func page[T any](s *Server, r *http.Request, items []T, maxLimit int, render func(T) any) map[string]any {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	limit = min(limit, maxLimit)
+	offset = max(0, min(offset, len(items)))
+	end := min(offset+limit, len(items))
+
+	rendered := make([]any, 0, end-offset)
+	for _, item := range items[offset:end] {
+		rendered = append(rendered, render(item))
+	}
+
+	var next any
+	if end < len(items) {
+		u := *r.URL
+		u.Scheme = "http"
+		u.Host = r.Host
+		q := u.Query()
+		q.Set("offset", strconv.Itoa(end))
+		if s.RepeatPages {
+			q.Set("offset", strconv.Itoa(offset))
+		}
+		q.Set("limit", strconv.Itoa(limit))
+		u.RawQuery = q.Encode()
+		next = u.String()
+	}
+
+	return map[string]any{
+		"items":  rendered,
+		"total":  len(items),
+		"offset": offset,
+		"limit":  limit,
+		"next":   next,
+	}
+}
+
+func (s *Server) webAlbumTracks(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.Fixtures.album(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, page(s, r, a.TrackIDs, s.pageLimit(50), func(id string) any {
+		if t, ok := s.Fixtures.track(id); ok {
+			return s.trackJSON(t)
+		}
+		return map[string]any{"id": id}
+	}))
+}
+
+func (s *Server) webPlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.Fixtures.playlist(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, page(s, r, p.TrackIDs, s.pageLimit(100), func(id string) any {
+		if t, ok := s.Fixtures.track(id); ok {
+			return map[string]any{"track": s.trackJSON(t)}
+		}
+		return map[string]any{"track": nil}
+	}))
+}
+
+func (s *Server) webShowEpisodes(w http.ResponseWriter, r *http.Request) {
+	show, ok := s.Fixtures.show(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, page(s, r, show.EpisodeIDs, s.pageLimit(50), func(id string) any {
+		name := ""
+		if e, ok := s.Fixtures.episode(id); ok {
+			name = e.Name
+		}
+		return map[string]any{"id": id, "name": name}
+	}))
+}
+
+func (s *Server) webAudiobookChapters(w http.ResponseWriter, r *http.Request) {
+	book, ok := s.Fixtures.audiobook(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, page(s, r, book.ChapterIDs, s.pageLimit(50), func(id string) any {
+		item := map[string]any{"id": id, "chapter_number": slices.Index(book.ChapterIDs, id)}
+		if c, ok := s.Fixtures.bookChapter(id); ok {
+			item["name"] = c.Name
+		}
+		return item
+	}))
+}
+
+func (s *Server) metadata(w http.ResponseWriter, r *http.Request) {
+	gid := r.PathValue("gid")
+	t, ok := s.Fixtures.trackByHex(gid)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	artists := make([]map[string]any, 0, len(t.Artists))
+	for _, a := range t.Artists {
+		artists = append(artists, map[string]any{"gid": idToHex(a.ID), "name": a.Name})
+	}
+	album := map[string]any{}
+	if a, ok := s.Fixtures.album(t.AlbumID); ok {
+		albumArtists := make([]map[string]any, 0, len(a.Artists))
+		for _, ar := range a.Artists {
+			albumArtists = append(albumArtists, map[string]any{"gid": idToHex(ar.ID), "name": ar.Name})
+		}
+		album = map[string]any{
+			"gid":    idToHex(a.ID),
+			"name":   a.Name,
+			"artist": albumArtists,
+			"cover_group": map[string]any{
+				"image": []map[string]any{
+					{"file_id": a.CoverID, "size": "LARGE", "width": 640, "height": 640},
+				},
+			},
+		}
+	}
+	writeJSON(w, map[string]any{
+		"gid":           gid,
+		"name":          t.Name,
+		"album":         album,
+		"artist":        artists,
+		"canonical_uri": "spotify:track:" + t.ID,
+		"number":        t.TrackNumber,
+		"disc_number":   t.DiscNumber,
+	})
+}
+
+func (s *Server) credits(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.Fixtures.track(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writers := make([]map[string]any, 0, len(t.Writers))
+	for _, name := range t.Writers {
+		writers = append(writers, map[string]any{"name": name})
+	}
+	roles := []map[string]any{
+		{"roleTitle": "Performers", "artists": artistsJSON(t.Artists)},
+		{"roleTitle": "Writers", "artists": writers},
+	}
+	for _, c := range t.Credits {
+		artist := map[string]any{"name": c.Name, "subroles": c.Subroles}
+		i := slices.IndexFunc(roles, func(r map[string]any) bool { return r["roleTitle"] == c.Role })
+		if i < 0 {
+			roles = append(roles, map[string]any{"roleTitle": c.Role, "artists": []map[string]any{}})
+			i = len(roles) - 1
+		}
+		roles[i]["artists"] = append(roles[i]["artists"].([]map[string]any), artist)
+	}
+	writeJSON(w, map[string]any{
+		"trackTitle":  t.Name,
+		"roleCredits": roles,
+		"sourceNames": []string{"spotifytest"},
+	})
+}
+
+func (s *Server) manifest(w http.ResponseWriter, r *http.Request) {
+	uri := r.PathValue("uri")
+	parts := strings.Split(uri, ":")
+	if len(parts) != 3 {
+		http.Error(w, "invalid uri", http.StatusBadRequest)
+		return
+	}
+	t, ok := s.Fixtures.track(parts[2])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	files := []map[string]any{}
+	if !t.Unavailable {
+		files = append(files,
+			map[string]any{"bitrate": 128000, "file_id": FileID(t.ID)},
+			map[string]any{"bitrate": 256000, "file_id": FileID(t.ID + "-256")},
+		)
+	}
+	writeJSON(w, map[string]any{
+		"media": map[string]any{
+			uri: map[string]any{
+				"item": map[string]any{
+					"metadata": map[string]any{"uri": uri},
+					"manifest": map[string]any{"file_ids_mp4": files},
+				},
+			},
+		},
+	})
+}
+
+func (s *Server) storageResolve(w http.ResponseWriter, r *http.Request) {
+	fileID := r.PathValue("fileID")
+	var urls []string
+	for _, base := range append(slices.Clone(s.ExtraCDNs), s.URL) {
+		urls = append(urls, base+"/cdn/audio/"+fileID+"?token=spotifytest")
+	}
+	writeJSON(w, map[string]any{
+		"result": "CDN",
+		"cdnurl": urls,
+		"fileid": fileID,
+		"ttl":    86400,
+	})
+}
+
+func (s *Server) license(w http.ResponseWriter, r *http.Request) {
+	challenge, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	license, err := issueLicense(challenge)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, _ = w.Write(license)
+}
+
+func (s *Server) pathfinder(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("operationName") != "getEpisodeOrChapter" {
+		http.Error(w, "unknown operation", http.StatusBadRequest)
+		return
+	}
+	var variables struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal([]byte(query.Get("variables")), &variables); err != nil {
+		http.Error(w, "invalid variables", http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(variables.URI, ":")
+	if len(parts) == 3 && parts[1] == "chapter" {
+		s.pathfinderChapter(w, r, parts[2])
+		return
+	}
+	e, ok := s.Fixtures.episode(parts[len(parts)-1])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	showName, publisher, showDescription, showCover := "", "", "", ""
+	if show, ok := s.Fixtures.show(e.ShowID); ok {
+		showName, publisher, showDescription, showCover = show.Name, show.Publisher, show.Description, show.CoverID
+	}
+	coverArt := s.coverArt(e.CoverID)
+	chapters := []map[string]any{}
+	for _, c := range e.Chapters {
+		chapters = append(chapters, map[string]any{
+			"title":     c.Title,
+			"startTime": map[string]any{"totalMilliseconds": c.StartMS},
+		})
+	}
+	writeJSON(w, map[string]any{
+		"data": map[string]any{
+			"episodeUnionV2": map[string]any{
+				"name":        e.Name,
+				"chapters":    map[string]any{"items": chapters},
+				"uri":         "spotify:episode:" + e.ID,
+				"description": e.Description,
+				"releaseDate": map[string]any{"isoString": e.ReleaseDate, "precision": "DAY"},
+				"duration":    map[string]any{"totalMilliseconds": e.DurationMS},
+				"coverArt":    map[string]any{"sources": coverArt},
+				"audio": map[string]any{
+					"items": []map[string]any{
+						{"format": "MP4_128", "fileId": FileID(e.ID)},
+					},
+				},
+				"podcastV2": map[string]any{
+					"data": map[string]any{
+						"name":        showName,
+						"uri":         "spotify:show:" + e.ShowID,
+						"description": showDescription,
+						"publisher":   map[string]any{"name": publisher},
+						"coverArt":    map[string]any{"sources": s.coverArt(showCover)},
+					},
+				},
+			},
+		},
+	})
+}
+
+// pathfinderChapter answers getEpisodeOrChapter for an audiobook chapter.
+func (s *Server) pathfinderChapter(w http.ResponseWriter, r *http.Request, id string) {
+	c, ok := s.Fixtures.bookChapter(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	book, _ := s.Fixtures.audiobook(c.AudiobookID)
+	names := func(list []string) []map[string]any {
+		out := []map[string]any{}
+		for _, name := range list {
+			out = append(out, map[string]any{"name": name})
+		}
+		return out
+	}
+	writeJSON(w, map[string]any{
+		"data": map[string]any{
+			"episodeUnionV2": map[string]any{
+				"__typename":    "Chapter",
+				"name":          c.Name,
+				"uri":           "spotify:chapter:" + c.ID,
+				"duration":      map[string]any{"totalMilliseconds": c.DurationMS},
+				"chapterNumber": slices.Index(book.ChapterIDs, c.ID),
+				"audio": map[string]any{
+					"items": []map[string]any{
+						{"format": "MP4_128", "fileId": FileID(c.ID)},
+					},
+				},
+				"audiobookV2": map[string]any{
+					"data": map[string]any{
+						"name":        book.Name,
+						"uri":         "spotify:audiobook:" + book.ID,
+						"authors":     names(book.Authors),
+						"narrators":   names(book.Narrators),
+						"publisher":   map[string]any{"name": book.Publisher},
+						"series":      []map[string]any{{"name": book.Series, "number": book.SeriesNumber}},
+						"releaseDate": map[string]any{"isoString": book.ReleaseDate},
+						"chapters":    map[string]any{"totalCount": len(book.ChapterIDs)},
+						"coverArt":    map[string]any{"sources": s.coverArt(book.CoverID)},
+					},
+				},
+			},
+		},
+	})
+}
+
+// coverArt returns pathfinder image sources of an image in three sizes.
+func (s *Server) coverArt(id string) []map[string]any {
+	var sources []map[string]any
+	if id != "" {
+		for _, size := range []int{64, 640, 300} {
+			sources = append(sources, map[string]any{
+				"url":    fmt.Sprintf("%s/image/%s%d", s.URL, id, size),
+				"width":  size,
+				"height": size,
+			})
+		}
+	}
+	return sources
+}
+
+func (s *Server) seektable(w http.ResponseWriter, r *http.Request) {
+	fileID := strings.TrimSuffix(r.PathValue("file"), ".json")
+	if len(fileID) < 32 {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, map[string]any{"pssh": psshFor(fileID)})
+}
+
+func (s *Server) image(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/jpeg")
+	// A JPEG SOI marker followed by padding is enough for content sniffing.
+	_, _ = w.Write(append([]byte{0xff, 0xd8, 0xff, 0xe0}, make([]byte, 60)...))
+}
+
+func (s *Server) cdn(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("token") == "" {
+		http.Error(w, "missing token", http.StatusForbidden)
+		return
+	}
+	http.ServeContent(w, r, r.PathValue("fileID")+".mp4", time.Time{}, strings.NewReader(string(Audio())))
+}
+
+// URL returns the open.spotify.com URL for an item, e.g. URL("album", id).
+func URL(kind, id string) string {
+	return fmt.Sprintf("https://open.spotify.com/%s/%s", kind, url.PathEscape(id))
+}
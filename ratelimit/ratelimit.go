@@ -0,0 +1,158 @@
+// Package ratelimit spaces out API requests with a token bucket per host
+// that slows down when the server answers 429 Too Many Requests.
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/XiaoMengXinX/spotdl/logger"
+)
+
+const (
+	// A 429 halves the request rate down to this fraction of the
+	// configured rate.
+	minRateFraction = 1.0 / 16
+	// Every successful request recovers the rate by this factor.
+	recoveryFactor = 1.05
+	// defaultBackoff is used when a 429 has no Retry-After header.
+	defaultBackoff = time.Second
+)
+
+// Rate allows PerSecond requests per second on average, with bursts of up to
+// Burst requests. A zero PerSecond means unlimited.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+type bucket struct {
+	rate    Rate
+	current float64
+	tokens  float64
+	// last is when tokens was last refilled. It lies in the future while
+	// the host is blocked after a 429.
+	last time.Time
+}
+
+type Limiter struct {
+	mu       sync.Mutex
+	defaults Rate
+	hosts    map[string]Rate
+	buckets  map[string]*bucket
+	now      func() time.Time
+}
+
+// New returns a limiter applying rate to every host except those listed in
+// hosts, which get their own rate.
+func New(rate Rate, hosts map[string]Rate) *Limiter {
+	return &Limiter{
+		defaults: rate,
+		hosts:    hosts,
+		buckets:  make(map[string]*bucket),
+		now:      time.Now,
+	}
+}
+
+func (l *Limiter) bucket(host string) *bucket {
+	b, ok := l.buckets[host]
+	if !ok {
+		rate, ok := l.hosts[host]
+		if !ok {
+			rate = l.defaults
+		}
+		rate.Burst = max(rate.Burst, 1)
+		b = &bucket{rate: rate, current: rate.PerSecond, tokens: float64(rate.Burst), last: l.now()}
+		l.buckets[host] = b
+	}
+	return b
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = min(float64(b.rate.Burst), b.tokens+now.Sub(b.last).Seconds()*b.current)
+		b.last = now
+	}
+}
+
+// Wait blocks until a request to host is allowed or ctx is done. Hosts
+// without a rate limit are still paused after a 429.
+func (l *Limiter) Wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	b := l.bucket(host)
+	now := l.now()
+	if b.rate.PerSecond > 0 {
+		b.refill(now)
+		b.tokens--
+	}
+	wait := b.last.Sub(now)
+	if b.tokens < 0 {
+		wait += time.Duration(-b.tokens / b.current * float64(time.Second))
+	}
+	if wait > 0 {
+		log.Debugf("Rate limiter [%s]: waiting %v (%.2f/%.2f req/s, %.2f tokens)", host, wait.Round(time.Millisecond), b.current, b.rate.PerSecond, b.tokens)
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff records a 429 from host: requests are blocked for retryAfter and
+// the rate is halved.
+func (l *Limiter) Backoff(host string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(host)
+	if retryAfter <= 0 {
+		retryAfter = defaultBackoff
+	}
+	if b.rate.PerSecond > 0 {
+		b.current = max(b.current/2, b.rate.PerSecond*minRateFraction)
+	}
+	b.tokens = 0
+	b.last = l.now().Add(retryAfter)
+	log.Debugf("Rate limiter [%s]: 429 received, pausing %v, rate lowered to %.2f/%.2f req/s", host, retryAfter, b.current, b.rate.PerSecond)
+}
+
+// Success records a successful request to host, recovering the rate.
+func (l *Limiter) Success(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(host)
+	if b.current >= b.rate.PerSecond {
+		return
+	}
+	b.current = min(b.rate.PerSecond, b.current*recoveryFactor)
+	if b.current == b.rate.PerSecond {
+		log.Debugf("Rate limiter [%s]: recovered to %.2f req/s", host, b.current)
+	}
+}
+
+// RetryAfter parses the Retry-After header of resp, given in seconds or as
+// an HTTP date. It returns 0 if the header is absent or invalid.
+func RetryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func waitN(t *testing.T, l *Limiter, host string, n int) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for range n {
+		if err := l.Wait(context.Background(), host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return time.Since(start)
+}
+
+func TestLimiterBurstAndRate(t *testing.T) {
+	l := New(Rate{PerSecond: 20, Burst: 2}, map[string]Rate{"fast": {}})
+
+	if elapsed := waitN(t, l, "api", 2); elapsed > 20*time.Millisecond {
+		t.Errorf("burst of 2 took %v, want no wait", elapsed)
+	}
+	// Four more requests at 20/s.
+	if elapsed := waitN(t, l, "api", 4); elapsed < 180*time.Millisecond {
+		t.Errorf("4 requests at 20/s took %v, want about 200ms", elapsed)
+	}
+	// Hosts have separate buckets, and a zero rate is unlimited.
+	if elapsed := waitN(t, l, "other", 2); elapsed > 20*time.Millisecond {
+		t.Errorf("burst on another host took %v, want no wait", elapsed)
+	}
+	if elapsed := waitN(t, l, "fast", 100); elapsed > 20*time.Millisecond {
+		t.Errorf("unlimited host took %v", elapsed)
+	}
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	l := New(Rate{PerSecond: 100, Burst: 10}, nil)
+	waitN(t, l, "api", 1)
+
+	l.Backoff("api", 100*time.Millisecond)
+	if got := l.buckets["api"].current; got != 50 {
+		t.Errorf("rate after 429 = %v, want 50", got)
+	}
+	if elapsed := waitN(t, l, "api", 1); elapsed < 90*time.Millisecond {
+		t.Errorf("request after Retry-After of 100ms went out after %v", elapsed)
+	}
+
+	for range 5 {
+		l.Backoff("api", time.Millisecond)
+	}
+	if got := l.buckets["api"].current; got != 100*minRateFraction {
+		t.Errorf("rate after repeated 429s = %v, want floor %v", got, 100*minRateFraction)
+	}
+	for range 100 {
+		l.Success("api")
+	}
+	if got := l.buckets["api"].current; got != 100 {
+		t.Errorf("rate after recovery = %v, want 100", got)
+	}
+}
+
+func TestLimiterBackoffUnlimited(t *testing.T) {
+	l := New(Rate{}, nil)
+	l.Backoff("api", 100*time.Millisecond)
+	if elapsed := waitN(t, l, "api", 1); elapsed < 90*time.Millisecond {
+		t.Errorf("unlimited request after Retry-After of 100ms went out after %v", elapsed)
+	}
+	if elapsed := waitN(t, l, "api", 100); elapsed > 20*time.Millisecond {
+		t.Errorf("unlimited requests after the pause took %v", elapsed)
+	}
+}
+
+func TestLimiterWaitCancel(t *testing.T) {
+	l := New(Rate{PerSecond: 1, Burst: 1}, nil)
+	waitN(t, l, "api", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "api"); err == nil {
+		t.Error("Wait on a cancelled context succeeded")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	if got := RetryAfter(resp); got != 0 {
+		t.Errorf("RetryAfter without header = %v", got)
+	}
+	resp.Header.Set("Retry-After", "3")
+	if got := RetryAfter(resp); got != 3*time.Second {
+		t.Errorf("RetryAfter(3) = %v", got)
+	}
+	resp.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if got := RetryAfter(resp); got < 58*time.Second || got > time.Minute {
+		t.Errorf("RetryAfter(date) = %v, want about 1m", got)
+	}
+}
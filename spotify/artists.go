@@ -0,0 +1,77 @@
+package spotify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// File name artist modes for the {artist} template variable.
+const (
+	FileArtistFirst = "first"
+	FileArtistAll   = "all"
+	FileArtistAlbum = "album"
+)
+
+// multiValueSeparator separates the values of multi-value tags such as
+// ARTISTS in metadata maps. Each container writer splits them again.
+const multiValueSeparator = "\x00"
+
+// multiValueTags are the tags that may hold several values.
+var multiValueTags = []string{"ARTISTS", "SPOTIFY_ARTIST_ID"}
+
+func validateArtists(fileName string) error {
+	switch fileName {
+	case "", FileArtistFirst, FileArtistAll, FileArtistAlbum:
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid file name artist, use first, all or album", fileName)
+	}
+}
+
+func artistNames(artists []artistData) []string {
+	names := make([]string, len(artists))
+	for i, ar := range artists {
+		names[i] = ar.Name
+	}
+	return names
+}
+
+func artistIDs(artists []artistData) []string {
+	ids := make([]string, 0, len(artists))
+	for _, ar := range artists {
+		if ar.ID != "" {
+			ids = append(ids, ar.ID)
+		}
+	}
+	return ids
+}
+
+// formatArtists joins artist names into a display string. With feat, the
+// featured artists follow the first after the configured word, e.g.
+// "A feat. B, C".
+func (d *Downloader) formatArtists(names []string, feat bool) string {
+	separator := d.output.Artists.Separator
+	if separator == "" {
+		separator = ", "
+	}
+	if word := d.output.Artists.Feat; feat && word != "" && len(names) > 1 {
+		return fmt.Sprintf("%s %s %s", names[0], word, strings.Join(names[1:], separator))
+	}
+	return strings.Join(names, separator)
+}
+
+// fileArtist returns the artist used in paths of a track.
+func (d *Downloader) fileArtist(metadata trackMetadata) string {
+	switch d.output.Artists.FileName {
+	case FileArtistAll:
+		return d.formatArtists(artistNames(metadata.Artists), true)
+	case FileArtistAlbum:
+		if len(metadata.Album.Artists) > 0 {
+			return d.formatArtists(artistNames(metadata.Album.Artists), false)
+		}
+	}
+	if len(metadata.Artists) == 0 {
+		return ""
+	}
+	return metadata.Artists[0].Name
+}
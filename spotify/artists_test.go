@@ -0,0 +1,54 @@
+package spotify_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+)
+
+func TestMultipleArtists(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Duets", 1)
+	track := fixtures.Tracks[album.TrackIDs[0]]
+	track.Artists = append(track.Artists, spotifytest.Artist{ID: fixtures.NewID(), Name: "Guest, Jr."}, spotifytest.Artist{ID: fixtures.NewID(), Name: "Third"})
+	lead := track.Artists[0].Name
+
+	for _, tt := range []struct {
+		artists    map[string]any
+		artist     string
+		fileArtist string
+	}{
+		{nil, lead + ", Guest, Jr., Third", lead},
+		{map[string]any{"separator": " & ", "feat": "feat.", "fileName": "all"}, lead + " feat. Guest, Jr. & Third", lead + " feat. Guest, Jr. & Third"},
+		{map[string]any{"fileName": "album"}, lead + ", Guest, Jr., Third", album.Artists[0].Name},
+	} {
+		d, out := newTestDownloader(t, srv, map[string]any{
+			"output": map[string]any{"template": "{artist}/{title}", "artists": tt.artists},
+		})
+		tags, err := d.TrackTags(track.ID)
+		if err != nil {
+			t.Fatalf("TrackTags: %v", err)
+		}
+		if tags["artist"] != tt.artist {
+			t.Errorf("artist = %q, want %q", tags["artist"], tt.artist)
+		}
+		if want := lead + "\x00Guest, Jr.\x00Third"; tags["ARTISTS"] != want {
+			t.Errorf("ARTISTS = %q, want %q", tags["ARTISTS"], want)
+		}
+		if want := track.Artists[0].ID + "\x00" + track.Artists[1].ID + "\x00" + track.Artists[2].ID; tags["SPOTIFY_ARTIST_ID"] != want {
+			t.Errorf("SPOTIFY_ARTIST_ID = %q, want %q", tags["SPOTIFY_ARTIST_ID"], want)
+		}
+		if tags["SPOTIFY_TRACK_ID"] != track.ID || tags["SPOTIFY_ALBUM_ID"] != album.ID || tags["SPOTIFY_URI"] != "spotify:track:"+track.ID {
+			t.Errorf("Spotify IDs = %q, %q, %q, want %s, %s and its URI", tags["SPOTIFY_TRACK_ID"], tags["SPOTIFY_ALBUM_ID"], tags["SPOTIFY_URI"], track.ID, album.ID)
+		}
+
+		path, err := d.DownloadTrack(track.ID)
+		if err != nil {
+			t.Fatalf("DownloadTrack: %v", err)
+		}
+		if want := filepath.Join(out, tt.fileArtist, track.Name+".m4a"); path != want {
+			t.Errorf("path = %s, want %s", path, want)
+		}
+	}
+}
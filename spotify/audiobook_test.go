@@ -0,0 +1,67 @@
+package spotify_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+	"github.com/XiaoMengXinX/spotdl/spotify"
+)
+
+func TestDownloadAudiobook(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	book := fixtures.AddAudiobook("Novel", 3)
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download(spotifytest.URL("audiobook", book.ID)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	for _, name := range []string{"01 - Chapter 1.m4a", "02 - Chapter 2.m4a", "03 - Chapter 3.m4a"} {
+		if _, err := os.Stat(filepath.Join(out, book.Name, name)); err != nil {
+			t.Errorf("chapter file missing: %v", err)
+		}
+	}
+
+	id, idType, err := spotify.GetIDType("spotify:chapter:" + book.ChapterIDs[1])
+	if err != nil || id != book.ChapterIDs[1] || idType != spotify.CHAPTER {
+		t.Errorf("GetIDType = %s, %s, %v", id, idType, err)
+	}
+	path, err := d.DownloadChapter(id)
+	if err != nil {
+		t.Fatalf("DownloadChapter: %v", err)
+	}
+	if want := filepath.Join(out, book.Name, "02 - Chapter 2.m4a"); path != want {
+		t.Errorf("chapter path = %s, want %s", path, want)
+	}
+}
+
+func TestChapterTags(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	book := fixtures.AddAudiobook("Saga", 2)
+	d, _ := newTestDownloader(t, srv)
+
+	tags, err := d.ChapterTags(book.ChapterIDs[1])
+	if err != nil {
+		t.Fatalf("ChapterTags: %v", err)
+	}
+	for key, want := range map[string]string{
+		"title":        "Chapter 2",
+		"artist":       "Saga Author",
+		"album":        "Saga",
+		"album_artist": "Saga Author",
+		"composer":     "Saga Narrator, Second Narrator",
+		"NARRATOR":     "Saga Narrator, Second Narrator",
+		"grouping":     "Saga Series",
+		"SERIES":       "Saga Series",
+		"SERIES-PART":  "1",
+		"track":        "2/2",
+		"date":         "2023-05-06",
+		"genre":        "Audiobook",
+		"media_type":   "2",
+	} {
+		if tags[key] != want {
+			t.Errorf("tag %s = %q, want %q", key, tags[key], want)
+		}
+	}
+}
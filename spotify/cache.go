@@ -0,0 +1,130 @@
+package spotify
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/cache"
+	log "github.com/XiaoMengXinX/spotdl/logger"
+)
+
+const day = 24 * time.Hour
+
+// defaultCacheTTL is how long responses are cached per endpoint. Catalogue
+// objects rarely change; playlists and shows are refreshed more often.
+var defaultCacheTTL = map[string]time.Duration{
+	"track":              7 * day,
+	"album":              7 * day,
+	"album-tracks":       day,
+	"playlist-tracks":    time.Hour,
+	"show-episodes":      time.Hour,
+	"audiobook-chapters": day,
+	"metadata":           7 * day,
+	"credits":            7 * day,
+	"episode":            day,
+	"apresolve":          day,
+}
+
+func (d *Downloader) initCache() {
+	conf := d.TokenManager.ConfigManager.Get().Cache
+	for endpoint, seconds := range conf.TTL {
+		if _, ok := defaultCacheTTL[endpoint]; !ok {
+			log.Warnf("Unknown cache endpoint %q in config", endpoint)
+			continue
+		}
+		d.cacheTTL[endpoint] = time.Duration(seconds) * time.Second
+	}
+	if d.cache != nil || conf.Disabled {
+		return
+	}
+	dir := filepath.Join(filepath.Dir(d.TokenManager.ConfigManager.GetPath()), cache.DirName)
+	log.Debugf("Using metadata cache: %s", dir)
+	d.cache = cache.New(dir)
+}
+
+// cacheEndpoint classifies a request URL into a cacheable endpoint name. It
+// returns an empty string for requests that must not be cached.
+func (d *Downloader) cacheEndpoint(method, url string) string {
+	if method != http.MethodGet {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(url, d.endpoints.WebAPI+"/v1/"):
+		segments := strings.Split(strings.SplitN(strings.TrimPrefix(url, d.endpoints.WebAPI+"/v1/"), "?", 2)[0], "/")
+		switch {
+		case segments[0] == "tracks":
+			return "track"
+		case segments[0] == "albums" && len(segments) > 2 && segments[2] == "tracks":
+			return "album-tracks"
+		case segments[0] == "albums":
+			return "album"
+		case segments[0] == "playlists":
+			return "playlist-tracks"
+		case segments[0] == "shows":
+			return "show-episodes"
+		case segments[0] == "audiobooks":
+			return "audiobook-chapters"
+		}
+	case strings.HasPrefix(url, d.endpoints.SpClient+"/metadata/4/"):
+		return "metadata"
+	case strings.HasPrefix(url, d.endpoints.SpClient+"/track-credits-view/"):
+		return "credits"
+	case strings.HasPrefix(url, d.endpoints.Pathfinder):
+		return "episode"
+	}
+	return ""
+}
+
+func (d *Downloader) cacheKey(url, acceptLanguage string) string {
+	if acceptLanguage == "" {
+		return url
+	}
+	return url + "|" + acceptLanguage
+}
+
+func (d *Downloader) cachedResponse(key string) ([]byte, bool) {
+	if d.cache == nil {
+		return nil, false
+	}
+	if d.isOfflineMetadata {
+		return d.staleResponse(key)
+	}
+	return d.cache.Get(key)
+}
+
+// staleResponse returns a cached response even if it has expired.
+func (d *Downloader) staleResponse(key string) ([]byte, bool) {
+	if d.cache == nil {
+		return nil, false
+	}
+	return d.cache.GetStale(key)
+}
+
+func (d *Downloader) storeResponse(key, endpoint string, data []byte) {
+	if d.cache == nil {
+		return
+	}
+	ttl, ok := d.cacheTTL[endpoint]
+	if !ok {
+		ttl = defaultCacheTTL[endpoint]
+	}
+	if ttl <= 0 {
+		return
+	}
+	d.cache.Set(key, endpoint, data, ttl)
+}
+
+// SetCache replaces the metadata cache. A nil cache disables caching.
+func (d *Downloader) SetCache(c *cache.Cache) *Downloader {
+	d.cache = c
+	return d
+}
+
+// SetOfflineMetadata serves metadata only from the cache, ignoring expiry.
+// Uncached metadata requests fail instead of hitting the network.
+func (d *Downloader) SetOfflineMetadata(b bool) *Downloader {
+	d.isOfflineMetadata = b
+	return d
+}
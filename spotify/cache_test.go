@@ -0,0 +1,70 @@
+package spotify_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+)
+
+func TestMetadataCache(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Cached", 1)
+	id := album.TrackIDs[0]
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download(spotifytest.URL("track", id)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if err := os.Remove(trackFile(out, fixtures, id)); err != nil {
+		t.Fatal(err)
+	}
+	srv.ResetHits()
+
+	if err := d.Download(spotifytest.URL("track", id)); err != nil {
+		t.Fatalf("second Download: %v", err)
+	}
+	assertAudioFile(t, trackFile(out, fixtures, id))
+	for _, route := range []string{"web-track", "metadata"} {
+		if n := srv.Hits(route); n != 0 {
+			t.Errorf("%s hit %d times on second download, want 0", route, n)
+		}
+	}
+	// Playback resources must never be served from the cache.
+	if n := srv.Hits("license"); n != 1 {
+		t.Errorf("license hit %d times on second download, want 1", n)
+	}
+}
+
+func TestOfflineMetadata(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Offline", 1)
+	d, _ := newTestDownloader(t, srv)
+	d.SetOfflineMetadata(true)
+	srv.ResetHits()
+
+	if err := d.Download(spotifytest.URL("album", album.ID)); err == nil {
+		t.Error("album download with an empty cache succeeded in offline mode")
+	}
+	if _, err := d.DownloadTrack(album.TrackIDs[0]); err == nil {
+		t.Error("track download with an empty cache succeeded in offline mode")
+	}
+	for _, route := range []string{"web-album-tracks", "web-track", "metadata", "manifest"} {
+		if n := srv.Hits(route); n != 0 {
+			t.Errorf("%s hit %d times in offline mode, want 0", route, n)
+		}
+	}
+}
+
+func TestOfflineMetadataStartup(t *testing.T) {
+	srv, _ := newTestServer(t)
+	d, _ := configureTestDownloader(t, srv)
+	d.SetOfflineMetadata(true)
+	d.Initialize()
+
+	for _, route := range []string{"server-time", "token", "clienttoken", "apresolve"} {
+		if n := srv.Hits(route); n != 0 {
+			t.Errorf("%s hit %d times starting in offline mode, want 0", route, n)
+		}
+	}
+}
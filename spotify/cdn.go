@@ -0,0 +1,133 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/download"
+	"github.com/XiaoMengXinX/spotdl/httpclient"
+	log "github.com/XiaoMengXinX/spotdl/logger"
+)
+
+// maxCDNResolves is how many times storage-resolve is asked for fresh CDN
+// URLs after every URL of the previous answer failed.
+const maxCDNResolves = 3
+
+// cdnURLs are the CDN URLs storage-resolve returned for a file.
+type cdnURLs struct {
+	URLs    []string
+	Expires time.Time
+}
+
+func (c cdnURLs) expired() bool {
+	return !c.Expires.IsZero() && time.Now().After(c.Expires)
+}
+
+func (d *Downloader) requestCDNURLs(fileID string) (cdnURLs, error) {
+	params := buildQueryParams(map[string]interface{}{"alt": "json"})
+
+	var respBody []byte
+	err := d.withClientBase(func(base string) (err error) {
+		url := fmt.Sprintf("%s/storage-resolve/files/audio/interactive/%s", base, fileID)
+		respBody, err = d.makeRequest(http.MethodGet, url+"?"+params, nil)
+		return err
+	})
+	if err != nil {
+		log.Debugf("Fetch CDN URL Failed: %v", err)
+		return cdnURLs{}, err
+	}
+
+	var cdnResponse cdnURL
+	if err := json.Unmarshal(respBody, &cdnResponse); err != nil {
+		return cdnURLs{}, fmt.Errorf("failed to parse storage-resolve response: %w", err)
+	}
+
+	if len(cdnResponse.CdnURL) == 0 {
+		return cdnURLs{}, fmt.Errorf("no CDN URL found in response")
+	}
+	log.Debugf("Get CDN URL successfully: %v", cdnResponse.CdnURL)
+
+	urls := cdnURLs{URLs: cdnResponse.CdnURL}
+	if cdnResponse.TTL > 0 {
+		urls.Expires = time.Now().Add(time.Duration(cdnResponse.TTL) * time.Second)
+	}
+	return urls, nil
+}
+
+// downloadFromCDN downloads a file into the output folder, rotating through
+// the CDN URLs on network and HTTP errors, stalls and expiry, and resolving
+// new URLs once all of them have failed. Segments finished on one URL are
+// kept when moving on to the next. Local file errors and cancellation are
+// returned at once, since another URL would not help.
+func (d *Downloader) downloadFromCDN(fileID, fileName string, onProgress func(download.Progress)) error {
+	var lastErr error
+	for range maxCDNResolves {
+		cdn, err := d.requestCDNURLs(fileID)
+		if err != nil {
+			return err
+		}
+		for _, cdnURL := range cdn.URLs {
+			if cdn.expired() {
+				log.Warnln("CDN URLs expired, resolving new ones")
+				break
+			}
+			if lastErr = d.downloadCDNFile(cdnURL, fileName, onProgress); lastErr == nil {
+				return nil
+			}
+			if !retryableCDNError(lastErr) {
+				return lastErr
+			}
+			log.Warnf("Download from CDN [%s] failed: %v", cdnHost(cdnURL), lastErr)
+		}
+	}
+	return fmt.Errorf("all CDN URLs failed: %w", lastErr)
+}
+
+func (d *Downloader) downloadCDNFile(cdnURL, fileName string, onProgress func(download.Progress)) error {
+	conf := d.TokenManager.ConfigManager.Get().Download
+	if d.download.Segments > 0 {
+		conf.Segments = d.download.Segments
+	}
+	if d.download.SegmentSize > 0 {
+		conf.SegmentSize = d.download.SegmentSize
+	}
+
+	dl := download.New(httpclient.WithoutTimeout(d.httpClient), download.Options{
+		Segments:     conf.Segments,
+		SegmentSize:  conf.SegmentSize,
+		StallTimeout: time.Duration(d.network.StallTimeout) * time.Second,
+		OnProgress:   onProgress,
+	})
+	return dl.Download(context.Background(), cdnURL, filepath.Join(d.outputFolder, fileName))
+}
+
+// retryableCDNError reports whether err came from the CDN rather than from
+// writing the file or a cancelled download.
+func retryableCDNError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	return !errors.As(err, &pathErr) && !errors.As(err, &linkErr)
+}
+
+func cdnHost(cdnURL string) string {
+	u, err := url.Parse(cdnURL)
+	if err != nil {
+		return cdnURL
+	}
+	return u.Host
+}
@@ -0,0 +1,75 @@
+package spotify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/config"
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+)
+
+func TestCDNFailover(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("CDN", 1)
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "reset", http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	// stalling answers HEAD requests but never sends a body.
+	release := make(chan struct{})
+	stalling := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.Itoa(len(spotifytest.Audio())))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer stalling.Close()
+	defer close(release)
+
+	srv.ExtraCDNs = []string{broken.URL, stalling.URL}
+	d, out := newTestDownloader(t, srv)
+	d.SetNetwork(config.Network{StallTimeout: 1})
+	d.Initialize()
+
+	start := time.Now()
+	if _, err := d.DownloadTrack(album.TrackIDs[0]); err != nil {
+		t.Fatalf("DownloadTrack: %v", err)
+	}
+	assertAudioFile(t, trackFile(out, fixtures, album.TrackIDs[0]))
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("download took %v, stalled CDN was not abandoned", elapsed)
+	}
+	if n := srv.Hits("cdn"); n == 0 {
+		t.Error("working CDN was never used")
+	}
+}
+
+func TestCDNLocalErrorNotRetried(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Local", 1)
+	d, out := newTestDownloader(t, srv)
+
+	// A directory in place of the temp file fails every attempt the same way.
+	if err := os.MkdirAll(trackFile(out, fixtures, album.TrackIDs[0])+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.DownloadTrack(album.TrackIDs[0]); err == nil {
+		t.Fatal("DownloadTrack succeeded without a writable temp file")
+	}
+	if n := srv.Hits("storage-resolve"); n != 1 {
+		t.Errorf("storage-resolve requested %d times, want 1", n)
+	}
+}
@@ -0,0 +1,237 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	log "github.com/XiaoMengXinX/spotdl/logger"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Chapter sidecar formats.
+const (
+	ChapterFileNone = ""
+	ChapterFileTxt  = "txt"
+	ChapterFileCue  = "cue"
+)
+
+// chapter is a titled section of an episode.
+type chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// chapterLine matches description lines such as "12:34 Topic",
+// "(1:02:03) - Topic" or "[00:00] Intro".
+var chapterLine = regexp.MustCompile(`^\s*[(\[]?((?:\d{1,2}:)?\d{1,2}:\d{2})[)\]]?\s*(?:[-–—:|]\s*)?(\S.*?)\s*$`)
+
+// SetChapterFile writes the chapters of episodes to a sidecar next to the
+// output file: ChapterFileTxt for ".chapters.txt", ChapterFileCue for ".cue".
+func (d *Downloader) SetChapterFile(format string) error {
+	switch format {
+	case ChapterFileNone, ChapterFileTxt, ChapterFileCue:
+		d.chapterFile = format
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid chapter file format", format)
+	}
+}
+
+// episodeChapters returns the chapters Spotify provides for an episode, or
+// those listed as timestamps in its description.
+func episodeChapters(episodeMD episodeMetadata) []chapter {
+	episode := episodeMD.Data.Episode
+	duration := time.Duration(episode.Duration.TotalMilliseconds) * time.Millisecond
+
+	var chapters []chapter
+	for _, item := range episode.Chapters.Items {
+		chapters = append(chapters, chapter{
+			Title: item.Title,
+			Start: time.Duration(item.StartTime.TotalMilliseconds) * time.Millisecond,
+		})
+	}
+	if len(chapters) == 0 {
+		chapters = parseChapters(episode.Description)
+	}
+	return finishChapters(chapters, duration)
+}
+
+// parseChapters reads a timestamp list from a description. At least two
+// lines in increasing order are needed for them to count as chapters.
+func parseChapters(description string) []chapter {
+	var chapters []chapter
+	for _, line := range strings.Split(description, "\n") {
+		m := chapterLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		start, ok := parseTimestamp(m[1])
+		if !ok || len(chapters) > 0 && start <= chapters[len(chapters)-1].Start {
+			continue
+		}
+		chapters = append(chapters, chapter{Title: m[2], Start: start})
+	}
+	if len(chapters) < 2 {
+		return nil
+	}
+	return chapters
+}
+
+func parseTimestamp(s string) (time.Duration, bool) {
+	var total int
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, false
+		}
+		total = total*60 + n
+	}
+	return time.Duration(total) * time.Second, true
+}
+
+// finishChapters sets each chapter's end to the start of the next, and the
+// last one's to the duration if it is known.
+func finishChapters(chapters []chapter, duration time.Duration) []chapter {
+	for i := range chapters {
+		switch {
+		case i+1 < len(chapters):
+			chapters[i].End = chapters[i+1].Start
+		case duration > chapters[i].Start:
+			chapters[i].End = duration
+		default:
+			chapters[i].End = chapters[i].Start
+		}
+	}
+	return chapters
+}
+
+// writeChapterFile writes chapters next to audioFile in the configured
+// sidecar format.
+func (d *Downloader) writeChapterFile(audioFile, title string, chapters []chapter) error {
+	if d.chapterFile == ChapterFileNone || len(chapters) == 0 {
+		return nil
+	}
+	base := strings.TrimSuffix(audioFile, filepath.Ext(audioFile))
+
+	var b bytes.Buffer
+	var path string
+	switch d.chapterFile {
+	case ChapterFileTxt:
+		path = base + ".chapters.txt"
+		for _, c := range chapters {
+			fmt.Fprintf(&b, "%s %s\n", formatTimestamp(c.Start), c.Title)
+		}
+	case ChapterFileCue:
+		path = base + ".cue"
+		fmt.Fprintf(&b, "TITLE %s\n", cueString(title))
+		fmt.Fprintf(&b, "FILE %s %s\n", cueString(filepath.Base(audioFile)), cueFileType(audioFile))
+		for i, c := range chapters {
+			fmt.Fprintf(&b, "  TRACK %02d AUDIO\n", i+1)
+			fmt.Fprintf(&b, "    TITLE %s\n", cueString(c.Title))
+			fmt.Fprintf(&b, "    INDEX 01 %s\n", cueTimestamp(c.Start))
+		}
+	}
+	log.Debugf("Writing chapters to [%s]", path)
+	return os.WriteFile(path, b.Bytes(), 0644)
+}
+
+func formatTimestamp(t time.Duration) string {
+	t = t.Truncate(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(t.Hours()), int(t.Minutes())%60, int(t.Seconds())%60)
+}
+
+// cueTimestamp formats t as minutes, seconds and frames of 1/75 second.
+func cueTimestamp(t time.Duration) string {
+	frames := t.Milliseconds() * 75 / 1000
+	return fmt.Sprintf("%02d:%02d:%02d", frames/75/60, frames/75%60, frames%75)
+}
+
+func cueString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "'") + `"`
+}
+
+// cueFileType is the cue FILE type of audioFile. Cue sheets only know MP3 and
+// WAVE for audio, and players read WAVE as any other audio file.
+func cueFileType(audioFile string) string {
+	if strings.EqualFold(filepath.Ext(audioFile), ".mp3") {
+		return "MP3"
+	}
+	return "WAVE"
+}
+
+// ffmetadataChapters serializes chapters as ffmetadata sections.
+func ffmetadataChapters(chapters []chapter) []byte {
+	var b bytes.Buffer
+	for _, c := range chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			c.Start.Milliseconds(), c.End.Milliseconds(), ffmetadataEscape.Replace(c.Title))
+	}
+	return b.Bytes()
+}
+
+// vorbisChapters returns the CHAPTERxxx comments of the Vorbis chapter
+// extension.
+func vorbisChapters(chapters []chapter) map[string]string {
+	comments := make(map[string]string)
+	for i, c := range chapters {
+		key := fmt.Sprintf("CHAPTER%03d", i+1)
+		comments[key] = formatTimestamp(c.Start) + fmt.Sprintf(".%03d", c.Start.Milliseconds()%1000)
+		comments[key+"NAME"] = c.Title
+	}
+	return comments
+}
+
+// id3Chapters returns the bodies of a CHAP frame per chapter and the CTOC
+// frame listing them, for a tag of the given ID3v2 version.
+func id3Chapters(version byte, chapters []chapter) (chap [][]byte, ctoc []byte) {
+	var toc bytes.Buffer
+	toc.WriteString("toc\x00")
+	// Top-level and ordered.
+	toc.WriteByte(0x03)
+	chapters = chapters[:min(len(chapters), 255)]
+	toc.WriteByte(byte(len(chapters)))
+
+	for i, c := range chapters {
+		id := fmt.Sprintf("chp%d", i)
+		toc.WriteString(id + "\x00")
+
+		var b bytes.Buffer
+		b.WriteString(id + "\x00")
+		_ = binary.Write(&b, binary.BigEndian, uint32(c.Start.Milliseconds()))
+		_ = binary.Write(&b, binary.BigEndian, uint32(c.End.Milliseconds()))
+		// Byte offsets are not used.
+		_ = binary.Write(&b, binary.BigEndian, uint64(0xFFFFFFFFFFFFFFFF))
+		b.Write(id3TextFrame(version, "TIT2", c.Title))
+		chap = append(chap, b.Bytes())
+	}
+	toc.Write(id3TextFrame(version, "TIT2", "Chapters"))
+	return chap, toc.Bytes()
+}
+
+// id3TextFrame encodes a text frame embedded in a CHAP or CTOC frame.
+func id3TextFrame(version byte, id, text string) []byte {
+	// UTF-8 text needs ID3v2.4; v2.3 gets UTF-16 with BOM.
+	body := append([]byte{3}, text...)
+	if version < 4 {
+		body = []byte{1, 0xFF, 0xFE}
+		for _, r := range utf16.Encode([]rune(text)) {
+			body = binary.LittleEndian.AppendUint16(body, r)
+		}
+		body = append(body, 0, 0)
+	}
+
+	size := uint32(len(body))
+	if version >= 4 {
+		size = size&0x7f | (size&0x3f80)<<1 | (size&0x1fc000)<<2 | (size&0xfe00000)<<3
+	}
+	frame := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(frame[4:8], size)
+	return append(frame, body...)
+}
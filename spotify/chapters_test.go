@@ -0,0 +1,73 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseChapters(t *testing.T) {
+	description := `Welcome to the show!
+00:00 Intro
+(3:15) - The first topic
+[1:02:03] Listener questions
+12:00 out of order, ignored
+Find us at example.com 9:99`
+
+	chapters := finishChapters(parseChapters(description), 2*time.Hour)
+	want := []chapter{
+		{Title: "Intro", Start: 0, End: 3*time.Minute + 15*time.Second},
+		{Title: "The first topic", Start: 3*time.Minute + 15*time.Second, End: time.Hour + 2*time.Minute + 3*time.Second},
+		{Title: "Listener questions", Start: time.Hour + 2*time.Minute + 3*time.Second, End: 2 * time.Hour},
+	}
+	if !reflect.DeepEqual(chapters, want) {
+		t.Errorf("chapters = %+v, want %+v", chapters, want)
+	}
+
+	if got := parseChapters("Our guest joined at 10:30 today."); got != nil {
+		t.Errorf("a single timestamp gave chapters %+v", got)
+	}
+}
+
+func TestID3Chapters(t *testing.T) {
+	chapters := []chapter{
+		{Title: "Intro", Start: 0, End: 90 * time.Second},
+		{Title: "Main", Start: 90 * time.Second, End: 10 * time.Minute},
+	}
+	chap, ctoc := id3Chapters(4, chapters)
+	if len(chap) != 2 {
+		t.Fatalf("got %d CHAP frames, want 2", len(chap))
+	}
+
+	// Element ID, start and end in ms, unused byte offsets, then TIT2.
+	second := chap[1]
+	if !bytes.HasPrefix(second, []byte("chp1\x00")) {
+		t.Fatalf("CHAP element ID = %q", second[:5])
+	}
+	if start, end := binary.BigEndian.Uint32(second[5:]), binary.BigEndian.Uint32(second[9:]); start != 90000 || end != 600000 {
+		t.Errorf("CHAP times = %d-%d, want 90000-600000", start, end)
+	}
+	if !bytes.Equal(second[21:], []byte("TIT2\x00\x00\x00\x05\x00\x00\x03Main")) {
+		t.Errorf("CHAP title subframe = %q", second[21:])
+	}
+
+	if !bytes.HasPrefix(ctoc, []byte("toc\x00\x03\x02chp0\x00chp1\x00TIT2")) {
+		t.Errorf("CTOC = %q", ctoc)
+	}
+}
+
+func TestCueTimestamp(t *testing.T) {
+	if got := cueTimestamp(62*time.Minute + 5*time.Second + 500*time.Millisecond); got != "62:05:37" {
+		t.Errorf("cueTimestamp = %s, want 62:05:37", got)
+	}
+}
+
+func TestCueFileType(t *testing.T) {
+	for file, want := range map[string]string{"a.mp3": "MP3", "a.m4a": "WAVE", "a.flac": "WAVE", "a.wav": "WAVE"} {
+		if got := cueFileType(file); got != want {
+			t.Errorf("cueFileType(%s) = %s, want %s", file, got, want)
+		}
+	}
+}
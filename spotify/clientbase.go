@@ -0,0 +1,149 @@
+package spotify
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/XiaoMengXinX/spotdl/logger"
+)
+
+// clientBaseCooldown is how long a client base is skipped after it fails.
+const clientBaseCooldown = 5 * time.Minute
+
+type clientBaseHost struct {
+	base         string
+	successes    int
+	failures     int
+	latency      time.Duration
+	evictedUntil time.Time
+}
+
+// clientBasePool orders the spclient hosts returned by apresolve by health.
+// Hosts that answered recently come first, fastest first; hosts that have not
+// been tried yet keep their apresolve order; failed hosts are evicted until
+// their cooldown passes.
+type clientBasePool struct {
+	mu       sync.Mutex
+	hosts    []*clientBaseHost
+	cooldown time.Duration
+}
+
+func newClientBasePool(bases []string) *clientBasePool {
+	p := &clientBasePool{cooldown: clientBaseCooldown}
+	for _, base := range bases {
+		p.hosts = append(p.hosts, &clientBaseHost{base: base})
+	}
+	return p
+}
+
+// ordered returns every base, healthiest first. Evicted hosts are still
+// returned last so that requests are attempted even if all hosts failed.
+func (p *clientBasePool) ordered() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	hosts := slices.Clone(p.hosts)
+	slices.SortStableFunc(hosts, func(a, b *clientBaseHost) int {
+		aEvicted, bEvicted := now.Before(a.evictedUntil), now.Before(b.evictedUntil)
+		switch {
+		case aEvicted != bEvicted:
+			if aEvicted {
+				return 1
+			}
+			return -1
+		case aEvicted:
+			return a.evictedUntil.Compare(b.evictedUntil)
+		case (a.successes == 0) != (b.successes == 0):
+			if a.successes == 0 {
+				return 1
+			}
+			return -1
+		}
+		return int(a.latency - b.latency)
+	})
+
+	bases := make([]string, len(hosts))
+	for i, host := range hosts {
+		bases[i] = host.base
+	}
+	return bases
+}
+
+func (p *clientBasePool) host(base string) *clientBaseHost {
+	for _, host := range p.hosts {
+		if host.base == base {
+			return host
+		}
+	}
+	return nil
+}
+
+func (p *clientBasePool) reportSuccess(base string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	host := p.host(base)
+	if host == nil {
+		return
+	}
+	if host.successes == 0 {
+		host.latency = latency
+	} else {
+		// Exponentially weighted moving average.
+		host.latency = (host.latency*7 + latency*3) / 10
+	}
+	host.successes++
+	host.evictedUntil = time.Time{}
+}
+
+func (p *clientBasePool) reportFailure(base string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	host := p.host(base)
+	if host == nil {
+		return
+	}
+	host.failures++
+	host.evictedUntil = time.Now().Add(p.cooldown)
+}
+
+// isHostFailure reports whether err means the host itself is unusable, as
+// opposed to a rejected request that would fail on any host.
+func isHostFailure(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// withClientBase calls fn with client bases in health order until one
+// succeeds or fails for a reason unrelated to the host.
+func (d *Downloader) withClientBase(fn func(base string) error) (err error) {
+	bases := d.clientBases.ordered()
+	if len(bases) == 0 {
+		bases = []string{d.endpoints.ClientBase}
+	}
+
+	for _, base := range bases {
+		start := time.Now()
+		err = fn(base)
+		if err == nil {
+			d.clientBases.reportSuccess(base, time.Since(start))
+			return nil
+		}
+		if !isHostFailure(err) {
+			// The request itself was rejected; that says nothing about
+			// the host's health.
+			return err
+		}
+		d.clientBases.reportFailure(base)
+		log.Warnf("Client base %s failed, trying next: %v", base, err)
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package spotify_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/spotify"
+)
+
+func TestClientBaseFailover(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Failover", 2)
+
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	var unavailableHits atomic.Int32
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unavailableHits.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	srv.ExtraClientBases = []string{dead.URL, unavailable.URL}
+
+	d, out := newTestDownloader(t, srv)
+	for _, id := range album.TrackIDs {
+		if _, err := d.DownloadTrack(id); err != nil {
+			t.Fatalf("DownloadTrack: %v", err)
+		}
+		assertAudioFile(t, trackFile(out, fixtures, id))
+	}
+	// Both broken hosts are evicted after their first failure.
+	if n := unavailableHits.Load(); n != 1 {
+		t.Errorf("failing client base hit %d times, want 1", n)
+	}
+}
+
+func TestClientBasesCached(t *testing.T) {
+	srv, _ := newTestServer(t)
+	d, _ := newTestDownloader(t, srv)
+	d.Initialize()
+	if n := srv.Hits("apresolve"); n != 1 {
+		t.Errorf("apresolve hit %d times, want 1", n)
+	}
+}
+
+func TestClientBaseRejectedRequests(t *testing.T) {
+	d := spotify.NewClientBaseDownloader("a", "b")
+	d.ReportClientBaseFailure("a")
+	evicted := d.ClientBaseHealth("a").EvictedUntil
+
+	for _, rejected := range []error{
+		spotify.NewStatusError("a", http.StatusNotFound),
+		spotify.NewStatusError("a", http.StatusTooManyRequests),
+		errors.New("failed to decode response"),
+	} {
+		err := d.WithClientBase(func(base string) error {
+			time.Sleep(time.Millisecond)
+			return rejected
+		})
+		if err != rejected {
+			t.Errorf("WithClientBase = %v, want %v", err, rejected)
+		}
+	}
+
+	// Rejected requests were tried on the healthy host only and neither
+	// count as successes nor lift the other host's eviction.
+	for _, base := range []string{"a", "b"} {
+		if host := d.ClientBaseHealth(base); host.Successes != 0 || host.Latency != 0 {
+			t.Errorf("host %s has %d successes and latency %v, want none", base, host.Successes, host.Latency)
+		}
+	}
+	if d.ClientBaseHealth("a").EvictedUntil != evicted {
+		t.Errorf("eviction of host a was changed by rejected requests")
+	}
+}
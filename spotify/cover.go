@@ -3,6 +3,7 @@ package spotify
 import (
 	"fmt"
 	log "github.com/XiaoMengXinX/spotdl/logger"
+	"path"
 	"sort"
 )
 
@@ -12,7 +13,7 @@ func (d *Downloader) downloadCoverImage(metadata trackMetadata) (fileName string
 		return fileName, fmt.Errorf("failed to get cover: %v", err)
 	}
 
-	url := fmt.Sprintf("https://i.scdn.co/image/%s", fileId)
+	url := fmt.Sprintf("%s/image/%s", d.endpoints.Images, fileId)
 	fileName = fmt.Sprintf("%s.jpg", fileId)
 
 	if err = d.downloadURL(url, fileName); err != nil {
@@ -34,3 +35,32 @@ func getLargestCover(metadata trackMetadata) (string, error) {
 
 	return metadata.Album.CoverGroup.Image[0].FileId, nil
 }
+
+// downloadEpisodeCover downloads the largest episode image, or the show's or
+// audiobook's if the episode or chapter has none.
+func (d *Downloader) downloadEpisodeCover(metadata episodeMetadata) (fileName string, err error) {
+	episode := metadata.Data.Episode
+	sources := episode.CoverArt.Sources
+	if len(sources) == 0 {
+		sources = episode.Podcast.Data.CoverArt.Sources
+	}
+	if len(sources) == 0 {
+		sources = episode.Audiobook.Data.CoverArt.Sources
+	}
+	if len(sources) == 0 {
+		return fileName, fmt.Errorf("failed to get cover: no cover images available")
+	}
+
+	largest := sources[0]
+	for _, source := range sources[1:] {
+		if source.Width*source.Height > largest.Width*largest.Height {
+			largest = source
+		}
+	}
+
+	fileName = fmt.Sprintf("%s.jpg", path.Base(largest.URL))
+	if err = d.downloadURL(largest.URL, fileName); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,145 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/XiaoMengXinX/spotdl/logger"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	// creditTags are the tags credits can be mapped to. Performers and the
+	// people of TIPL roles are also written as ID3 TMCL and TIPL frames.
+	creditTags = []string{"composer", "lyricist", "producer", "engineer", "mixer", "arranger", "performer"}
+
+	// involvedPeopleTags are the credit tags listed in the ID3 TIPL frame.
+	involvedPeopleTags = []string{"producer", "engineer", "mixer", "arranger"}
+
+	// defaultCreditRoles maps lowercased credit roles and subroles to tags.
+	// Subroles take precedence over the role they belong to.
+	defaultCreditRoles = map[string]string{
+		"writers":            "composer",
+		"composer":           "composer",
+		"songwriter":         "composer",
+		"lyricist":           "lyricist",
+		"producers":          "producer",
+		"producer":           "producer",
+		"co-producer":        "producer",
+		"executive producer": "producer",
+		"engineer":           "engineer",
+		"recording engineer": "engineer",
+		"mastering engineer": "engineer",
+		"mixing engineer":    "mixer",
+		"mixer":              "mixer",
+		"arranger":           "arranger",
+		"performers":         "performer",
+	}
+)
+
+// SetCreditsFile writes the full credits of each track to a ".credits.json"
+// file next to it.
+func (d *Downloader) SetCreditsFile(b bool) *Downloader {
+	d.creditsFile = b
+	return d
+}
+
+// creditRoles returns the role mapping with the config file's overrides.
+func (d *Downloader) creditRoles() map[string]string {
+	roles := maps.Clone(defaultCreditRoles)
+	for role, tag := range d.output.Credits.Roles {
+		roles[strings.ToLower(role)] = tag
+	}
+	return roles
+}
+
+func validateCreditRoles(roles map[string]string) error {
+	for role, tag := range roles {
+		if tag != "" && !slices.Contains(creditTags, tag) {
+			return fmt.Errorf("credit role %q maps to unknown tag %q, use one of %s or \"\" to drop it", role, tag, strings.Join(creditTags, ", "))
+		}
+	}
+	return nil
+}
+
+// buildCreditTags maps every credited person to tags by their subroles, or
+// their role if no subrole is mapped. Performers are listed with their
+// instruments, and the ID3-only TIPL and TMCL keys hold role and name pairs.
+func buildCreditTags(credits trackCredits, roles map[string]string) map[string]string {
+	names := make(map[string][]string)
+	var involved, musicians []string
+	add := func(tag, name string) {
+		if !slices.Contains(names[tag], name) {
+			names[tag] = append(names[tag], name)
+		}
+	}
+
+	for _, r := range credits.RoleCredits {
+		for _, artist := range r.Artists {
+			var tags []string
+			for _, subrole := range artist.SubRoles {
+				if tag := roles[strings.ToLower(subrole)]; tag != "" && !slices.Contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+			if len(tags) == 0 {
+				if tag := roles[strings.ToLower(r.RoleTitle)]; tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+
+			for _, tag := range tags {
+				switch {
+				case tag == "performer":
+					name := artist.Name
+					if len(artist.SubRoles) > 0 {
+						name = fmt.Sprintf("%s (%s)", artist.Name, strings.Join(artist.SubRoles, ", "))
+					}
+					add(tag, name)
+					instruments := artist.SubRoles
+					if len(instruments) == 0 {
+						instruments = []string{"performer"}
+					}
+					for _, instrument := range instruments {
+						musicians = append(musicians, strings.ToLower(instrument), artist.Name)
+					}
+				case slices.Contains(involvedPeopleTags, tag):
+					add(tag, artist.Name)
+					involved = append(involved, tag, artist.Name)
+				default:
+					add(tag, artist.Name)
+				}
+			}
+		}
+	}
+
+	tags := make(map[string]string)
+	for tag, list := range names {
+		tags[tag] = strings.Join(list, ", ")
+	}
+	if len(involved) > 0 {
+		tags["TIPL"] = strings.Join(involved, "\x00")
+	}
+	if len(musicians) > 0 {
+		tags["TMCL"] = strings.Join(musicians, "\x00")
+	}
+	return tags
+}
+
+// writeCreditsFile writes the credits of a track next to audioFile.
+func (d *Downloader) writeCreditsFile(audioFile, trackID string) error {
+	credits, err := d.getTrackCredits(trackID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(credits, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := strings.TrimSuffix(audioFile, filepath.Ext(audioFile)) + ".credits.json"
+	log.Debugf("Writing credits to [%s]", path)
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
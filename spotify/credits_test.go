@@ -0,0 +1,76 @@
+package spotify_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+)
+
+func TestCreditTags(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Credits", 1)
+	track := fixtures.Tracks[album.TrackIDs[0]]
+	track.Writers = []string{"Writer One"}
+	track.Credits = []spotifytest.Credit{
+		{Role: "Writers", Name: "Lyric Writer", Subroles: []string{"Lyricist"}},
+		{Role: "Writers", Name: "Both Ways", Subroles: []string{"Composer", "Lyricist"}},
+		{Role: "Producers", Name: "Pro Ducer", Subroles: []string{"Producer"}},
+		{Role: "Producers", Name: "Mix Master", Subroles: []string{"Mixing Engineer"}},
+		{Role: "Performers", Name: "Guitar Hero", Subroles: []string{"Guitar", "Vocals"}},
+		{Role: "Engineers", Name: "Tape Op", Subroles: []string{"Recording Engineer"}},
+	}
+	d, _ := newTestDownloader(t, srv, map[string]any{
+		"output": map[string]any{"credits": map[string]any{"roles": map[string]string{"Recording Engineer": ""}}},
+	})
+
+	tags, err := d.TrackTags(track.ID)
+	if err != nil {
+		t.Fatalf("TrackTags: %v", err)
+	}
+	artist := album.Artists[0].Name
+	for key, want := range map[string]string{
+		"composer":  "Writer One, Both Ways",
+		"lyricist":  "Lyric Writer, Both Ways",
+		"producer":  "Pro Ducer",
+		"mixer":     "Mix Master",
+		"engineer":  "",
+		"performer": artist + ", Guitar Hero (Guitar, Vocals)",
+		"TIPL":      "producer\x00Pro Ducer\x00mixer\x00Mix Master",
+		"TMCL":      "performer\x00" + artist + "\x00guitar\x00Guitar Hero\x00vocals\x00Guitar Hero",
+	} {
+		if tags[key] != want {
+			t.Errorf("tag %s = %q, want %q", key, tags[key], want)
+		}
+	}
+}
+
+func TestCreditsFile(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Sidecar", 1)
+	d, _ := newTestDownloader(t, srv)
+	d.SetCreditsFile(true)
+
+	path, err := d.DownloadTrack(album.TrackIDs[0])
+	if err != nil {
+		t.Fatalf("DownloadTrack: %v", err)
+	}
+	data, err := os.ReadFile(strings.TrimSuffix(path, ".m4a") + ".credits.json")
+	if err != nil {
+		t.Fatalf("credits file: %v", err)
+	}
+	var credits struct {
+		RoleCredits []struct {
+			RoleTitle string `json:"roleTitle"`
+		} `json:"roleCredits"`
+		SourceNames []string `json:"sourceNames"`
+	}
+	if err := json.Unmarshal(data, &credits); err != nil {
+		t.Fatalf("invalid credits file: %v", err)
+	}
+	if len(credits.RoleCredits) != 2 || credits.SourceNames[0] != "spotifytest" {
+		t.Errorf("credits file = %s", data)
+	}
+}
@@ -14,10 +14,10 @@ import (
 	"net/http"
 )
 
-func requestPSSH(fildID string) (pssh string, err error) {
-	url := fmt.Sprintf("https://seektables.scdn.co/seektable/%s.json", fildID)
+func (d *Downloader) requestPSSH(fildID string) (pssh string, err error) {
+	url := fmt.Sprintf("%s/seektable/%s.json", d.endpoints.SeekTables, fildID)
 
-	resp, err := http.Get(url)
+	resp, err := d.httpClient.Get(url)
 	if err != nil {
 		return "", fmt.Errorf("faied to request PSSH: %v", err)
 	}
@@ -61,8 +61,11 @@ func (d *Downloader) getMp4Keys(psshStr string) ([]*widevine.Key, error) {
 		return nil, fmt.Errorf("get license challenge failed: %w", err)
 	}
 
-	license, err := d.makeRequest(http.MethodPost, d.licenseURL, challenge)
-
+	var license []byte
+	err = d.withClientBase(func(base string) (err error) {
+		license, err = d.makeRequest(http.MethodPost, base+"/widevine-license/v1/audio/license", challenge)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("request license failed: %w", err)
 	}
@@ -96,7 +99,7 @@ func (d *Downloader) getOggKeys(fileID string) (key []byte, err error) {
 		return key, fmt.Errorf("serialize request failed: %v", err)
 	}
 
-	url := fmt.Sprintf("https://spclient.wg.spotify.com/playplay/v1/key/%s", fileID)
+	url := fmt.Sprintf("%s/playplay/v1/key/%s", d.endpoints.SpClient, fileID)
 	resp, err := d.makeRequest(http.MethodPost, url, body)
 	if err != nil {
 		return key, fmt.Errorf("request license failed: %w", err)
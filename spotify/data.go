@@ -28,33 +28,36 @@ type WebAPIArtist struct {
 	URL  string
 }
 
-type albumTracksData struct {
-	Items []struct {
-		Id string `json:"id"`
-	} `json:"items"`
+// pagingData is a Web API paging object.
+type pagingData[T any] struct {
+	Items  []T    `json:"items"`
 	Total  int    `json:"total"`
 	Offset int    `json:"offset"`
 	Next   string `json:"next"`
 }
 
-type playlistTracksData struct {
-	Items []struct {
-		Track struct {
-			Id string `json:"id"`
-		} `json:"track"`
-	} `json:"items"`
-	Total  int    `json:"total"`
-	Offset int    `json:"offset"`
-	Next   string `json:"next"`
+type albumTrackItem struct {
+	Id         string `json:"id"`
+	DiscNumber int    `json:"disc_number"`
 }
 
-type showTracksData struct {
-	Items []struct {
+type playlistTrackItem struct {
+	Track struct {
 		Id string `json:"id"`
-	} `json:"items"`
-	Total  int    `json:"total"`
-	Offset int    `json:"offset"`
-	Next   string `json:"next"`
+	} `json:"track"`
+}
+
+type showEpisodeItem struct {
+	Id string `json:"id"`
+}
+
+type audiobookChapterItem struct {
+	Id string `json:"id"`
+}
+
+// nameData is a named entity of a pathfinder response, such as an author.
+type nameData struct {
+	Name string `json:"name"`
 }
 
 type albumData struct {
@@ -80,12 +83,15 @@ type albumData struct {
 	} `json:"external_ids"`
 	Genres []string `json:"genres"`
 	Label  string   `json:"label"`
+	// Tracks is the first page of the track listing of full album objects.
+	Tracks pagingData[albumTrackItem] `json:"tracks"`
 }
 
 type trackData struct {
 	ExternalUrls struct {
 		Spotify string `json:"spotify"`
 	} `json:"external_urls"`
+	ID          string       `json:"id"`
 	Album       albumData    `json:"album"`
 	Artists     []artistData `json:"artists"`
 	DurationMS  int          `json:"duration_ms"`
@@ -96,6 +102,15 @@ type trackData struct {
 	} `json:"external_ids"`
 	Name        string `json:"name"`
 	TrackNumber int    `json:"track_number"`
+	DiscNumber  int    `json:"disc_number"`
+}
+
+type tracksData struct {
+	Tracks []*trackData `json:"tracks"`
+}
+
+type albumsData struct {
+	Albums []*albumData `json:"albums"`
 }
 
 type trackCredits struct {
@@ -115,6 +130,7 @@ type trackMetadata struct {
 		CoverGroup struct {
 			Image []albumImageData `json:"image"`
 		} `json:"cover_group"`
+		Artists []artistData `json:"artist"`
 	} `json:"album"`
 	Artists []artistData `json:"artist"`
 	File    []fileEntry  `json:"file"`
@@ -122,25 +138,83 @@ type trackMetadata struct {
 		File []fileEntry `json:"file"`
 	} `json:"alternative,omitempty"`
 	CanonicalURI string `json:"canonical_uri"`
+	Number       int    `json:"number"`
+	DiscNumber   int    `json:"disc_number"`
 }
 
 type episodeMetadata struct {
 	Data struct {
 		Episode struct {
-			Name    string `json:"name"`
-			Creator string `json:"creator"`
-			Audio   struct {
+			Name        string `json:"name"`
+			Uri         string `json:"uri"`
+			Creator     string `json:"creator"`
+			Description string `json:"description"`
+			ReleaseDate struct {
+				IsoString string `json:"isoString"`
+				Precision string `json:"precision"`
+			} `json:"releaseDate"`
+			Duration struct {
+				TotalMilliseconds int `json:"totalMilliseconds"`
+			} `json:"duration"`
+			CoverArt coverArtData `json:"coverArt"`
+			Chapters struct {
+				Items []struct {
+					Title     string `json:"title"`
+					StartTime struct {
+						TotalMilliseconds int `json:"totalMilliseconds"`
+					} `json:"startTime"`
+				} `json:"items"`
+			} `json:"chapters"`
+			Audio struct {
 				Items []fileEntry `json:"items"`
 			} `json:"audio"`
 			Podcast struct {
 				Data struct {
-					Name string `json:"name"`
+					Name        string `json:"name"`
+					Uri         string `json:"uri"`
+					Description string `json:"description"`
+					Publisher   struct {
+						Name string `json:"name"`
+					} `json:"publisher"`
+					CoverArt coverArtData `json:"coverArt"`
 				} `json:"data"`
 			} `json:"podcastV2"`
+			// ChapterNumber is the zero-based position of an audiobook
+			// chapter in its book.
+			ChapterNumber int `json:"chapterNumber"`
+			Audiobook     struct {
+				Data struct {
+					Name      string     `json:"name"`
+					Uri       string     `json:"uri"`
+					Authors   []nameData `json:"authors"`
+					Narrators []nameData `json:"narrators"`
+					Publisher nameData   `json:"publisher"`
+					Series    []struct {
+						Name   string `json:"name"`
+						Number string `json:"number"`
+					} `json:"series"`
+					ReleaseDate struct {
+						IsoString string `json:"isoString"`
+					} `json:"releaseDate"`
+					Chapters struct {
+						TotalCount int `json:"totalCount"`
+					} `json:"chapters"`
+					CoverArt coverArtData `json:"coverArt"`
+				} `json:"data"`
+			} `json:"audiobookV2"`
 		} `json:"episodeUnionV2"`
 	} `json:"data"`
 }
 
+// coverArtData is the image list of a pathfinder response.
+type coverArtData struct {
+	Sources []struct {
+		URL    string `json:"url"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	} `json:"sources"`
+}
+
 type mediaManifest struct {
 	Media map[string]struct {
 		Item struct {
@@ -2,18 +2,46 @@ package spotify
 
 import (
 	"fmt"
-	"github.com/XiaoMengXinX/SimpleDownloader"
+	"github.com/XiaoMengXinX/spotdl/download"
 	log "github.com/XiaoMengXinX/spotdl/logger"
 	"github.com/XiaoMengXinX/spotdl/playplay"
 	widevine "github.com/iyear/gowidevine"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 )
 
-func (d *Downloader) downloadContent(ID string, content IDType) (outFilePath string, err error) {
-	var name, artist, fileID, format string
+// contentFile is a downloaded item whose output files are written but not
+// tagged yet.
+type contentFile struct {
+	ev       Event
+	metadata trackMetadata
+	episode  episodeMetadata
+	// loudness is set when ReplayGain analysis is enabled and succeeded.
+	loudness *loudness
+}
+
+func (d *Downloader) downloadContent(ID string, content IDType) (string, error) {
+	file, err := d.fetchContent(ID, content)
+	if err == nil {
+		err = d.tagContent(file, nil)
+	}
+	d.emitComplete(file.ev, err)
+	return file.ev.Path, err
+}
+
+// fetchContent downloads and decrypts an item and writes its output files.
+// The returned file is never nil so that failures can be reported with its
+// event.
+func (d *Downloader) fetchContent(ID string, content IDType) (file *contentFile, err error) {
+	var name, artist, album, number, disc, fileID, format string
 	var metadata trackMetadata
 
+	file = &contentFile{ev: Event{ID: ID, Type: content}}
+	ev := &file.ev
+
 	switch content {
 	case TRACK:
 		name, artist, fileID, metadata, err = d.getTrackMetadata(ID)
@@ -23,20 +51,36 @@ func (d *Downloader) downloadContent(ID string, content IDType) (outFilePath str
 					log.Errorf("Error while downloading track: %v", (*err).Error())
 				}
 			}(ID, &err)
-			return outFilePath, fmt.Errorf("failed to get metadata of trackID [%s]: %v", ID, err)
+			return file, fmt.Errorf("failed to get metadata of trackID [%s]: %v", ID, err)
+		}
+		album = metadata.Album.Name
+		artist = d.fileArtist(metadata)
+		if metadata.Number > 0 {
+			number = fmt.Sprintf("%02d", metadata.Number)
+		}
+		if metadata.DiscNumber > 0 {
+			disc = strconv.Itoa(metadata.DiscNumber)
 		}
-	case EPISODE:
-		name, artist, fileID, _, err = d.getEpisodeMetadata(ID)
+	case EPISODE, CHAPTER:
+		name, artist, fileID, file.episode, err = d.getEpisodeOrChapter(content, ID)
 		if err != nil {
 			defer func(ID string, err *error) {
 				if *err != nil {
-					log.Errorf("Error while downloading episode: %v", (*err).Error())
+					log.Errorf("Error while downloading %s: %v", content, (*err).Error())
 				}
 			}(ID, &err)
-			return outFilePath, fmt.Errorf("failed to get metadata of episodeID [%s]: %v", ID, err)
+			return file, fmt.Errorf("failed to get metadata of %sID [%s]: %v", content, ID, err)
+		}
+		episode := file.episode.Data.Episode
+		album = episode.Podcast.Data.Name
+		if content == CHAPTER {
+			album = episode.Audiobook.Data.Name
+			// Chapter numbers are padded to sort in order in the book folder.
+			width := max(2, len(strconv.Itoa(episode.Audiobook.Data.Chapters.TotalCount)))
+			number = fmt.Sprintf("%0*d", width, episode.ChapterNumber+1)
 		}
 	default:
-		return outFilePath, fmt.Errorf("invalid content type")
+		return file, fmt.Errorf("invalid content type")
 	}
 
 	switch {
@@ -47,13 +91,40 @@ func (d *Downloader) downloadContent(ID string, content IDType) (outFilePath str
 	}
 
 	fileName := cleanFilename(fmt.Sprintf("%s - %s", name, artist))
-	outFilePath = fmt.Sprintf("%s.%s", filepath.Join(d.outputFolder, fileName), format)
+	vars := map[string]string{"title": name, "artist": artist, "album": album, "track": number, "disc": disc, "id": ID}
+	targets := d.outputTargets(format, content)
+	paths := make([]string, len(targets))
+	for i, target := range targets {
+		if paths[i], err = d.targetPath(target, vars); err != nil {
+			return file, err
+		}
+		if j := slices.Index(paths[:i], paths[i]); j >= 0 {
+			return file, fmt.Errorf("output formats %s and %s write to the same file %s, give one its own template", targets[j].Format, target.Format, paths[i])
+		}
+		if err = checkDirExist(filepath.Dir(paths[i])); err != nil {
+			return file, err
+		}
+	}
+
+	// The decrypted file is kept if it is a target itself, or if it cannot
+	// be converted. Otherwise it only lives until the conversions are done.
+	sourcePath := ""
+	if i := slices.IndexFunc(targets, func(t Target) bool { return t.Format == format }); i >= 0 {
+		sourcePath = paths[i]
+	} else if !hasFFmpeg {
+		sourcePath = strings.TrimSuffix(paths[0], filepath.Ext(paths[0])) + "." + format
+	} else {
+		sourcePath = fmt.Sprintf("%s.source.%s", filepath.Join(d.outputFolder, fileName), format)
+		defer os.Remove(sourcePath)
+	}
 
 	log.Infof("Downloading %s [%s]", content, fileName)
+	ev.Name = fileName
+	d.emitStart(*ev)
 
-	err = d.downloadAndDecrypt(fileName, format, fileID)
+	err = d.downloadAndDecrypt(*ev, format, fileID, sourcePath)
 	if err != nil {
-		return outFilePath, err
+		return file, err
 	}
 
 	defer func(filename string, err *error) {
@@ -62,31 +133,90 @@ func (d *Downloader) downloadContent(ID string, content IDType) (outFilePath str
 		}
 	}(fileName, &err)
 
-	if hasFFmpeg {
-		if d.isConvertToMP3 {
-			mp3FilePath := fmt.Sprintf("%s.mp3", filepath.Join(d.outputFolder, fileName))
-			err = d.convertMp3(outFilePath, mp3FilePath)
-			_ = os.Remove(outFilePath)
-			if err != nil {
-				_ = os.Remove(mp3FilePath)
-				return outFilePath, err
+	var outputs []string
+	for i, target := range targets {
+		switch {
+		case target.Format == format:
+		case slices.Contains(sourceFormats, target.Format):
+			log.Warnf("Cannot convert %s to %s, skipped", format, target.Format)
+			continue
+		case !hasFFmpeg:
+			log.Warnf("ffmpeg not found, skip converting to %s", target.Format)
+			continue
+		default:
+			profile, _ := d.targetProfile(target.Format)
+			if err = d.transcode(sourcePath, paths[i], profile); err != nil {
+				_ = os.Remove(paths[i])
+				return file, err
 			}
+		}
+		outputs = append(outputs, paths[i])
+	}
+	if len(outputs) == 0 {
+		outputs = append(outputs, sourcePath)
+	}
+	ev.Path, ev.Paths = outputs[0], outputs
+	file.metadata = metadata
+
+	if content == TRACK && d.replayGainEnabled() {
+		// Analysis is optional; a failure only leaves the tags out.
+		if file.loudness, err = measureLoudness(sourcePath); err != nil {
+			log.Warnf("Failed to analyze loudness of [%s]: %v", fileName, err)
+			err = nil
+		}
+	}
+	return file, nil
+}
 
-			outFilePath = mp3FilePath
+// tagContent writes the metadata of file, with album loudness if it is part
+// of an album download.
+func (d *Downloader) tagContent(file *contentFile, album *loudness) (err error) {
+	defer func(filename string, err *error) {
+		if *err != nil {
+			log.Errorf("An error occurred while processing [%s]: %v", filename, (*err).Error())
+		}
+	}(file.ev.Name, &err)
+
+	var chapters []chapter
+	if file.ev.Type == EPISODE {
+		chapters = episodeChapters(file.episode)
+		log.Debugf("Chapters: %+v", chapters)
+		if err = d.writeChapterFile(file.ev.Path, file.ev.Name, chapters); err != nil {
+			return fmt.Errorf("failed to write chapter file: %v", err)
 		}
+	}
 
-		if !d.isSkipAddingMetadata && (d.isConvertToMP3 || format == "m4a") && content == TRACK {
-			err = d.addMetadata(metadata, outFilePath)
-			if err != nil {
-				return outFilePath, err
+	if file.ev.Type == TRACK && (d.creditsFile || d.output.Credits.File) {
+		if err = d.writeCreditsFile(file.ev.Path, file.ev.ID); err != nil {
+			return fmt.Errorf("failed to write credits file: %v", err)
+		}
+	}
+
+	if hasFFmpeg {
+		switch {
+		case d.isSkipAddingMetadata:
+		case file.ev.Type == TRACK:
+			var extra map[string]string
+			if file.loudness != nil {
+				extra = replayGainTags(file.loudness, album)
 			}
+			err = d.addMetadata(file.metadata, extra, file.ev.Paths...)
+		case file.ev.Type == EPISODE:
+			err = d.addEpisodeMetadata(file.ev.ID, file.episode, chapters, file.ev.Paths...)
+		case file.ev.Type == CHAPTER:
+			err = d.addChapterMetadata(file.ev.ID, file.episode, file.ev.Paths...)
 		}
-	} else {
-		if d.isConvertToMP3 {
-			log.Warnln("ffmpeg not found, skip converting to mp3")
+		if err != nil {
+			return err
 		}
-		if !d.isSkipAddingMetadata {
-			log.Warnln("ffmpeg not found, skip adding metadata")
+	} else if !d.isSkipAddingMetadata {
+		log.Warnln("ffmpeg not found, skip adding metadata")
+	}
+
+	if file.ev.Type == EPISODE && d.feedEnabled() {
+		// The feed is a convenience; the episode itself is complete.
+		if err := d.updateFeed(file); err != nil {
+			log.Warnf("Failed to update podcast feed: %v", err)
 		}
 	}
 
@@ -95,14 +225,16 @@ func (d *Downloader) downloadContent(ID string, content IDType) (outFilePath str
 		d.TokenManager.ConfigManager.Set(config)
 	}
 
-	log.Infof("Download complete for %s [%s]", content, fileName)
-	return
+	log.Infof("Download complete for %s [%s]", file.ev.Type, file.ev.Name)
+	return nil
 }
 
-func (d *Downloader) downloadAndDecrypt(fileName string, format string, fileID string) (err error) {
+// downloadAndDecrypt downloads fileID and writes the decrypted audio to
+// outFilePath.
+func (d *Downloader) downloadAndDecrypt(ev Event, format, fileID, outFilePath string) (err error) {
+	fileName := ev.Name
 	tmpFileName := fmt.Sprintf("%s.%s.tmp", fileName, format)
 	tmpFilePath := filepath.Join(d.outputFolder, tmpFileName)
-	outFilePath := fmt.Sprintf("%s.%s", filepath.Join(d.outputFolder, fileName), format)
 
 	defer func(filename string, filePath string, err *error) {
 		if *err != nil {
@@ -111,18 +243,14 @@ func (d *Downloader) downloadAndDecrypt(fileName string, format string, fileID s
 		}
 	}(fileName, outFilePath, &err)
 
-	cdnUrl, err := d.requestCDNURL(fileID)
+	// A failed download keeps the temp file and its progress to resume from.
+	err = d.downloadFromCDN(fileID, tmpFileName, func(p download.Progress) {
+		d.emitProgress(ev, p)
+	})
 	if err != nil {
 		return err
 	}
-
-	dl := downloader.NewDownloader().SetSavePath(d.outputFolder).SetDownloadRoutine(4)
-	task, _ := dl.NewDownloadTask(cdnUrl)
-	err = task.SetFileName(tmpFileName).Download()
 	defer os.Remove(tmpFilePath)
-	if err != nil {
-		return err
-	}
 
 	tmpFile, err := os.Open(tmpFilePath)
 	if err != nil {
@@ -138,7 +266,7 @@ func (d *Downloader) downloadAndDecrypt(fileName string, format string, fileID s
 
 	switch format {
 	case "m4a":
-		PSSH, err := requestPSSH(fileID)
+		PSSH, err := d.requestPSSH(fileID)
 		if err != nil {
 			return err
 		}
@@ -175,33 +303,76 @@ func (d *Downloader) DownloadEpisode(ID string) (downloadFilePath string, err er
 	return d.downloadContent(ID, EPISODE)
 }
 
+// DownloadChapter downloads a chapter of an audiobook.
+func (d *Downloader) DownloadChapter(ID string) (downloadFilePath string, err error) {
+	return d.downloadContent(ID, CHAPTER)
+}
+
+// Download downloads everything behind url, parsed with ParseInput.
 func (d *Downloader) Download(url string) (err error) {
-	tracks, err := d.GetTracks(url)
+	id, idType, err := ParseInput(url)
 	if err != nil {
 		return fmt.Errorf("failed to get tracks: %v", err)
 	}
+	log.Debugf("Track type: %s", idType)
 
-	if len(tracks) == 0 {
-		return fmt.Errorf("no tracks to download")
+	total, tracks, err := d.tracks(id, idType)
+	if err != nil {
+		return fmt.Errorf("failed to get tracks: %v", err)
 	}
 
-	_, idType, _ := GetIDType(url)
-	log.Debugf("Track type: %s", idType)
+	if total == 0 {
+		return fmt.Errorf("no tracks to download")
+	}
 
 	switch idType {
-	case TRACK, ALBUM, PLAYLIST, SHOW, EPISODE:
+	case TRACK, ALBUM, PLAYLIST, SHOW, EPISODE, AUDIOBOOK, CHAPTER:
 	default:
 		return fmt.Errorf("unsupported type: %s", idType)
 	}
 
-	log.Infof("Downloading %d track(s)", len(tracks))
+	log.Infof("Downloading %d track(s)", total)
 
-	for _, track := range tracks {
+	// Album gain needs every track measured, so album tracks are tagged
+	// once all of them are downloaded.
+	albumGain := idType == ALBUM && d.replayGainEnabled()
+	var pending []*contentFile
+
+	var n int
+	for track, err := range tracks {
+		if err != nil {
+			return fmt.Errorf("failed to get tracks: %v", err)
+		}
+		n++
+		log.Infof("Processing %d/%d", n, total)
 		switch idType {
 		case TRACK, ALBUM, PLAYLIST:
+			if albumGain {
+				file, err := d.fetchContent(track, TRACK)
+				if err != nil {
+					d.emitComplete(file.ev, err)
+					continue
+				}
+				pending = append(pending, file)
+				continue
+			}
 			_, _ = d.DownloadTrack(track)
 		case SHOW, EPISODE:
 			_, _ = d.DownloadEpisode(track)
+		case AUDIOBOOK, CHAPTER:
+			_, _ = d.DownloadChapter(track)
+		}
+	}
+
+	if len(pending) > 0 {
+		measured := make([]*loudness, len(pending))
+		for i, file := range pending {
+			measured[i] = file.loudness
+		}
+		album := albumLoudness(measured)
+		log.Debugf("Album loudness: %+v", album)
+		for _, file := range pending {
+			d.emitComplete(file.ev, d.tagContent(file, album))
 		}
 	}
 	return nil
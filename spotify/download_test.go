@@ -0,0 +1,312 @@
+package spotify_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+	"github.com/XiaoMengXinX/spotdl/spotify"
+)
+
+// newTestDownloader returns an initialized downloader for srv and its output
+// directory. Entries of config replace the top-level config file sections.
+func newTestDownloader(t *testing.T, srv *spotifytest.Server, config ...map[string]any) (*spotify.Downloader, string) {
+	t.Helper()
+	d, outputDir := configureTestDownloader(t, srv, config...)
+	d.Initialize()
+	return d, outputDir
+}
+
+// configureTestDownloader is newTestDownloader without Initialize.
+func configureTestDownloader(t *testing.T, srv *spotifytest.Server, config ...map[string]any) (*spotify.Downloader, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	configPath := filepath.Join(dir, "config.json")
+	sections := map[string]any{
+		"sp_dc": "spotifytest",
+		"totp":  map[string]any{"secret": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "version": 1},
+		// Tests make hundreds of requests to one host.
+		"rateLimit": map[string]any{"disabled": true},
+	}
+	for _, c := range config {
+		maps.Copy(sections, c)
+	}
+	conf, _ := json.Marshal(sections)
+	if err := os.WriteFile(configPath, conf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := filepath.Join(dir, "output")
+	d := spotify.NewDownloader(srv.Endpoints())
+	d.TokenManager.ConfigManager.SetConfigPath(configPath)
+	d.SetOutputPath(outputDir)
+	d.SkipAddingMetadata(true)
+	return d, outputDir
+}
+
+func newTestServer(t *testing.T) (*spotifytest.Server, *spotifytest.Fixtures) {
+	t.Helper()
+	fixtures := spotifytest.NewFixtures()
+	srv := spotifytest.NewServer(fixtures)
+	t.Cleanup(srv.Close)
+	return srv, fixtures
+}
+
+func trackFile(outputDir string, f *spotifytest.Fixtures, id string) string {
+	track := f.Tracks[id]
+	return filepath.Join(outputDir, fmt.Sprintf("%s - %s.m4a", track.Name, track.Artists[0].Name))
+}
+
+func episodeFile(outputDir string, f *spotifytest.Fixtures, id string) string {
+	episode := f.Episodes[id]
+	show := f.Shows[episode.ShowID]
+	return filepath.Join(outputDir, fmt.Sprintf("%s - %s.m4a", episode.Name, show.Name))
+}
+
+func assertAudioFile(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected output file: %v", err)
+	}
+	if !bytes.Equal(data, spotifytest.Audio()) {
+		t.Fatalf("%s: decrypted audio does not match fixture (%d bytes, want %d)", path, len(data), len(spotifytest.Audio()))
+	}
+}
+
+func TestDownloadTrack(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Single", 1)
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download(spotifytest.URL("track", album.TrackIDs[0])); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	assertAudioFile(t, trackFile(out, fixtures, album.TrackIDs[0]))
+
+	if n := srv.Hits("token"); n != 1 {
+		t.Errorf("token endpoint hit %d times, want 1", n)
+	}
+	if n := srv.Hits("license"); n != 1 {
+		t.Errorf("license endpoint hit %d times, want 1", n)
+	}
+}
+
+func TestDownloadTrackURIAndID(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Forms", 2)
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download("spotify:track:" + album.TrackIDs[0]); err != nil {
+		t.Fatalf("Download URI: %v", err)
+	}
+	if err := d.Download(album.TrackIDs[1]); err != nil {
+		t.Fatalf("Download ID: %v", err)
+	}
+	for _, id := range album.TrackIDs {
+		assertAudioFile(t, trackFile(out, fixtures, id))
+	}
+}
+
+func TestDownloadAlbum(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	// 53 tracks span two 50-item pages.
+	album := fixtures.AddAlbum("Long Album", 53)
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download(spotifytest.URL("album", album.ID)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	for _, id := range album.TrackIDs {
+		assertAudioFile(t, trackFile(out, fixtures, id))
+	}
+	if n := srv.Hits("web-album-tracks"); n != 2 {
+		t.Errorf("album tracks fetched in %d pages, want 2", n)
+	}
+}
+
+func TestDownloadPlaylist(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	a := fixtures.AddAlbum("First", 3)
+	b := fixtures.AddAlbum("Second", 2)
+	ids := []string{a.TrackIDs[0], "", b.TrackIDs[1], a.TrackIDs[2]}
+	playlist := fixtures.AddPlaylist("Mix", ids)
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download(spotifytest.URL("playlist", playlist.ID)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		assertAudioFile(t, trackFile(out, fixtures, id))
+	}
+	if _, err := os.Stat(trackFile(out, fixtures, a.TrackIDs[1])); !os.IsNotExist(err) {
+		t.Errorf("track outside the playlist was downloaded")
+	}
+}
+
+func TestDownloadShow(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	show := fixtures.AddShow("Podcast", 3)
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download(spotifytest.URL("show", show.ID)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	for _, id := range show.EpisodeIDs {
+		assertAudioFile(t, episodeFile(out, fixtures, id))
+	}
+}
+
+func TestDownloadEpisode(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	show := fixtures.AddShow("Talk", 2)
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download(spotifytest.URL("episode", show.EpisodeIDs[1])); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	assertAudioFile(t, episodeFile(out, fixtures, show.EpisodeIDs[1]))
+	if _, err := os.Stat(episodeFile(out, fixtures, show.EpisodeIDs[0])); !os.IsNotExist(err) {
+		t.Errorf("unrequested episode was downloaded")
+	}
+}
+
+func TestGetTracksPagination(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Catalogue", 250)
+	playlist := fixtures.AddPlaylist("Everything", album.TrackIDs)
+	show := fixtures.AddShow("Archive", 120)
+	d, _ := newTestDownloader(t, srv)
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{spotifytest.URL("album", album.ID), album.TrackIDs},
+		{spotifytest.URL("playlist", playlist.ID), playlist.TrackIDs},
+		{spotifytest.URL("show", show.ID), show.EpisodeIDs},
+	}
+	for _, tt := range tests {
+		got, err := d.GetTracks(tt.url)
+		if err != nil {
+			t.Fatalf("GetTracks(%s): %v", tt.url, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("GetTracks(%s) returned %d items, want %d", tt.url, len(got), len(tt.want))
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("GetTracks(%s)[%d] = %s, want %s", tt.url, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	empty := fixtures.AddAlbum("Empty", 0)
+	d, _ := newTestDownloader(t, srv)
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"missing playlist", spotifytest.URL("playlist", fixtures.NewID())},
+		{"missing album", spotifytest.URL("album", fixtures.NewID())},
+		{"missing show", spotifytest.URL("show", fixtures.NewID())},
+		{"empty album", spotifytest.URL("album", empty.ID)},
+		{"unsupported type", spotifytest.URL("artist", fixtures.NewID())},
+		{"invalid domain", "https://example.com/track/" + fixtures.NewID()},
+		{"empty id", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := d.Download(tt.url); err == nil {
+				t.Errorf("Download(%q) succeeded, want error", tt.url)
+			}
+		})
+	}
+}
+
+func TestDownloadSkipsFailedTracks(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Partial", 3)
+	fixtures.Tracks[album.TrackIDs[1]].Unavailable = true
+	missing := fixtures.NewID()
+	playlist := fixtures.AddPlaylist("Broken", []string{album.TrackIDs[0], missing, album.TrackIDs[1], album.TrackIDs[2]})
+	d, out := newTestDownloader(t, srv)
+
+	if err := d.Download(spotifytest.URL("playlist", playlist.ID)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	assertAudioFile(t, trackFile(out, fixtures, album.TrackIDs[0]))
+	assertAudioFile(t, trackFile(out, fixtures, album.TrackIDs[2]))
+	if _, err := os.Stat(trackFile(out, fixtures, album.TrackIDs[1])); !os.IsNotExist(err) {
+		t.Errorf("unavailable track produced an output file")
+	}
+	if _, err := d.DownloadTrack(missing); err == nil {
+		t.Errorf("DownloadTrack of a missing track succeeded")
+	}
+}
+
+func TestStaticTokenSource(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Static", 1)
+	d, out := newTestDownloader(t, srv)
+	srv.ResetHits()
+
+	d.SetTokenSource(staticToken())
+	if err := d.Download(spotifytest.URL("track", album.TrackIDs[0])); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	assertAudioFile(t, trackFile(out, fixtures, album.TrackIDs[0]))
+	if n := srv.Hits("token"); n != 0 {
+		t.Errorf("token endpoint hit %d times with a static token source", n)
+	}
+}
+
+func TestDownloadHooks(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Hooks", 1)
+	id := album.TrackIDs[0]
+	d, out := newTestDownloader(t, srv)
+	d.SetSegments(2, 1024)
+
+	var started, completed []spotify.Event
+	var last spotify.ProgressEvent
+	d.SetHooks(spotify.Hooks{
+		OnStart:    func(ev spotify.Event) { started = append(started, ev) },
+		OnProgress: func(ev spotify.ProgressEvent) { last = ev },
+		OnComplete: func(ev spotify.Event, err error) {
+			if err != nil {
+				t.Errorf("OnComplete error: %v", err)
+			}
+			completed = append(completed, ev)
+		},
+	})
+
+	if _, err := d.DownloadTrack(id); err != nil {
+		t.Fatalf("DownloadTrack: %v", err)
+	}
+	if len(started) != 1 || started[0].ID != id || started[0].Type != spotify.TRACK {
+		t.Errorf("OnStart calls = %+v", started)
+	}
+	if size := int64(len(spotifytest.Audio())); last.Written != size || last.Total != size {
+		t.Errorf("last progress = %d/%d, want %d/%d", last.Written, last.Total, size, size)
+	}
+	if last.Rate <= 0 {
+		t.Errorf("last progress rate = %v, want > 0", last.Rate)
+	}
+	if len(completed) != 1 || completed[0].Path != trackFile(out, fixtures, id) {
+		t.Errorf("OnComplete calls = %+v", completed)
+	}
+}
@@ -0,0 +1,143 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileDuration returns the length of an audio file from its headers, or 0
+// if it is not known. MP3 files only have a length if it is tagged.
+func fileDuration(path string, tags map[string]string) time.Duration {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".mp3" {
+		ms, _ := strconv.Atoi(tags["LENGTH"])
+		return time.Duration(ms) * time.Millisecond
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	switch ext {
+	case ".wav":
+		return wavDuration(data)
+	case ".flac":
+		return flacDuration(data)
+	case ".ogg", ".opus":
+		return oggDuration(data)
+	case ".m4a":
+		return mp4Duration(data)
+	}
+	return 0
+}
+
+func wavDuration(data []byte) time.Duration {
+	chunks, err := readWavChunks(data)
+	if err != nil {
+		return 0
+	}
+	var byteRate, size int
+	for _, c := range chunks {
+		switch {
+		case c.id == "fmt " && len(c.data) >= 12:
+			byteRate = int(binary.LittleEndian.Uint32(c.data[8:12]))
+		case c.id == "data":
+			size = len(c.data)
+		}
+	}
+	if byteRate == 0 {
+		return 0
+	}
+	return time.Duration(size) * time.Second / time.Duration(byteRate)
+}
+
+// flacDuration reads the sample rate and sample count of the STREAMINFO
+// block, which comes first.
+func flacDuration(data []byte) time.Duration {
+	if !bytes.HasPrefix(data, []byte("fLaC")) || len(data) < 8+18 || data[4]&0x7f != 0 {
+		return 0
+	}
+	info := data[8:]
+	rate := int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4
+	samples := int64(info[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(info[14:18]))
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(samples) * time.Second / time.Duration(rate)
+}
+
+// oggDuration reads the granule position of the last page of the first
+// stream, which counts samples at 48 kHz after the pre-skip for Opus and at
+// the sample rate for Vorbis.
+func oggDuration(data []byte) time.Duration {
+	pages, err := readOggPages(data)
+	if err != nil {
+		return 0
+	}
+	_, packets, err := oggHeaders(pages)
+	if err != nil {
+		return 0
+	}
+	var rate, skip int64
+	switch head := packets[0]; {
+	case bytes.HasPrefix(head, []byte("OpusHead")) && len(head) >= 12:
+		rate, skip = 48000, int64(binary.LittleEndian.Uint16(head[10:12]))
+	case bytes.HasPrefix(head, []byte("\x01vorbis")) && len(head) >= 16:
+		rate = int64(binary.LittleEndian.Uint32(head[12:16]))
+	}
+	if rate == 0 {
+		return 0
+	}
+	for i := len(pages) - 1; i >= 0; i-- {
+		// Pages no packet ends on have no granule position.
+		if pages[i].serial == pages[0].serial && pages[i].granule != ^uint64(0) {
+			return time.Duration(max(int64(pages[i].granule)-skip, 0)) * time.Second / time.Duration(rate)
+		}
+	}
+	return 0
+}
+
+// mp4Duration reads the duration of the movie header box.
+func mp4Duration(data []byte) time.Duration {
+	mvhd := mp4ChildBox(mp4ChildBox(data, "moov"), "mvhd")
+	var scale, duration uint64
+	switch {
+	case len(mvhd) >= 20 && mvhd[0] == 0:
+		scale, duration = uint64(binary.BigEndian.Uint32(mvhd[12:16])), uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	case len(mvhd) >= 32 && mvhd[0] == 1:
+		scale, duration = uint64(binary.BigEndian.Uint32(mvhd[20:24])), binary.BigEndian.Uint64(mvhd[24:32])
+	}
+	if scale == 0 {
+		return 0
+	}
+	return time.Duration(duration) * time.Second / time.Duration(scale)
+}
+
+// mp4ChildBox returns the payload of the first box of a kind in data.
+func mp4ChildBox(data []byte, kind string) []byte {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil
+			}
+			size, header = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil
+		}
+		if string(data[4:8]) == kind {
+			return data[header:size]
+		}
+		data = data[size:]
+	}
+	return nil
+}
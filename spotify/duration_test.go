@@ -0,0 +1,57 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFileDuration(t *testing.T) {
+	dir := t.TempDir()
+
+	// 441000 samples of 16-bit stereo at 44.1 kHz, after the block and frame
+	// sizes.
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint64(streamInfo[10:18], 44100<<44|1<<41|15<<36|441000)
+	flac := slices.Concat([]byte("fLaC\x80\x00\x00\x22"), streamInfo)
+
+	fmtChunk := make([]byte, 16)
+	binary.LittleEndian.PutUint32(fmtChunk[8:12], 1000)
+	wav := writeWavChunks([]riffChunk{{"fmt ", fmtChunk}, {"data", make([]byte, 2500)}})
+
+	opusHead := append([]byte("OpusHead\x01\x02"), binary.LittleEndian.AppendUint16(nil, 312)...)
+	opusTags := append([]byte("OpusTags"), vorbisCommentBlock("ffmpeg")...)
+	audio := paginateOgg(5, 2, [][]byte{[]byte("frame")})[0]
+	audio.granule = 3*48000 + 312
+	opus := slices.Concat(oggPages(5, opusHead), oggPages(5, opusTags), audio.bytes())
+
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 4000)
+	m4a := slices.Concat(mp4Box("ftyp", []byte("M4A ")), mp4Box("moov", mp4Box("mvhd", mvhd)))
+
+	for name, tt := range map[string]struct {
+		data []byte
+		tags map[string]string
+		want time.Duration
+	}{
+		"song.flac": {flac, nil, 10 * time.Second},
+		"song.wav":  {wav, nil, 2500 * time.Millisecond},
+		"song.opus": {opus, nil, 3 * time.Second},
+		"song.m4a":  {m4a, nil, 4 * time.Second},
+		"song.mp3":  {bytes.Repeat([]byte{0xff}, 64), map[string]string{"LENGTH": "180500"}, 180500 * time.Millisecond},
+		"bare.mp3":  {bytes.Repeat([]byte{0xff}, 64), nil, 0},
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := fileDuration(path, tt.tags); got != tt.want {
+			t.Errorf("fileDuration(%s) = %v, want %v", name, got, tt.want)
+		}
+	}
+}
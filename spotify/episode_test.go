@@ -0,0 +1,81 @@
+package spotify_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+)
+
+func TestEpisodeTags(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	show := fixtures.AddShow("Talk", 1)
+	episode := fixtures.Episodes[show.EpisodeIDs[0]]
+	d, out := newTestDownloader(t, srv)
+
+	tags, err := d.EpisodeTags(episode.ID)
+	if err != nil {
+		t.Fatalf("EpisodeTags: %v", err)
+	}
+	for key, want := range map[string]string{
+		"title":        episode.Name,
+		"artist":       show.Publisher,
+		"album":        show.Name,
+		"album_artist": show.Publisher,
+		"show":         show.Name,
+		"date":         episode.ReleaseDate[:10],
+		"description":  episode.Description,
+		"synopsis":     episode.Description,
+		"genre":        "Podcast",
+		"media_type":   "21",
+		"podcast":      "1",
+		"episode_id":   episode.ID,
+		"length":       strconv.Itoa(episode.DurationMS),
+	} {
+		if tags[key] != want {
+			t.Errorf("tag %s = %q, want %q", key, tags[key], want)
+		}
+	}
+
+	cover, err := d.DownloadEpisodeCover(episode.ID)
+	if err != nil {
+		t.Fatalf("DownloadEpisodeCover: %v", err)
+	}
+	if want := episode.CoverID + "640.jpg"; cover != want {
+		t.Errorf("cover file = %s, want the largest image %s", cover, want)
+	}
+	if _, err := os.Stat(filepath.Join(out, cover)); err != nil {
+		t.Errorf("cover not downloaded: %v", err)
+	}
+}
+
+func TestEpisodeChapterFile(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	show := fixtures.AddShow("Chapters", 2)
+	fromAPI, fromDescription := fixtures.Episodes[show.EpisodeIDs[0]], fixtures.Episodes[show.EpisodeIDs[1]]
+	fromAPI.Chapters = []spotifytest.Chapter{{Title: "Opening", StartMS: 0}, {Title: "News", StartMS: 61000}}
+	fromDescription.Description = "Today:\n0:00 Hello\n5:30 Goodbye"
+	d, _ := newTestDownloader(t, srv, map[string]any{
+		"output": map[string]any{"chapterFile": "txt"},
+	})
+
+	for episode, want := range map[*spotifytest.Episode]string{
+		fromAPI:         "00:00:00 Opening\n00:01:01 News\n",
+		fromDescription: "00:00:00 Hello\n00:05:30 Goodbye\n",
+	} {
+		path, err := d.DownloadEpisode(episode.ID)
+		if err != nil {
+			t.Fatalf("DownloadEpisode: %v", err)
+		}
+		got, err := os.ReadFile(strings.TrimSuffix(path, ".m4a") + ".chapters.txt")
+		if err != nil {
+			t.Fatalf("chapter file: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("chapters of %s = %q, want %q", episode.Name, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package spotify
+
+import "time"
+
+// Hooks for the external tests in spotify_test.
+
+func (d *Downloader) PrefetchMetadata(trackIDs []string) {
+	d.prefetchMetadata(trackIDs)
+}
+
+func (d *Downloader) TrackTags(trackID string) (map[string]string, error) {
+	_, _, _, trackMD, err := d.getTrackMetadata(trackID)
+	if err != nil {
+		return nil, err
+	}
+	return d.buildMetadata(trackMD)
+}
+
+func (d *Downloader) EpisodeTags(episodeID string) (map[string]string, error) {
+	_, _, _, episodeMD, err := d.getEpisodeMetadata(episodeID)
+	if err != nil {
+		return nil, err
+	}
+	return buildEpisodeMetadata(episodeID, episodeMD), nil
+}
+
+func (d *Downloader) DownloadEpisodeCover(episodeID string) (string, error) {
+	_, _, _, episodeMD, err := d.getEpisodeMetadata(episodeID)
+	if err != nil {
+		return "", err
+	}
+	return d.downloadEpisodeCover(episodeMD)
+}
+
+func (d *Downloader) ChapterTags(chapterID string) (map[string]string, error) {
+	_, _, _, chapterMD, err := d.getEpisodeOrChapter(CHAPTER, chapterID)
+	if err != nil {
+		return nil, err
+	}
+	return buildChapterMetadata(chapterID, chapterMD), nil
+}
+
+// ClientBaseHealth is what the client base pool knows about a host.
+type ClientBaseHealth struct {
+	Successes    int
+	Latency      time.Duration
+	EvictedUntil time.Time
+}
+
+func NewClientBaseDownloader(bases ...string) *Downloader {
+	return &Downloader{clientBases: newClientBasePool(bases)}
+}
+
+func (d *Downloader) ReportClientBaseFailure(base string) {
+	d.clientBases.reportFailure(base)
+}
+
+func (d *Downloader) ClientBaseHealth(base string) ClientBaseHealth {
+	d.clientBases.mu.Lock()
+	defer d.clientBases.mu.Unlock()
+	host := d.clientBases.host(base)
+	return ClientBaseHealth{Successes: host.successes, Latency: host.latency, EvictedUntil: host.evictedUntil}
+}
+
+func (d *Downloader) WithClientBase(fn func(base string) error) error {
+	return d.withClientBase(fn)
+}
+
+func NewStatusError(url string, statusCode int) error {
+	return &statusError{URL: url, StatusCode: statusCode}
+}
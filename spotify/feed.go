@@ -0,0 +1,274 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	log "github.com/XiaoMengXinX/spotdl/logger"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// feedFile is the name of the podcast feed in a show folder.
+	feedFile = "feed.xml"
+	// feedCover is the name of the show artwork next to the feed.
+	feedCover       = "cover.jpg"
+	itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Description string       `xml:"description"`
+	Generator   string       `xml:"generator"`
+	Image       *rssImage    `xml:"image"`
+	Author      string       `xml:"itunes:author,omitempty"`
+	ITunesImage *itunesImage `xml:"itunes:image"`
+	Explicit    string       `xml:"itunes:explicit"`
+	Items       []feedItem   `xml:"item"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssItem struct {
+	XMLName     xml.Name     `xml:"item"`
+	Title       string       `xml:"title"`
+	Description string       `xml:"description"`
+	PubDate     string       `xml:"pubDate,omitempty"`
+	GUID        rssGUID      `xml:"guid"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	Duration    string       `xml:"itunes:duration,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// feedItem is an item kept as raw XML, so that items written by earlier runs
+// are preserved as they are when the feed is updated.
+type feedItem struct {
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Inner   []byte `xml:",innerxml"`
+}
+
+func (i feedItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(struct {
+		Inner []byte `xml:",innerxml"`
+	}{bytes.TrimSpace(i.Inner)}, start)
+}
+
+// WritePodcastFeed keeps an RSS feed of the downloaded episodes in the
+// folder they are written to, for podcast apps to subscribe to.
+func (d *Downloader) WritePodcastFeed(b bool) *Downloader {
+	d.feed = b
+	return d
+}
+
+// SetFeedBaseURL sets the URL the output folder is served at. Enclosure and
+// artwork URLs in feeds are relative to it.
+func (d *Downloader) SetFeedBaseURL(baseURL string) *Downloader {
+	d.feedBaseURL = baseURL
+	return d
+}
+
+func (d *Downloader) feedEnabled() bool {
+	return d.feed || d.output.Feed.Enabled
+}
+
+// feedURL returns the URL of path, which is inside the output folder.
+func (d *Downloader) feedURL(path string) string {
+	base := d.feedBaseURL
+	if base == "" {
+		base = d.output.Feed.BaseURL
+	}
+	rel, err := filepath.Rel(d.outputFolder, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	if base == "" {
+		return strings.Join(segments, "/")
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.Join(segments, "/")
+}
+
+// updateFeed adds a downloaded episode to the feed in its folder, replacing
+// an earlier entry of the same episode.
+func (d *Downloader) updateFeed(file *contentFile) error {
+	episode := file.episode.Data.Episode
+	show := episode.Podcast.Data
+	dir := filepath.Dir(file.ev.Path)
+	path := filepath.Join(dir, feedFile)
+	showLink := spotifyLink(show.Uri)
+
+	var existing struct {
+		Channel struct {
+			Link  string     `xml:"link"`
+			Items []feedItem `xml:"item"`
+		} `xml:"channel"`
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := xml.Unmarshal(data, &existing); err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		if existing.Channel.Link != showLink {
+			return fmt.Errorf("%s belongs to another show, give shows their own folder with a template like {album}/{title}", path)
+		}
+	}
+
+	item, err := d.feedItem(file)
+	if err != nil {
+		return err
+	}
+	items := slices.DeleteFunc(existing.Channel.Items, func(i feedItem) bool { return i.GUID == item.GUID })
+	items = append(items, item)
+	slices.SortStableFunc(items, func(a, b feedItem) int {
+		ta, _ := time.Parse(time.RFC1123Z, a.PubDate)
+		tb, _ := time.Parse(time.RFC1123Z, b.PubDate)
+		return tb.Compare(ta)
+	})
+
+	author := show.Publisher.Name
+	if author == "" {
+		author = episode.Creator
+	}
+	// The description is required by RSS, so a show without one gets an
+	// empty element.
+	channel := rssChannel{
+		Title:       show.Name,
+		Link:        showLink,
+		Description: show.Description,
+		Generator:   "spotdl",
+		Author:      author,
+		Explicit:    "false",
+		Items:       items,
+	}
+	if cover := d.feedArtwork(file.episode, dir); cover != "" {
+		channel.Image = &rssImage{URL: cover, Title: show.Name, Link: showLink}
+		channel.ITunesImage = &itunesImage{Href: cover}
+	}
+
+	data, err := xml.MarshalIndent(rssFeed{Version: "2.0", ITunes: itunesNamespace, Channel: channel}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode feed: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append([]byte(xml.Header), append(data, '\n')...), 0644); err != nil {
+		return err
+	}
+	log.Debugf("Updated feed [%s] with %d episode(s)", path, len(items))
+	return os.Rename(tmp, path)
+}
+
+// feedItem builds the feed entry of a downloaded episode.
+func (d *Downloader) feedItem(file *contentFile) (feedItem, error) {
+	episode := file.episode.Data.Episode
+	info, err := os.Stat(file.ev.Path)
+	if err != nil {
+		return feedItem{}, err
+	}
+
+	item := rssItem{
+		Title:       episode.Name,
+		Description: episode.Description,
+		GUID:        rssGUID{Value: fmt.Sprintf("spotify:episode:%s", file.ev.ID)},
+		Enclosure: rssEnclosure{
+			URL:    d.feedURL(file.ev.Path),
+			Length: info.Size(),
+			Type:   audioMIMEType(file.ev.Path),
+		},
+	}
+	if date, err := time.Parse(time.RFC3339, episode.ReleaseDate.IsoString); err == nil {
+		item.PubDate = date.Format(time.RFC1123Z)
+	}
+	if ms := episode.Duration.TotalMilliseconds; ms > 0 {
+		item.Duration = formatTimestamp(time.Duration(ms) * time.Millisecond)
+	}
+
+	data, err := xml.Marshal(item)
+	if err != nil {
+		return feedItem{}, fmt.Errorf("failed to encode feed item: %v", err)
+	}
+	var raw feedItem
+	err = xml.Unmarshal(data, &raw)
+	return raw, err
+}
+
+// feedArtwork downloads the show artwork next to the feed unless it is
+// there already, and returns its URL.
+func (d *Downloader) feedArtwork(episodeMD episodeMetadata, dir string) string {
+	path := filepath.Join(dir, feedCover)
+	if _, err := os.Stat(path); err != nil {
+		// Prefer the show's artwork over the episode's.
+		if len(episodeMD.Data.Episode.Podcast.Data.CoverArt.Sources) > 0 {
+			episodeMD.Data.Episode.CoverArt.Sources = nil
+		}
+		name, err := d.downloadEpisodeCover(episodeMD)
+		if err != nil {
+			log.Warnf("Failed to download show artwork: %v", err)
+			return ""
+		}
+		if err := os.Rename(filepath.Join(d.outputFolder, name), path); err != nil {
+			log.Warnf("Failed to save show artwork: %v", err)
+			return ""
+		}
+	}
+	return d.feedURL(path)
+}
+
+// spotifyLink turns a Spotify URI into an open.spotify.com link.
+func spotifyLink(uri string) string {
+	parts := strings.Split(uri, ":")
+	if len(parts) != 3 {
+		return "https://open.spotify.com/"
+	}
+	return fmt.Sprintf("https://open.spotify.com/%s/%s", parts[1], parts[2])
+}
+
+func audioMIMEType(path string) string {
+	switch filepath.Ext(path) {
+	case ".mp3":
+		return "audio/mpeg"
+	case ".m4a":
+		return "audio/mp4"
+	case ".ogg", ".opus":
+		return "audio/ogg"
+	case ".flac":
+		return "audio/flac"
+	case ".wav":
+		return "audio/wav"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,124 @@
+package spotify_test
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+)
+
+type testFeed struct {
+	Version string `xml:"version,attr"`
+	Channel struct {
+		Title       string  `xml:"title"`
+		Link        string  `xml:"link"`
+		Description *string `xml:"description"`
+		Image       struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		Items []struct {
+			Title     string `xml:"title"`
+			GUID      string `xml:"guid"`
+			PubDate   string `xml:"pubDate"`
+			Duration  string `xml:"duration"`
+			Enclosure struct {
+				URL    string `xml:"url,attr"`
+				Length int64  `xml:"length,attr"`
+				Type   string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+func readFeed(t *testing.T, path string) testFeed {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("feed: %v", err)
+	}
+	var feed testFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		t.Fatalf("invalid feed: %v\n%s", err, data)
+	}
+	return feed
+}
+
+func TestPodcastFeed(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	show := fixtures.AddShow("Cast", 2)
+	d, out := newTestDownloader(t, srv, map[string]any{
+		"output": map[string]any{
+			"template": "{album}/{title}",
+			"feed":     map[string]any{"enabled": true, "baseUrl": "http://nas.local/pod/"},
+		},
+	})
+
+	if err := d.Download(spotifytest.URL("show", show.ID)); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	feedPath := filepath.Join(out, "Cast", "feed.xml")
+	feed := readFeed(t, feedPath)
+	if feed.Version != "2.0" || feed.Channel.Title != "Cast" || feed.Channel.Link != "https://open.spotify.com/show/"+show.ID {
+		t.Errorf("channel = %s %q %s", feed.Version, feed.Channel.Title, feed.Channel.Link)
+	}
+	if feed.Channel.Description == nil || *feed.Channel.Description != show.Description {
+		t.Errorf("channel description = %v, want %q", feed.Channel.Description, show.Description)
+	}
+	if want := "http://nas.local/pod/Cast/cover.jpg"; feed.Channel.Image.Href != want {
+		t.Errorf("artwork = %s, want %s", feed.Channel.Image.Href, want)
+	}
+	if _, err := os.Stat(filepath.Join(out, "Cast", "cover.jpg")); err != nil {
+		t.Errorf("artwork not saved: %v", err)
+	}
+
+	if len(feed.Channel.Items) != 2 {
+		t.Fatalf("feed has %d items, want 2", len(feed.Channel.Items))
+	}
+	// Newest first.
+	latest := feed.Channel.Items[0]
+	episode := fixtures.Episodes[show.EpisodeIDs[1]]
+	if latest.Title != episode.Name || latest.GUID != "spotify:episode:"+episode.ID {
+		t.Errorf("first item = %q %s, want %q", latest.Title, latest.GUID, episode.Name)
+	}
+	if latest.PubDate != "Tue, 02 Jan 2024 06:00:00 +0000" || latest.Duration != "00:30:00" {
+		t.Errorf("item date and duration = %s, %s", latest.PubDate, latest.Duration)
+	}
+	if want := "http://nas.local/pod/Cast/Cast%20Episode%202.m4a"; latest.Enclosure.URL != want {
+		t.Errorf("enclosure = %s, want %s", latest.Enclosure.URL, want)
+	}
+	info, err := os.Stat(filepath.Join(out, "Cast", "Cast Episode 2.m4a"))
+	if err != nil || latest.Enclosure.Length != info.Size() || latest.Enclosure.Type != "audio/mp4" {
+		t.Errorf("enclosure length and type = %d %s (%v)", latest.Enclosure.Length, latest.Enclosure.Type, err)
+	}
+
+	// New episodes are added; downloading one again does not duplicate it.
+	fixtures.Shows[show.ID].EpisodeIDs = append(show.EpisodeIDs, fixtures.AddShow("Other", 1).EpisodeIDs[0])
+	added := fixtures.Episodes[show.EpisodeIDs[2]]
+	added.ShowID, added.ReleaseDate = show.ID, "2024-02-01T06:00:00Z"
+	for _, id := range []string{added.ID, show.EpisodeIDs[0]} {
+		if _, err := d.DownloadEpisode(id); err != nil {
+			t.Fatalf("DownloadEpisode: %v", err)
+		}
+	}
+	feed = readFeed(t, feedPath)
+	var titles []string
+	for _, item := range feed.Channel.Items {
+		titles = append(titles, item.Title)
+	}
+	if want := []string{added.Name, "Cast Episode 2", "Cast Episode 1"}; !slices.Equal(titles, want) {
+		t.Errorf("items = %q, want %q", titles, want)
+	}
+
+	// A show without a description keeps an empty channel description.
+	quiet := fixtures.AddShow("Quiet", 1)
+	quiet.Description = ""
+	if _, err := d.DownloadEpisode(quiet.EpisodeIDs[0]); err != nil {
+		t.Fatalf("DownloadEpisode: %v", err)
+	}
+	if feed = readFeed(t, filepath.Join(out, "Quiet", "feed.xml")); feed.Channel.Description == nil || *feed.Channel.Description != "" {
+		t.Errorf("channel description = %v, want an empty element", feed.Channel.Description)
+	}
+}
@@ -1,14 +1,25 @@
 package spotify
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"github.com/Sorrow446/go-mp4tag"
+	"github.com/XiaoMengXinX/spotdl/config"
 	log "github.com/XiaoMengXinX/spotdl/logger"
+	"github.com/bogem/id3v2"
 	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"maps"
+	"math"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode"
 )
 
 var hasFFmpeg bool
@@ -20,7 +31,9 @@ func init() {
 	}
 }
 
-func encodeMetadata(inputFile, coverFilePath string, metadata map[string]string) error {
+// encodeFFmpegTags rewrites inputFile with metadata and, if coverFilePath
+// exists, the cover as an attached picture.
+func encodeFFmpegTags(inputFile, coverFilePath string, metadata map[string]string) error {
 	tempFile := inputFile + ".tmp" + filepath.Ext(inputFile)
 
 	var mdArg []string
@@ -54,7 +67,10 @@ func encodeMetadata(inputFile, coverFilePath string, metadata map[string]string)
 	if err != nil {
 		return fmt.Errorf("failed to encode metadata: %v", err)
 	}
+	return replaceFile(tempFile, inputFile)
+}
 
+func replaceFile(tempFile, inputFile string) error {
 	if err := os.Remove(inputFile); err != nil {
 		return fmt.Errorf("failed to remove temp file: %v", err)
 	}
@@ -62,12 +78,36 @@ func encodeMetadata(inputFile, coverFilePath string, metadata map[string]string)
 	if err := os.Rename(tempFile, inputFile); err != nil {
 		return fmt.Errorf("fail to rename temp file: %v", err)
 	}
+	return nil
+}
 
+// encodeMetadata writes MP4 atoms, including the custom ones ffmpeg does not
+// map. Each of multiValues becomes a freeform atom with a data atom per
+// value.
+func encodeMetadata(inputFile, coverFilePath string, metadata map[string]string, multiValues map[string][]string, chapters []chapter) error {
+	if err := encodeFFmpegTags(inputFile, coverFilePath, metadata); err != nil {
+		return err
+	}
+	if len(chapters) > 0 {
+		// ffmpeg writes both a QuickTime chapter track and a Nero chpl atom.
+		if err := runWithFFMetadata(inputFile, ffmetadataChapters(chapters), "-map", "0", "-map_metadata", "0", "-map_chapters", "1"); err != nil {
+			return fmt.Errorf("failed to add chapters: %v", err)
+		}
+	}
+	return writeMP4Tags(inputFile, metadata, multiValues)
+}
+
+// writeMP4Tags writes the MP4 atoms ffmpeg does not map.
+func writeMP4Tags(inputFile string, metadata map[string]string, multiValues map[string][]string) error {
 	mp4, err := mp4tag.Open(inputFile)
 	if err != nil {
 		return fmt.Errorf("fail to open mp4 file: %v", err)
 	}
 	defer mp4.Close()
+	existing, err := mp4.Read()
+	if err != nil {
+		return fmt.Errorf("fail to read mp4 tags: %v", err)
+	}
 
 	var year int
 	if len(metadata["date"]) >= 4 {
@@ -83,48 +123,151 @@ func encodeMetadata(inputFile, coverFilePath string, metadata map[string]string)
 		CustomGenre: metadata["genre"],
 		Year:        int32(year),
 	}
+	for key, value := range metadata {
+		if isFreeformTag(key) {
+			tags.Custom[key] = value
+		}
+	}
+	// ffmpeg only maps the composer of the credits to an MP4 atom.
+	for _, key := range creditTags {
+		if value := metadata[key]; value != "" && key != "composer" {
+			tags.Custom[strings.ToUpper(key)] = value
+		}
+	}
+
+	// mp4tag adds further values to the ones already in the file, so all of
+	// them are dropped and those of other atoms given again.
+	tags.OtherCustom = make(map[string][]string)
+	for key, values := range existing.OtherCustom {
+		if _, ok := multiValues[key]; !ok {
+			tags.OtherCustom[key] = values
+		}
+	}
+	for key, values := range multiValues {
+		tags.Custom[key] = values[0]
+		if len(values) > 1 {
+			tags.OtherCustom[key] = values[1:]
+		}
+	}
 
-	err = mp4.Write(&tags, []string{})
+	err = mp4.Write(&tags, []string{"allothercustom"})
 	if err != nil {
 		return fmt.Errorf("fail to write extra tags: %v", err)
 	}
 	return nil
 }
 
-func (d *Downloader) convertMp3(inputFile string, outputFile string) (err error) {
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf(`input file [%s] not exists`, inputFile)
+// mp4OnlyTags are podcast tags that map to MP4 atoms but have no Vorbis
+// comment counterpart.
+var mp4OnlyTags = []string{"media_type", "podcast", "synopsis", "show", "episode_id", "episode_uri"}
+
+// encodeVorbisComments writes Vorbis comments to FLAC, Ogg Vorbis and Opus
+// files. FLAC takes the cover as a picture block; Ogg has no picture stream,
+// so the cover goes into a METADATA_BLOCK_PICTURE comment instead.
+func encodeVorbisComments(inputFile, coverFilePath string, metadata map[string]string, chapters []chapter) error {
+	comments := maps.Clone(metadata)
+	for _, key := range mp4OnlyTags {
+		delete(comments, key)
+	}
+	maps.Copy(comments, vorbisChapters(chapters))
+	if filepath.Ext(inputFile) == ".flac" {
+		return encodeFFmpegTags(inputFile, coverFilePath, comments)
 	}
 
-	_, err = exec.LookPath("ffmpeg")
-	if err != nil {
-		log.Warnln("ffmpeg not found, skip converting format")
-		return
+	if filepath.Ext(inputFile) == ".opus" {
+		addOpusGain(comments)
+	}
+	if picture, err := os.ReadFile(coverFilePath); err == nil && len(picture) > 32 {
+		comments["METADATA_BLOCK_PICTURE"] = flacPictureBlock(picture)
 	}
 
-	log.Debugf("Converting [%s] to [%s]", inputFile, outputFile)
+	// The picture is too large for a command line argument, so the tags are
+	// passed in an ffmetadata file.
+	if err := runWithFFMetadata(inputFile, ffmetadata(comments), "-map", "0:a", "-map_metadata", "1"); err != nil {
+		return fmt.Errorf("failed to encode metadata: %v", err)
+	}
+	return nil
+}
 
-	bitrate := ""
-	switch d.quality {
-	case Quality96Vorbis:
-		bitrate = "96"
-	case Quality128MP4:
-		bitrate = "128"
-	case Quality160Vorbis:
-		bitrate = "160"
-	case Quality256MP4:
-		bitrate = "256"
-	case Quality320Vorbis:
-		bitrate = "320"
+// runWithFFMetadata rewrites inputFile with an ffmetadata file as the second
+// input, which mapArgs select from. ffmpeg-go cannot add an input that only
+// provides metadata, so ffmpeg is run directly.
+func runWithFFMetadata(inputFile string, metadata []byte, mapArgs ...string) error {
+	metaFile := inputFile + ".ffmetadata"
+	if err := os.WriteFile(metaFile, metadata, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata file: %v", err)
+	}
+	defer os.Remove(metaFile)
+
+	tempFile := inputFile + ".tmp" + filepath.Ext(inputFile)
+	args := []string{"-y", "-i", inputFile, "-f", "ffmetadata", "-i", metaFile}
+	args = append(args, mapArgs...)
+	args = append(args, "-c", "copy", tempFile)
+	cmd := exec.Command("ffmpeg", args...)
+	if log.GetLevel() == log.LevelDebug {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+	return replaceFile(tempFile, inputFile)
+}
+
+// addOpusGain adds the R128 gain tags Opus players read instead of
+// ReplayGain. They are Q7.8 fixed point dB relative to -23 LUFS.
+func addOpusGain(comments map[string]string) {
+	for _, kind := range []string{"TRACK", "ALBUM"} {
+		var gain float64
+		if _, err := fmt.Sscanf(comments["REPLAYGAIN_"+kind+"_GAIN"], "%f dB", &gain); err != nil {
+			continue
+		}
+		r128 := (gain + r128Reference - replayGainReference) * 256
+		comments["R128_"+kind+"_GAIN"] = strconv.Itoa(int(math.Round(r128)))
 	}
-	log.Debugf("Set convertor bitrate: %sk", bitrate)
+}
+
+// flacPictureBlock encodes a front cover as a base64 FLAC picture block.
+func flacPictureBlock(picture []byte) string {
+	mime := http.DetectContentType(picture[:32])
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, uint32(id3v2.PTFrontCover))
+	for _, field := range []string{mime, "Front cover"} {
+		_ = binary.Write(&b, binary.BigEndian, uint32(len(field)))
+		b.WriteString(field)
+	}
+	// Width, height, color depth and palette size are optional.
+	b.Write(make([]byte, 16))
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(picture)))
+	b.Write(picture)
+	return base64.StdEncoding.EncodeToString(b.Bytes())
+}
+
+var ffmetadataEscape = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+// ffmetadata serializes tags in ffmpeg's metadata file format.
+func ffmetadata(tags map[string]string) []byte {
+	var b bytes.Buffer
+	b.WriteString(";FFMETADATA1\n")
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		if tags[key] != "" {
+			fmt.Fprintf(&b, "%s=%s\n", ffmetadataEscape.Replace(key), ffmetadataEscape.Replace(tags[key]))
+		}
+	}
+	return b.Bytes()
+}
+
+// transcode converts inputFile to outputFile with profile. The container is
+// taken from the output file extension.
+func (d *Downloader) transcode(inputFile, outputFile string, profile config.Profile) (err error) {
+	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+		return fmt.Errorf(`input file [%s] not exists`, inputFile)
+	}
+
+	log.Debugf("Converting [%s] to [%s] with %+v", inputFile, outputFile, profile)
 
 	ff := ffmpeg.Input(inputFile).
-		Output(outputFile, ffmpeg.KwArgs{
-			"format":        "mp3",
-			"audio_bitrate": bitrate + "k",
-			// "acodec": 	"libmp3lame",
-		}).
+		Output(outputFile, d.transcodeArgs(profile)).
 		OverWriteOutput().Silent(true)
 
 	if log.GetLevel() == log.LevelDebug {
@@ -133,9 +276,78 @@ func (d *Downloader) convertMp3(inputFile string, outputFile string) (err error)
 
 	err = ff.Run()
 	if err != nil {
-		return fmt.Errorf("error while converting to mp3: %v", err)
+		return fmt.Errorf("error while converting to %s: %v", profile.Container, err)
 	}
 	log.Debugln("Convert successfully")
 
 	return
 }
+
+func (d *Downloader) transcodeArgs(profile config.Profile) ffmpeg.KwArgs {
+	args := ffmpeg.KwArgs{
+		"vn":  "",
+		"c:a": profile.Codec,
+	}
+	switch {
+	case profile.Quality != "":
+		args["q:a"] = profile.Quality
+	case profile.Bitrate != "":
+		args["audio_bitrate"] = profile.Bitrate
+	case !isLossless(profile.Codec):
+		// Without a setting, lossy codecs keep the source bitrate.
+		args["audio_bitrate"] = d.sourceBitrate()
+	}
+	if profile.SampleRate > 0 {
+		args["ar"] = strconv.Itoa(profile.SampleRate)
+	}
+	if profile.Channels > 0 {
+		args["ac"] = strconv.Itoa(profile.Channels)
+	}
+	maps.Copy(args, parseFFmpegArgs(profile.Args))
+	return args
+}
+
+func isLossless(codec string) bool {
+	return codec == "flac" || codec == "alac" || strings.HasPrefix(codec, "pcm_")
+}
+
+func (d *Downloader) sourceBitrate() string {
+	switch d.quality {
+	case Quality96Vorbis:
+		return "96k"
+	case Quality160Vorbis:
+		return "160k"
+	case Quality256MP4:
+		return "256k"
+	case Quality320Vorbis:
+		return "320k"
+	default:
+		return "128k"
+	}
+}
+
+// parseFFmpegArgs turns a list such as ["-application", "audio", "-vbr",
+// "on"] into output options. An option not followed by a value is a flag.
+// Values may be negative, as in ["-q:a", "-1"].
+func parseFFmpegArgs(list []string) ffmpeg.KwArgs {
+	args := ffmpeg.KwArgs{}
+	for i := 0; i < len(list); i++ {
+		if !isFFmpegOption(list[i]) {
+			log.Warnf("Ignoring ffmpeg argument %q without option name", list[i])
+			continue
+		}
+		key, value := list[i][1:], ""
+		if i+1 < len(list) && !isFFmpegOption(list[i+1]) {
+			i++
+			value = list[i]
+		}
+		args[key] = value
+	}
+	return args
+}
+
+// isFFmpegOption reports whether s names an option: a dash followed by a
+// letter, unlike a negative number.
+func isFFmpegOption(s string) bool {
+	return len(s) > 1 && s[0] == '-' && unicode.IsLetter(rune(s[1]))
+}
@@ -0,0 +1,139 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/config"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestTranscodeArgs(t *testing.T) {
+	d := NewDownloader()
+	d.quality = Quality256MP4
+	d.output.Profiles = map[string]config.Profile{
+		"opus-voice": {Codec: "libopus", Container: "opus", Bitrate: "48k", SampleRate: 24000, Channels: 1,
+			Args: []string{"-application", "voip", "-apply_phase_inv", "0", "-strict"}},
+		"vorbis-low": {Codec: "libvorbis", Container: "ogg",
+			Args: []string{"-q:a", "-1", "-af", "volume=-3dB", "-compression_level", "-1", "-vn"}},
+	}
+
+	for format, want := range map[string]ffmpeg.KwArgs{
+		"mp3":      {"vn": "", "c:a": "libmp3lame", "audio_bitrate": "256k"},
+		"mp3-v0":   {"vn": "", "c:a": "libmp3lame", "q:a": "0"},
+		"opus-128": {"vn": "", "c:a": "libopus", "audio_bitrate": "128k"},
+		"flac":     {"vn": "", "c:a": "flac"},
+		"wav":      {"vn": "", "c:a": "pcm_s16le"},
+		"opus-voice": {"vn": "", "c:a": "libopus", "audio_bitrate": "48k", "ar": "24000", "ac": "1",
+			"application": "voip", "apply_phase_inv": "0", "strict": ""},
+		"vorbis-low": {"vn": "", "c:a": "libvorbis", "audio_bitrate": "256k",
+			"q:a": "-1", "af": "volume=-3dB", "compression_level": "-1"},
+	} {
+		profile, err := d.targetProfile(format)
+		if err != nil {
+			t.Fatalf("targetProfile(%s): %v", format, err)
+		}
+		if got := d.transcodeArgs(profile); !reflect.DeepEqual(got, want) {
+			t.Errorf("transcodeArgs(%s) = %v, want %v", format, got, want)
+		}
+	}
+}
+
+func TestEncodeVorbisCommentsOpusGain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tone.opus")
+	testTone(t, path)
+
+	tags := map[string]string{
+		"title":                 "Tone",
+		"REPLAYGAIN_TRACK_GAIN": "-5.00 dB",
+		"REPLAYGAIN_ALBUM_GAIN": "1.50 dB",
+	}
+	if err := encodeVorbisComments(path, "", tags, nil); err != nil {
+		t.Fatalf("encodeVorbisComments: %v", err)
+	}
+	comments, err := readOggComments(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Q7.8 dB relative to -23 LUFS instead of -18.
+	got := commentTags(comments)
+	if got["R128_TRACK_GAIN"] != "-2560" || got["R128_ALBUM_GAIN"] != "-896" {
+		t.Errorf("R128 gains = %q, %q, want -2560, -896", got["R128_TRACK_GAIN"], got["R128_ALBUM_GAIN"])
+	}
+	if got["REPLAYGAIN_TRACK_GAIN"] != "-5.00 dB" {
+		t.Errorf("REPLAYGAIN_TRACK_GAIN = %q, want -5.00 dB", got["REPLAYGAIN_TRACK_GAIN"])
+	}
+}
+
+func TestFFMetadata(t *testing.T) {
+	got := ffmetadata(map[string]string{"title": "a=b; #c", "artist": "x\\y", "album": ""})
+	want := ";FFMETADATA1\nartist=x\\\\y\ntitle=a\\=b\\; \\#c\n"
+	if string(got) != want {
+		t.Errorf("ffmetadata = %q, want %q", got, want)
+	}
+}
+
+func TestFlacPictureBlock(t *testing.T) {
+	picture := append([]byte("\xff\xd8\xff\xe0"), make([]byte, 60)...)
+	block, err := base64.StdEncoding.DecodeString(flacPictureBlock(picture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mime := "image/jpeg"
+	// Type, MIME type, description, dimensions, data length, data.
+	if wantLen := 4 + 4 + len(mime) + 4 + len("Front cover") + 16 + 4 + len(picture); len(block) != wantLen {
+		t.Fatalf("picture block is %d bytes, want %d", len(block), wantLen)
+	}
+	if !bytes.Equal(block[:4], []byte{0, 0, 0, 3}) || string(block[8:8+len(mime)]) != mime {
+		t.Errorf("picture block header = %q", block[:8+len(mime)])
+	}
+	if !bytes.HasSuffix(block, picture) {
+		t.Error("picture block does not end with the picture")
+	}
+}
+
+// mp4Box encodes an MP4 box.
+func mp4Box(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(box, kind...), body...)
+}
+
+func TestWriteMP4Tags(t *testing.T) {
+	file := slices.Concat(
+		mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00M4A isom")),
+		mp4Box("moov",
+			mp4Box("trak", mp4Box("mdia", mp4Box("minf", mp4Box("stbl", mp4Box("stco", make([]byte, 8)))))),
+			mp4Box("udta", mp4Box("meta", make([]byte, 4),
+				mp4Box("hdlr", make([]byte, 8), []byte("mdirappl"), make([]byte, 9)),
+				mp4Box("ilst")))),
+		mp4Box("mdat", []byte("audio")),
+	)
+	path := filepath.Join(t.TempDir(), "song.m4a")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tagging again replaces the values written before.
+	for _, artists := range [][]string{{"Old"}, {"A", "B; C", "D"}, {"A", "B; C"}} {
+		multiValues := map[string][]string{"ARTISTS": artists, "SPOTIFY_ARTIST_ID": {"a1", "a2"}}
+		if err := writeMP4Tags(path, map[string]string{"ISRC": "TEST00000001"}, multiValues); err != nil {
+			t.Fatalf("writeMP4Tags: %v", err)
+		}
+	}
+	tags, err := readFileTags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"ARTISTS": "A\x00B; C", "SPOTIFY_ARTIST_ID": "a1\x00a2", "ISRC": "TEST00000001"} {
+		if tags[key] != want {
+			t.Errorf("%s = %q, want %q", key, tags[key], want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// flacVorbisComment is the metadata block type of Vorbis comments.
+const flacVorbisComment = 4
+
+// setFlacComments replaces the Vorbis comments named by each key of values in
+// a FLAC file with one comment per value. ffmpeg writes a single comment per
+// key, so multi-value tags are set afterwards.
+func setFlacComments(path string, values map[string][]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pos, end, err := findFlacComments(data)
+	if err != nil {
+		return fmt.Errorf("%v in %s", err, path)
+	}
+
+	block, err := replaceVorbisComments(data[pos+4:end], values)
+	if err != nil {
+		return fmt.Errorf("invalid Vorbis comments in %s: %v", path, err)
+	}
+	if len(block) >= 1<<24 {
+		return fmt.Errorf("too many Vorbis comments for %s", path)
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:pos])
+	out.Write([]byte{data[pos], byte(len(block) >> 16), byte(len(block) >> 8), byte(len(block))})
+	out.Write(block)
+	out.Write(data[end:])
+	tempFile := path + ".tmp.flac"
+	if err := os.WriteFile(tempFile, out.Bytes(), 0644); err != nil {
+		return err
+	}
+	return replaceFile(tempFile, path)
+}
+
+// readFlacComments returns the Vorbis comments of a FLAC file.
+func readFlacComments(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pos, end, err := findFlacComments(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v in %s", err, path)
+	}
+	_, comments, _, err := parseVorbisComments(data[pos+4 : end])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Vorbis comments in %s: %v", path, err)
+	}
+	return comments, nil
+}
+
+// findFlacComments returns the offsets of the Vorbis comment block of FLAC
+// data, from its header to its end.
+func findFlacComments(data []byte) (int, int, error) {
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		return 0, 0, fmt.Errorf("no FLAC signature")
+	}
+	for pos := 4; ; {
+		if pos+4 > len(data) {
+			return 0, 0, fmt.Errorf("truncated metadata")
+		}
+		header := data[pos]
+		size := int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3])
+		end := pos + 4 + size
+		if end > len(data) {
+			return 0, 0, fmt.Errorf("truncated metadata")
+		}
+		if header&0x7f == flacVorbisComment {
+			return pos, end, nil
+		}
+		if header&0x80 != 0 {
+			return 0, 0, fmt.Errorf("no Vorbis comments")
+		}
+		pos = end
+	}
+}
+
+// parseVorbisComments splits a Vorbis comment block into its vendor string,
+// its comments and anything after them, such as the framing bit of Ogg
+// Vorbis.
+func parseVorbisComments(block []byte) (string, []string, []byte, error) {
+	r := bytes.NewReader(block)
+	readString := func() (string, error) {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return "", err
+		}
+		if int64(n) > int64(r.Len()) {
+			return "", fmt.Errorf("comment length %d exceeds the block", n)
+		}
+		s := make([]byte, n)
+		_, err := io.ReadFull(r, s)
+		return string(s), err
+	}
+
+	vendor, err := readString()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return "", nil, nil, err
+	}
+	var comments []string
+	for range count {
+		comment, err := readString()
+		if err != nil {
+			return "", nil, nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return vendor, comments, block[len(block)-r.Len():], nil
+}
+
+// replaceVorbisComments rewrites a Vorbis comment block, dropping the
+// comments named by each key of values and appending one per value.
+func replaceVorbisComments(block []byte, values map[string][]string) ([]byte, error) {
+	vendor, comments, rest, err := parseVorbisComments(block)
+	if err != nil {
+		return nil, err
+	}
+	comments = slices.DeleteFunc(comments, func(comment string) bool {
+		name, _, _ := strings.Cut(comment, "=")
+		for key := range values {
+			if strings.EqualFold(name, key) {
+				return true
+			}
+		}
+		return false
+	})
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		for _, value := range values[key] {
+			comments = append(comments, key+"="+value)
+		}
+	}
+
+	var out bytes.Buffer
+	writeString := func(s string) {
+		_ = binary.Write(&out, binary.LittleEndian, uint32(len(s)))
+		out.WriteString(s)
+	}
+	writeString(vendor)
+	_ = binary.Write(&out, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		writeString(comment)
+	}
+	out.Write(rest)
+	return out.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func vorbisCommentBlock(vendor string, comments ...string) []byte {
+	var b bytes.Buffer
+	writeString := func(s string) {
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(s)))
+		b.WriteString(s)
+	}
+	writeString(vendor)
+	_ = binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, s := range comments {
+		writeString(s)
+	}
+	return b.Bytes()
+}
+
+func TestSetFlacComments(t *testing.T) {
+	streamInfo := bytes.Repeat([]byte{0xAB}, 34)
+	comments := vorbisCommentBlock("ffmpeg", "TITLE=Song", "ARTISTS=A; B", "artists=old", "SPOTIFY_ARTIST_ID=a1; a2")
+	audio := []byte("frames")
+
+	var file bytes.Buffer
+	file.WriteString("fLaC")
+	file.Write([]byte{0, 0, 0, byte(len(streamInfo))})
+	file.Write(streamInfo)
+	file.Write([]byte{0x80 | flacVorbisComment, 0, 0, byte(len(comments))})
+	file.Write(comments)
+	file.Write(audio)
+
+	path := filepath.Join(t.TempDir(), "song.flac")
+	if err := os.WriteFile(path, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string][]string{"ARTISTS": {"A", "B, Jr."}, "SPOTIFY_ARTIST_ID": {"a1", "a2"}}
+	if err := setFlacComments(path, values); err != nil {
+		t.Fatalf("setFlacComments: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := vorbisCommentBlock("ffmpeg", "TITLE=Song", "ARTISTS=A", "ARTISTS=B, Jr.", "SPOTIFY_ARTIST_ID=a1", "SPOTIFY_ARTIST_ID=a2")
+	block := data[4+4+34:]
+	if block[0] != 0x80|flacVorbisComment || int(block[3]) != len(want) {
+		t.Fatalf("block header = % x, want length %d", block[:4], len(want))
+	}
+	if !bytes.Equal(block[4:4+len(want)], want) {
+		t.Errorf("comments = %q, want %q", block[4:4+len(want)], want)
+	}
+	if !slices.Equal(block[4+len(want):], audio) {
+		t.Errorf("audio = %q, want it unchanged", block[4+len(want):])
+	}
+}
@@ -0,0 +1,58 @@
+package spotify
+
+import "github.com/XiaoMengXinX/spotdl/download"
+
+// Event identifies the track or episode a hook is called for.
+type Event struct {
+	ID   string
+	Type IDType
+	// Name is the item's display name, "title - artist".
+	Name string
+	// Path is the first output file, set once it is known.
+	Path string
+	// Paths are all output files, one per target, set on completion.
+	Paths []string
+}
+
+type ProgressEvent struct {
+	Event
+	Written int64
+	Total   int64
+	// Rate is the current transfer rate in bytes per second.
+	Rate float64
+}
+
+// Hooks are callbacks invoked while downloading. Nil hooks are skipped. They
+// are called synchronously from the downloading goroutine and should return
+// quickly.
+type Hooks struct {
+	OnStart    func(Event)
+	OnProgress func(ProgressEvent)
+	// OnComplete is called once per item with the error it failed with, or
+	// nil on success.
+	OnComplete func(Event, error)
+}
+
+// SetHooks sets the callbacks invoked while downloading.
+func (d *Downloader) SetHooks(hooks Hooks) *Downloader {
+	d.hooks = hooks
+	return d
+}
+
+func (d *Downloader) emitStart(ev Event) {
+	if d.hooks.OnStart != nil {
+		d.hooks.OnStart(ev)
+	}
+}
+
+func (d *Downloader) emitProgress(ev Event, p download.Progress) {
+	if d.hooks.OnProgress != nil {
+		d.hooks.OnProgress(ProgressEvent{Event: ev, Written: p.Written, Total: p.Total, Rate: p.Rate})
+	}
+}
+
+func (d *Downloader) emitComplete(ev Event, err error) {
+	if d.hooks.OnComplete != nil {
+		d.hooks.OnComplete(ev, err)
+	}
+}
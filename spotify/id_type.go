@@ -3,6 +3,9 @@ package spotify
 import (
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -14,8 +17,12 @@ const (
 	PLAYLIST IDType = "playlist"
 	SHOW     IDType = "show"
 	EPISODE  IDType = "episode"
+
+	AUDIOBOOK IDType = "audiobook"
+	CHAPTER   IDType = "chapter"
 )
 
+// GetIDType parses a Spotify URL, URI or track ID.
 func GetIDType(urlID string) (string, IDType, error) {
 	if strings.HasPrefix(urlID, "http") {
 		parsedURL, err := url.Parse(urlID)
@@ -45,3 +52,47 @@ func GetIDType(urlID string) (string, IDType, error) {
 	}
 	return urlID, TRACK, nil
 }
+
+// ParseInput is GetIDType for user input, which may also be the path of an
+// audio file tagged by spotdl. Such a file resolves to the content it was
+// downloaded from.
+func ParseInput(input string) (string, IDType, error) {
+	if isFilePath(input) {
+		if info, err := os.Stat(input); err == nil && info.Mode().IsRegular() {
+			return fileIDType(input)
+		}
+	}
+	return GetIDType(input)
+}
+
+// isFilePath reports whether s is meant as a path rather than an ID: it has a
+// directory or the extension of an audio file spotdl reads tags from.
+func isFilePath(s string) bool {
+	return strings.ContainsRune(s, '/') || strings.ContainsRune(s, filepath.Separator) ||
+		slices.Contains(tagFormats, strings.ToLower(filepath.Ext(s)))
+}
+
+// fileIDType reads the Spotify URI, or the track ID, tagged in an audio file.
+func fileIDType(path string) (string, IDType, error) {
+	tags, err := readFileTags(path)
+	if err != nil {
+		return "", "", err
+	}
+	id, idType, err := taggedID(tags)
+	if err == nil && id == "" {
+		err = fmt.Errorf("no Spotify ID tagged in %s", path)
+	}
+	return id, idType, err
+}
+
+// taggedID returns the content tags were written for, or an empty ID if
+// they carry no Spotify ID.
+func taggedID(tags map[string]string) (string, IDType, error) {
+	if uri := tags["SPOTIFY_URI"]; uri != "" {
+		return GetIDType(uri)
+	}
+	if id := tags["SPOTIFY_TRACK_ID"]; id != "" {
+		return id, TRACK, nil
+	}
+	return "", "", nil
+}
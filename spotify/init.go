@@ -24,25 +24,35 @@ func readCDMs() []string {
 	return cdms
 }
 
-func requestClientBases() []string {
-	resp, err := http.Get("https://apresolve.spotify.com?type=spclient")
-	if err != nil {
-		log.Errorf("Failed to request client bases: %v", err)
+// requestClientBases resolves the spclient hosts. The apresolve response is
+// cached, and a stale copy is used if the request fails. In offline metadata
+// mode only the cache is used.
+func (d *Downloader) requestClientBases() []string {
+	url := d.endpoints.APResolve + "?type=spclient"
+	data, ok := d.cachedResponse(url)
+	if !ok && d.isOfflineMetadata {
+		log.Debugln("Client bases are not cached and offline metadata mode is enabled")
 		return nil
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Errorf("Failed to request client bases (%d): %s", resp.StatusCode, body)
-		return nil
+	if !ok {
+		var err error
+		data, err = d.fetchAPResolve(url)
+		if err != nil {
+			log.Errorf("Failed to request client bases: %v", err)
+			if data, ok = d.staleResponse(url); !ok {
+				return nil
+			}
+			log.Warnln("Using expired client bases from cache")
+		} else {
+			d.storeResponse(url, "apresolve", data)
+		}
 	}
 
 	var response struct {
 		SpClient []string `json:"spclient"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := json.Unmarshal(data, &response); err != nil {
 		log.Errorf("Error while decoding client bases response: %v", err)
 		return nil
 	}
@@ -59,6 +69,9 @@ func requestClientBases() []string {
 }
 
 func formatEndpoint(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return strings.TrimSuffix(endpoint, "/")
+	}
 	parts := strings.Split(endpoint, ":")
 	if len(parts) != 2 {
 		log.Errorf("Invalid endpoint format: %s", endpoint)
@@ -73,3 +86,20 @@ func formatEndpoint(endpoint string) string {
 		return fmt.Sprintf("https://%s", domain)
 	}
 }
+
+func (d *Downloader) fetchAPResolve(url string) ([]byte, error) {
+	resp, err := d.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,127 @@
+package spotify
+
+import (
+	"bytes"
+	"fmt"
+	log "github.com/XiaoMengXinX/spotdl/logger"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// replayGainReference is the ReplayGain 2.0 target loudness in LUFS.
+	replayGainReference = -18.0
+	// r128Reference is the EBU R128 target loudness used by Opus gain tags.
+	r128Reference = -23.0
+)
+
+var (
+	integratedPattern = regexp.MustCompile(`I:\s+(-?[\d.]+) LUFS`)
+	truePeakPattern   = regexp.MustCompile(`Peak:\s+(-?[\d.]+|-inf) dBFS`)
+	durationPattern   = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+)
+
+// loudness is an EBU R128 measurement.
+type loudness struct {
+	// Integrated is the integrated loudness in LUFS.
+	Integrated float64
+	// Peak is the true peak as a linear amplitude.
+	Peak     float64
+	Duration time.Duration
+}
+
+// SetReplayGain enables loudness analysis of downloaded tracks and writes
+// ReplayGain tags, with album gain when downloading an album.
+func (d *Downloader) SetReplayGain(b bool) *Downloader {
+	d.replayGain = b
+	return d
+}
+
+func (d *Downloader) replayGainEnabled() bool {
+	return (d.replayGain || d.output.ReplayGain) && hasFFmpeg && !d.isSkipAddingMetadata
+}
+
+// measureLoudness runs ffmpeg's ebur128 filter over the audio of inputFile.
+func measureLoudness(inputFile string) (*loudness, error) {
+	var stderr bytes.Buffer
+	// Per-frame measurements go to the verbose log level, leaving only the
+	// summary at the default level.
+	err := ffmpeg.Input(inputFile).
+		Output("-", ffmpeg.KwArgs{"vn": "", "af": "ebur128=peak=true:framelog=verbose", "f": "null"}).
+		Silent(true).WithErrorOutput(&stderr).Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure loudness: %v", err)
+	}
+	return parseLoudness(stderr.String())
+}
+
+// parseLoudness reads the ebur128 summary and input duration from ffmpeg's
+// log output.
+func parseLoudness(output string) (*loudness, error) {
+	integrated := integratedPattern.FindAllStringSubmatch(output, -1)
+	peak := truePeakPattern.FindAllStringSubmatch(output, -1)
+	if len(integrated) == 0 || len(peak) == 0 {
+		return nil, fmt.Errorf("no loudness summary in ffmpeg output")
+	}
+
+	var l loudness
+	// The summary follows the per-frame lines, so the last match is used.
+	l.Integrated, _ = strconv.ParseFloat(integrated[len(integrated)-1][1], 64)
+	if dBFS, err := strconv.ParseFloat(peak[len(peak)-1][1], 64); err == nil {
+		l.Peak = math.Pow(10, dBFS/20)
+	}
+	if m := durationPattern.FindStringSubmatch(output); m != nil {
+		h, _ := strconv.Atoi(m[1])
+		minutes, _ := strconv.Atoi(m[2])
+		sec, _ := strconv.ParseFloat(m[3], 64)
+		l.Duration = time.Duration(h)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(sec*float64(time.Second))
+	}
+	log.Debugf("Measured loudness: %+v", l)
+	return &l, nil
+}
+
+// albumLoudness combines track measurements into the loudness of the album,
+// averaging their energy weighted by duration. This approximates the gated
+// loudness of the album played as one program, which is what ReplayGain and
+// EBU R128 define, without decoding every track again. The two differ when
+// tracks have long quiet passages, which the gate would leave out.
+func albumLoudness(tracks []*loudness) *loudness {
+	var album loudness
+	var energy, weights float64
+	for _, track := range tracks {
+		if track == nil {
+			continue
+		}
+		weight := track.Duration.Seconds()
+		if weight <= 0 {
+			weight = 1
+		}
+		energy += weight * math.Pow(10, track.Integrated/10)
+		weights += weight
+		album.Peak = max(album.Peak, track.Peak)
+		album.Duration += track.Duration
+	}
+	if weights == 0 {
+		return nil
+	}
+	album.Integrated = 10 * math.Log10(energy/weights)
+	return &album
+}
+
+// replayGainTags returns the REPLAYGAIN_* tags for track and, if known, its
+// album.
+func replayGainTags(track, album *loudness) map[string]string {
+	tags := make(map[string]string)
+	if track != nil {
+		tags["REPLAYGAIN_TRACK_GAIN"] = fmt.Sprintf("%.2f dB", replayGainReference-track.Integrated)
+		tags["REPLAYGAIN_TRACK_PEAK"] = fmt.Sprintf("%.6f", track.Peak)
+	}
+	if album != nil {
+		tags["REPLAYGAIN_ALBUM_GAIN"] = fmt.Sprintf("%.2f dB", replayGainReference-album.Integrated)
+		tags["REPLAYGAIN_ALBUM_PEAK"] = fmt.Sprintf("%.6f", album.Peak)
+	}
+	return tags
+}
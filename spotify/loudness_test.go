@@ -0,0 +1,106 @@
+package spotify
+
+import (
+	"math"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const ebur128Output = `Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'track.m4a':
+  Duration: 00:03:25.50, start: 0.000000, bitrate: 130 kb/s
+[Parsed_ebur128_0 @ 0x600000e4c000] t: 0.1  TARGET:-23 LUFS  M:-120.7 S:-120.7  I: -70.0 LUFS  LRA: 0.0 LU  FTPK: -inf dBFS  TPK: -inf dBFS
+[Parsed_ebur128_0 @ 0x600000e4c000] Summary:
+
+  Integrated loudness:
+    I:          -9.5 LUFS
+    Threshold: -19.6 LUFS
+
+  Loudness range:
+    LRA:         4.1 LU
+    Threshold: -29.6 LUFS
+    LRA low:   -12.3 LUFS
+    LRA high:   -8.2 LUFS
+
+  True peak:
+    Peak:        0.8 dBFS
+`
+
+func TestParseLoudness(t *testing.T) {
+	l, err := parseLoudness(ebur128Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Integrated != -9.5 {
+		t.Errorf("integrated loudness = %v, want -9.5", l.Integrated)
+	}
+	if want := math.Pow(10, 0.8/20); math.Abs(l.Peak-want) > 1e-9 {
+		t.Errorf("peak = %v, want %v", l.Peak, want)
+	}
+	if want := 3*time.Minute + 25500*time.Millisecond; l.Duration != want {
+		t.Errorf("duration = %v, want %v", l.Duration, want)
+	}
+
+	if _, err := parseLoudness("Duration: 00:00:01.00"); err == nil {
+		t.Error("parseLoudness without a summary succeeded")
+	}
+}
+
+func TestReplayGainTags(t *testing.T) {
+	loud := &loudness{Integrated: -8, Peak: 1.1, Duration: 3 * time.Minute}
+	quiet := &loudness{Integrated: -18, Peak: 0.5, Duration: time.Minute}
+	album := albumLoudness([]*loudness{loud, quiet, nil})
+
+	// Energy average weighted 3:1 towards the loud track.
+	want := 10 * math.Log10((3*math.Pow(10, -0.8)+math.Pow(10, -1.8))/4)
+	if math.Abs(album.Integrated-want) > 1e-9 || album.Peak != 1.1 {
+		t.Errorf("album loudness = %+v, want %v LUFS with peak 1.1", album, want)
+	}
+
+	tags := replayGainTags(quiet, album)
+	if tags["REPLAYGAIN_TRACK_GAIN"] != "0.00 dB" || tags["REPLAYGAIN_TRACK_PEAK"] != "0.500000" {
+		t.Errorf("track tags = %v", tags)
+	}
+	if tags["REPLAYGAIN_ALBUM_GAIN"] != "-8.89 dB" || tags["REPLAYGAIN_ALBUM_PEAK"] != "1.100000" {
+		t.Errorf("album tags = %v", tags)
+	}
+
+	addOpusGain(tags)
+	if tags["R128_TRACK_GAIN"] != "-1280" || tags["R128_ALBUM_GAIN"] != "-3556" {
+		t.Errorf("opus gain tags = %v", tags)
+	}
+}
+
+// testTone writes three seconds of a 1 kHz tone to path with ffmpeg, encoded
+// as the extension says, and skips the test without ffmpeg or the encoder.
+func testTone(t *testing.T, path string) {
+	t.Helper()
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not found")
+	}
+	out, err := exec.Command("ffmpeg", "-y", "-f", "lavfi", "-i", "sine=frequency=1000:duration=3", path).CombinedOutput()
+	if err != nil {
+		t.Skipf("ffmpeg cannot encode %s: %v\n%s", filepath.Ext(path), err, out)
+	}
+}
+
+func TestMeasureLoudness(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tone.wav")
+	testTone(t, path)
+
+	l, err := measureLoudness(path)
+	if err != nil {
+		t.Fatalf("measureLoudness: %v", err)
+	}
+	// ffmpeg's sine source peaks at 1/8 of full scale.
+	if l.Integrated < -30 || l.Integrated > -10 {
+		t.Errorf("integrated loudness = %v LUFS, want about -21", l.Integrated)
+	}
+	if l.Peak <= 0.1 || l.Peak >= 0.2 {
+		t.Errorf("peak = %v, want about 0.125", l.Peak)
+	}
+	if l.Duration < 2900*time.Millisecond || l.Duration > 3100*time.Millisecond {
+		t.Errorf("duration = %v, want 3s", l.Duration)
+	}
+}
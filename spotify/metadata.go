@@ -4,40 +4,139 @@ import (
 	"fmt"
 	log "github.com/XiaoMengXinX/spotdl/logger"
 	"github.com/bogem/id3v2"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func (d *Downloader) addMetadata(trackMD trackMetadata, filePath string) (err error) {
+// addMetadata tags each of filePaths with the track metadata. Extra tags are
+// added to those built from the track metadata.
+func (d *Downloader) addMetadata(trackMD trackMetadata, extra map[string]string, filePaths ...string) (err error) {
+	metadata, err := d.buildMetadata(trackMD)
+	if err != nil {
+		return err
+	}
+	maps.Copy(metadata, extra)
+
+	coverFileName, err := d.downloadCoverImage(trackMD)
+	if err != nil {
+		log.Warnf("Failed to download cover image: %v, skip adding front cover", err)
+	}
+	return d.writeTags(metadata, coverFileName, nil, filePaths...)
+}
+
+// addEpisodeMetadata tags each of filePaths as a podcast episode with its
+// chapters.
+func (d *Downloader) addEpisodeMetadata(episodeID string, episodeMD episodeMetadata, chapters []chapter, filePaths ...string) (err error) {
+	metadata := buildEpisodeMetadata(episodeID, episodeMD)
+
+	coverFileName, err := d.downloadEpisodeCover(episodeMD)
+	if err != nil {
+		log.Warnf("Failed to download cover image: %v, skip adding front cover", err)
+	}
+	return d.writeTags(metadata, coverFileName, chapters, filePaths...)
+}
+
+// addChapterMetadata tags each of filePaths as a chapter of an audiobook.
+func (d *Downloader) addChapterMetadata(chapterID string, chapterMD episodeMetadata, filePaths ...string) (err error) {
+	metadata := buildChapterMetadata(chapterID, chapterMD)
+
+	coverFileName, err := d.downloadEpisodeCover(chapterMD)
+	if err != nil {
+		log.Warnf("Failed to download cover image: %v, skip adding front cover", err)
+	}
+	return d.writeTags(metadata, coverFileName, nil, filePaths...)
+}
+
+// writeTags writes metadata, the downloaded cover and chapters to each of
+// filePaths according to its container: ID3 for MP3, atoms for MP4 and Vorbis
+// comments for FLAC, Ogg and Opus.
+func (d *Downloader) writeTags(metadata map[string]string, coverFileName string, chapters []chapter, filePaths ...string) (err error) {
+	var coverFilePath string
+	if coverFileName != "" {
+		coverFilePath = filepath.Join(d.outputFolder, coverFileName)
+		defer os.Remove(coverFilePath)
+	}
+
+	// TIPL and TMCL pairs only have a place in ID3. ffmpeg keeps one value
+	// per key, so multi-value tags are written separately, one atom value or
+	// comment per value.
+	tags := maps.Clone(metadata)
+	for _, key := range id3OnlyTags {
+		delete(tags, key)
+	}
+	multiValues := make(map[string][]string)
+	for _, key := range multiValueTags {
+		if tags[key] != "" {
+			multiValues[key] = strings.Split(tags[key], multiValueSeparator)
+		}
+		delete(tags, key)
+	}
+
+	for _, filePath := range filePaths {
+		switch filepath.Ext(filePath) {
+		case ".mp3":
+			err = addMp3Id3v2(filePath, coverFilePath, metadata, chapters)
+		case ".m4a":
+			err = encodeMetadata(filePath, coverFilePath, tags, multiValues, chapters)
+		case ".flac", ".ogg", ".opus":
+			err = encodeVorbisComments(filePath, coverFilePath, tags, chapters)
+			switch {
+			case err != nil || len(multiValues) == 0:
+			case filepath.Ext(filePath) == ".flac":
+				err = setFlacComments(filePath, multiValues)
+			default:
+				err = setOggComments(filePath, multiValues)
+			}
+		case ".wav":
+			// The INFO chunk ffmpeg writes only holds the common tags.
+			if err = encodeFFmpegTags(filePath, "", tags); err == nil {
+				err = addWavID3(filePath, coverFilePath, metadata, chapters)
+			}
+		default:
+			log.Debugf("No tagger for [%s], skip adding metadata", filePath)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Downloader) buildMetadata(trackMD trackMetadata) (map[string]string, error) {
 	trackID := SpHexToID(trackMD.GID)
 	log.Debugf("trackID: %s", trackMD.GID)
-	log.Debugf("ID: %s", SpHexToID(trackMD.GID))
+	log.Debugf("ID: %s", trackID)
 
-	track, err := d.queryTrackAPI(trackID)
+	track, err := d.lookupTrack(trackID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch track data: %w", err)
+		return nil, fmt.Errorf("failed to fetch track data: %w", err)
 	}
 
-	album, err := d.queryAlbumAPI(track.Album.ID)
+	album, err := d.lookupAlbum(track.Album.ID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch album data: %w", err)
+		return nil, fmt.Errorf("failed to fetch album data: %w", err)
 	}
 
 	credits, err := d.getTrackCredits(trackID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch track credits: %w", err)
+		return nil, fmt.Errorf("failed to fetch track credits: %w", err)
 	}
 
 	metadata := make(map[string]string)
 	metadata["title"] = trackMD.Name
-	metadata["artist"] = formatArtistsStr(trackMD.Artists)
+	metadata["artist"] = d.formatArtists(artistNames(trackMD.Artists), true)
+	metadata["ARTISTS"] = strings.Join(artistNames(trackMD.Artists), multiValueSeparator)
 	metadata["album"] = trackMD.Album.Name
 	metadata["date"] = album.ReleaseDate
-	metadata["album_artist"] = formatArtistsStr(album.Artists)
-	metadata["composer"] = formatComposersStr(credits)
+	metadata["album_artist"] = d.formatArtists(artistNames(album.Artists), false)
+	maps.Copy(metadata, buildCreditTags(credits, d.creditRoles()))
 	for _, copyright := range album.Copyrights {
 		if copyright.Type == "P" {
 			cr := strings.Replace(copyright.Text, "(P)", "℗", 1)
@@ -62,48 +161,254 @@ func (d *Downloader) addMetadata(trackMD trackMetadata, filePath string) (err er
 	if album.ExternalIds.EAN != "" {
 		metadata["EAN"] = album.ExternalIds.EAN
 	}
+	metadata["SPOTIFY_TRACK_ID"] = trackID
+	metadata["SPOTIFY_ALBUM_ID"] = track.Album.ID
+	metadata["SPOTIFY_ARTIST_ID"] = strings.Join(artistIDs(track.Artists), multiValueSeparator)
+	metadata["SPOTIFY_URI"] = trackMD.CanonicalURI
+	if metadata["SPOTIFY_URI"] == "" {
+		metadata["SPOTIFY_URI"] = fmt.Sprintf("spotify:%s:%s", TRACK, trackID)
+	}
 	metadata["track"] = fmt.Sprintf("%d/%d", track.TrackNumber, track.Album.TotalTracks)
+	if track.DiscNumber > 0 {
+		metadata["disc"] = strconv.Itoa(track.DiscNumber)
+		if discs, err := d.albumDiscCount(album); err != nil {
+			log.Warnf("Failed to count discs of album [%s]: %v", album.Name, err)
+		} else if discs > 0 {
+			metadata["disc"] = fmt.Sprintf("%d/%d", track.DiscNumber, discs)
+		}
+	}
+	if album.Type == "compilation" {
+		metadata["compilation"] = "1"
+	}
 	if len(album.Genres) > 0 {
 		metadata["genre"] = album.Genres[0]
 	}
 	metadata["creation_time"] = time.Now().UTC().Format(time.RFC3339)
 
 	log.Debugf("Serialized metadata: %+v", metadata)
+	return metadata, nil
+}
 
-	coverFileName, err := d.downloadCoverImage(trackMD)
-	coverFilePath := filepath.Join(d.outputFolder, coverFileName)
-	defer os.Remove(coverFilePath)
+// buildEpisodeMetadata maps episode metadata to podcast tags. The MP4 muxer
+// writes media_type 21 as the podcast stik atom, show as tvsh, episode_id as
+// tven and synopsis as the long description; podcast and episode_uri only
+// become the ID3 PCST and TGID frames.
+func buildEpisodeMetadata(episodeID string, episodeMD episodeMetadata) map[string]string {
+	episode := episodeMD.Data.Episode
+	show := episode.Podcast.Data
 
-	if err != nil {
-		log.Warnf("Failed to download cover image: %v, skip adding front cover", err)
+	publisher := show.Publisher.Name
+	if publisher == "" {
+		publisher = episode.Creator
 	}
 
-	if d.isConvertToMP3 {
-		return addMp3Id3v2(filePath, coverFilePath, metadata)
-	} else {
-		return encodeMetadata(filePath, coverFilePath, metadata)
+	metadata := make(map[string]string)
+	metadata["title"] = episode.Name
+	metadata["artist"] = publisher
+	metadata["album"] = show.Name
+	metadata["album_artist"] = publisher
+	metadata["show"] = show.Name
+	if len(episode.ReleaseDate.IsoString) >= 10 {
+		metadata["date"] = episode.ReleaseDate.IsoString[:10]
+	}
+	metadata["description"] = episode.Description
+	metadata["synopsis"] = episode.Description
+	metadata["genre"] = "Podcast"
+	metadata["media_type"] = "21"
+	metadata["podcast"] = "1"
+	metadata["episode_id"] = episodeID
+	metadata["episode_uri"] = fmt.Sprintf("spotify:episode:%s", episodeID)
+	metadata["SPOTIFY_URI"] = metadata["episode_uri"]
+	if episode.Duration.TotalMilliseconds > 0 {
+		metadata["length"] = strconv.Itoa(episode.Duration.TotalMilliseconds)
 	}
+	metadata["creation_time"] = time.Now().UTC().Format(time.RFC3339)
+
+	log.Debugf("Serialized episode metadata: %+v", metadata)
+	return metadata
 }
 
-func addMp3Id3v2(inputFile, coverFilePath string, metadata map[string]string) (err error) {
-	musicFile, err := os.OpenFile(inputFile, os.O_RDWR, os.ModePerm)
+// buildChapterMetadata maps audiobook chapter metadata to tags. Authors are
+// the artist and narrators the composer, as audiobook players expect;
+// media_type 2 is the MP4 audiobook stik atom and grouping holds the series.
+func buildChapterMetadata(chapterID string, chapterMD episodeMetadata) map[string]string {
+	chapter := chapterMD.Data.Episode
+	book := chapter.Audiobook.Data
+
+	authors := joinNames(book.Authors)
+	if authors == "" {
+		authors = book.Publisher.Name
+	}
+	narrators := joinNames(book.Narrators)
+
+	metadata := make(map[string]string)
+	metadata["title"] = chapter.Name
+	metadata["artist"] = authors
+	metadata["album"] = book.Name
+	metadata["album_artist"] = authors
+	metadata["composer"] = narrators
+	metadata["NARRATOR"] = narrators
+	if len(book.Series) > 0 {
+		metadata["grouping"] = book.Series[0].Name
+		metadata["SERIES"] = book.Series[0].Name
+		metadata["SERIES-PART"] = book.Series[0].Number
+	}
+	metadata["track"] = strconv.Itoa(chapter.ChapterNumber + 1)
+	if total := book.Chapters.TotalCount; total > 0 {
+		metadata["track"] = fmt.Sprintf("%d/%d", chapter.ChapterNumber+1, total)
+	}
+	date := book.ReleaseDate.IsoString
+	if date == "" {
+		date = chapter.ReleaseDate.IsoString
+	}
+	if len(date) >= 10 {
+		metadata["date"] = date[:10]
+	}
+	metadata["description"] = chapter.Description
+	metadata["genre"] = "Audiobook"
+	metadata["media_type"] = "2"
+	metadata["SPOTIFY_URI"] = fmt.Sprintf("spotify:%s:%s", CHAPTER, chapterID)
+	if chapter.Duration.TotalMilliseconds > 0 {
+		metadata["length"] = strconv.Itoa(chapter.Duration.TotalMilliseconds)
+	}
+	metadata["creation_time"] = time.Now().UTC().Format(time.RFC3339)
+
+	log.Debugf("Serialized chapter metadata: %+v", metadata)
+	return metadata
+}
+
+// id3OnlyTags are credit lists of role and name pairs for the ID3 TIPL and
+// TMCL frames.
+var id3OnlyTags = []string{"TIPL", "TMCL"}
+
+// freeformTags are written as MP4 freeform atoms and ID3 TXXX frames, along
+// with the REPLAYGAIN_* and SPOTIFY_* tags.
+var freeformTags = []string{"ARTISTS", "NARRATOR", "SERIES", "SERIES-PART", "UPC", "EAN"}
+
+func isFreeformTag(key string) bool {
+	return strings.HasPrefix(key, "REPLAYGAIN_") || strings.HasPrefix(key, "SPOTIFY_") || slices.Contains(freeformTags, key)
+}
+
+func addMp3Id3v2(inputFile, coverFilePath string, metadata map[string]string, chapters []chapter) (err error) {
+	musicTag, err := id3v2.Open(inputFile, id3v2.Options{Parse: true})
 	if err != nil {
 		return fmt.Errorf("failed to open input file: %v", err)
 	}
-	defer musicFile.Close()
-
-	musicTag, _ := id3v2.ParseReader(musicFile, id3v2.Options{Parse: true})
 	defer musicTag.Close()
 
+	if err := setID3Frames(musicTag, coverFilePath, metadata, chapters); err != nil {
+		return err
+	}
+	if err := musicTag.Save(); err != nil {
+		return fmt.Errorf("failed to save id3v2: %v ", err)
+	}
+	return nil
+}
+
+// setID3Frames sets the frames of an ID3 tag from metadata.
+func setID3Frames(musicTag *id3v2.Tag, coverFilePath string, metadata map[string]string, chapters []chapter) (err error) {
 	musicTag.SetDefaultEncoding(id3v2.EncodingUTF8)
 	musicTag.SetTitle(metadata["title"])
-	musicTag.SetArtist(metadata["artist"])
+	if metadata["ARTISTS"] != "" {
+		// ID3v2.4 separates the values of text frames with null bytes.
+		musicTag.SetArtist(metadata["ARTISTS"])
+	} else {
+		musicTag.SetArtist(metadata["artist"])
+	}
 	musicTag.SetAlbum(metadata["album"])
 	musicTag.SetYear(metadata["date"])
+	musicTag.SetGenre(metadata["genre"])
+	if metadata["album_artist"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Band/Orchestra/Accompaniment"), id3v2.EncodingUTF8, metadata["album_artist"])
+	}
+	if metadata["composer"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Composer"), id3v2.EncodingUTF8, metadata["composer"])
+	}
+	if metadata["lyricist"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Lyricist/Text writer"), id3v2.EncodingUTF8, metadata["lyricist"])
+	}
+	if metadata["TIPL"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Involved people list"), id3v2.EncodingUTF8, metadata["TIPL"])
+	}
+	if metadata["TMCL"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Musician credits list"), id3v2.EncodingUTF8, metadata["TMCL"])
+	}
+	if metadata["grouping"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Content group description"), id3v2.EncodingUTF8, metadata["grouping"])
+	}
+	if metadata["track"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Track number/Position in set"), id3v2.EncodingUTF8, metadata["track"])
+	}
+	if metadata["disc"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Part of a set"), id3v2.EncodingUTF8, metadata["disc"])
+	}
+	if metadata["compilation"] == "1" {
+		// iTunes compilation flag.
+		musicTag.AddTextFrame("TCMP", id3v2.EncodingUTF8, "1")
+	}
+	if metadata["description"] != "" {
+		// Like TXXX frames, comments are kept side by side; the one written
+		// before by spotdl is replaced.
+		comments := musicTag.GetFrames(musicTag.CommonID("Comments"))
+		musicTag.DeleteFrames(musicTag.CommonID("Comments"))
+		for _, frame := range comments {
+			if cf, ok := frame.(id3v2.CommentFrame); ok && (cf.Language != "eng" || cf.Description != "") {
+				musicTag.AddCommentFrame(cf)
+			}
+		}
+		musicTag.AddCommentFrame(id3v2.CommentFrame{
+			Encoding: id3v2.EncodingUTF8,
+			Language: "eng",
+			Text:     metadata["description"],
+		})
+	}
+	if metadata["podcast"] == "1" {
+		// iTunes podcast frames: the podcast flag, description and episode
+		// identifier.
+		musicTag.AddFrame("PCST", id3v2.UnknownFrame{Body: []byte{0, 0, 0, 0}})
+		musicTag.AddTextFrame("TDES", id3v2.EncodingUTF8, metadata["description"])
+		musicTag.AddTextFrame("TGID", id3v2.EncodingUTF8, metadata["episode_uri"])
+	}
+	if metadata["length"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("Length"), id3v2.EncodingUTF8, metadata["length"])
+	}
+	if metadata["ISRC"] != "" {
+		musicTag.AddTextFrame(musicTag.CommonID("ISRC"), id3v2.EncodingUTF8, metadata["ISRC"])
+	}
+	// TXXX frames are kept side by side, so those written before by spotdl
+	// are replaced rather than repeated when a file is tagged again.
+	userFrames := musicTag.GetFrames(musicTag.CommonID("User defined text information frame"))
+	musicTag.DeleteFrames(musicTag.CommonID("User defined text information frame"))
+	for _, frame := range userFrames {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok && metadata[udtf.Description] == "" {
+			musicTag.AddUserDefinedTextFrame(udtf)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		if isFreeformTag(key) && key != "ARTISTS" && metadata[key] != "" {
+			musicTag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+				Encoding:    id3v2.EncodingUTF8,
+				Description: key,
+				Value:       metadata[key],
+			})
+		}
+	}
 
-	picFile, err := os.ReadFile(coverFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to read album pic: %v ", err)
+	if len(chapters) > 0 {
+		musicTag.DeleteFrames("CHAP")
+		musicTag.DeleteFrames("CTOC")
+		chap, ctoc := id3Chapters(musicTag.Version(), chapters)
+		for _, body := range chap {
+			musicTag.AddFrame("CHAP", id3v2.UnknownFrame{Body: body})
+		}
+		musicTag.AddFrame("CTOC", id3v2.UnknownFrame{Body: ctoc})
+	}
+
+	var picFile []byte
+	if coverFilePath != "" {
+		if picFile, err = os.ReadFile(coverFilePath); err != nil {
+			return fmt.Errorf("failed to read album pic: %v ", err)
+		}
 	}
 	if len(picFile) > 32 {
 		mime := http.DetectContentType(picFile[:32])
@@ -114,11 +419,8 @@ func addMp3Id3v2(inputFile, coverFilePath string, metadata map[string]string) (e
 			Description: "Front cover",
 			Picture:     picFile,
 		}
+		musicTag.DeleteFrames(musicTag.CommonID("Attached picture"))
 		musicTag.AddAttachedPicture(pic)
 	}
-
-	if err := musicTag.Save(); err != nil {
-		return fmt.Errorf("failed to save id3v2: %v ", err)
-	}
 	return nil
 }
@@ -0,0 +1,271 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// oggContinued flags a page that starts in the middle of a packet.
+const oggContinued = 0x01
+
+// oggPage is a page of an Ogg bitstream.
+type oggPage struct {
+	flags    byte
+	granule  uint64
+	serial   uint32
+	sequence uint32
+	segments []byte
+	body     []byte
+}
+
+// setOggComments replaces the Vorbis comments named by each key of values in
+// an Ogg Vorbis or Opus file with one comment per value, like
+// setFlacComments does for FLAC.
+func setOggComments(path string, values map[string][]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pages, err := readOggPages(data)
+	if err != nil {
+		return fmt.Errorf("%v in %s", err, path)
+	}
+	next, packets, err := oggHeaders(pages)
+	if err != nil {
+		return fmt.Errorf("%v in %s", err, path)
+	}
+
+	prefix, err := commentPacketPrefix(packets[1])
+	if err != nil {
+		return fmt.Errorf("%v in %s", err, path)
+	}
+	block, err := replaceVorbisComments(packets[1][len(prefix):], values)
+	if err != nil {
+		return fmt.Errorf("invalid Vorbis comments in %s: %v", path, err)
+	}
+	packets[1] = append(prefix, block...)
+
+	// The header packets after the first page are paged again, and the pages
+	// of the stream after them numbered on from there.
+	serial := pages[0].serial
+	headers := paginateOgg(serial, pages[0].sequence+1, packets[1:])
+	sequence := pages[0].sequence + 1 + uint32(len(headers))
+	var out bytes.Buffer
+	for i, page := range pages {
+		if i == next {
+			for _, header := range headers {
+				out.Write(header.bytes())
+			}
+		}
+		if page.serial == serial && i > 0 {
+			if i < next {
+				continue
+			}
+			page.sequence = sequence
+			sequence++
+		}
+		out.Write(page.bytes())
+	}
+	if next == len(pages) {
+		for _, header := range headers {
+			out.Write(header.bytes())
+		}
+	}
+
+	tempFile := path + ".tmp" + filepath.Ext(path)
+	if err := os.WriteFile(tempFile, out.Bytes(), 0644); err != nil {
+		return err
+	}
+	return replaceFile(tempFile, path)
+}
+
+// readOggComments returns the Vorbis comments of an Ogg Vorbis or Opus file.
+func readOggComments(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := readOggPages(data)
+	if err != nil {
+		return nil, err
+	}
+	_, packets, err := oggHeaders(pages)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := commentPacketPrefix(packets[1])
+	if err != nil {
+		return nil, err
+	}
+	_, comments, _, err := parseVorbisComments(packets[1][len(prefix):])
+	return comments, err
+}
+
+// commentPacketPrefix returns the header that precedes the comments in the
+// comment packet of Vorbis or Opus.
+func commentPacketPrefix(packet []byte) ([]byte, error) {
+	for _, prefix := range []string{"\x03vorbis", "OpusTags"} {
+		if bytes.HasPrefix(packet, []byte(prefix)) {
+			return []byte(prefix), nil
+		}
+	}
+	return nil, fmt.Errorf("no Vorbis comments")
+}
+
+// readOggPages splits Ogg data into its pages.
+func readOggPages(data []byte) ([]oggPage, error) {
+	var pages []oggPage
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 27 || !bytes.Equal(data[pos:pos+4], []byte("OggS")) {
+			return nil, fmt.Errorf("invalid Ogg page at offset %d", pos)
+		}
+		header := data[pos : pos+27]
+		start := pos + 27 + int(header[26])
+		if start > len(data) {
+			return nil, fmt.Errorf("truncated Ogg page at offset %d", pos)
+		}
+		segments := data[pos+27 : start]
+		end := start
+		for _, n := range segments {
+			end += int(n)
+		}
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated Ogg page at offset %d", pos)
+		}
+		pages = append(pages, oggPage{
+			flags:    header[5],
+			granule:  binary.LittleEndian.Uint64(header[6:14]),
+			serial:   binary.LittleEndian.Uint32(header[14:18]),
+			sequence: binary.LittleEndian.Uint32(header[18:22]),
+			segments: segments,
+			body:     data[start:end],
+		})
+		pos = end
+	}
+	return pages, nil
+}
+
+// oggHeaders returns the header packets of the logical stream starting on
+// the first page: two for Opus and three for Vorbis. The first header fills
+// the first page and the last one ends a page in both formats; the index of
+// the page after them is returned too.
+func oggHeaders(pages []oggPage) (int, [][]byte, error) {
+	if len(pages) == 0 {
+		return 0, nil, fmt.Errorf("no Ogg pages")
+	}
+	serial := pages[0].serial
+	count := 0
+	var packets [][]byte
+	var packet []byte
+	for i, page := range pages {
+		if page.serial != serial {
+			continue
+		}
+		pos := 0
+		for _, n := range page.segments {
+			packet = append(packet, page.body[pos:pos+int(n)]...)
+			pos += int(n)
+			if n < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+
+		if i == 0 {
+			if len(packets) != 1 || packet != nil {
+				return 0, nil, fmt.Errorf("invalid first Ogg page")
+			}
+			switch {
+			case bytes.HasPrefix(packets[0], []byte("OpusHead")):
+				count = 2
+			case bytes.HasPrefix(packets[0], []byte("\x01vorbis")):
+				count = 3
+			default:
+				return 0, nil, fmt.Errorf("no Vorbis or Opus stream")
+			}
+		}
+		if len(packets) >= count {
+			if len(packets) > count || packet != nil {
+				return 0, nil, fmt.Errorf("Ogg headers do not end a page")
+			}
+			return i + 1, packets, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("truncated Ogg headers")
+}
+
+// paginateOgg lays packets out on pages of one logical stream, numbered from
+// sequence. Pages no packet ends on get the granule position -1, as the Ogg
+// spec requires, and the others 0.
+func paginateOgg(serial, sequence uint32, packets [][]byte) []oggPage {
+	var pages []oggPage
+	page := oggPage{serial: serial, sequence: sequence}
+	for _, packet := range packets {
+		for started := false; ; started = true {
+			if len(page.segments) == 255 {
+				pages = append(pages, page)
+				page = oggPage{serial: serial, sequence: sequence + uint32(len(pages))}
+				if started {
+					page.flags = oggContinued
+				}
+			}
+			n := min(len(packet), 255)
+			page.segments = append(page.segments, byte(n))
+			page.body = append(page.body, packet[:n]...)
+			packet = packet[n:]
+			if n < 255 {
+				break
+			}
+		}
+	}
+	pages = append(pages, page)
+	for i := range pages {
+		if !slices.ContainsFunc(pages[i].segments, func(n byte) bool { return n < 255 }) {
+			pages[i].granule = ^uint64(0)
+		}
+	}
+	return pages
+}
+
+// bytes encodes the page with its checksum.
+func (p oggPage) bytes() []byte {
+	out := make([]byte, 27, 27+len(p.segments)+len(p.body))
+	copy(out, "OggS")
+	out[5] = p.flags
+	binary.LittleEndian.PutUint64(out[6:14], p.granule)
+	binary.LittleEndian.PutUint32(out[14:18], p.serial)
+	binary.LittleEndian.PutUint32(out[18:22], p.sequence)
+	out[26] = byte(len(p.segments))
+	out = append(out, p.segments...)
+	out = append(out, p.body...)
+	binary.LittleEndian.PutUint32(out[22:26], oggChecksum(out))
+	return out
+}
+
+// oggCRCTable is the table of the unreflected CRC-32 Ogg pages use.
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+func oggChecksum(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
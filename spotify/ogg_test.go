@@ -0,0 +1,107 @@
+package spotify
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOggChecksum(t *testing.T) {
+	if got := oggChecksum([]byte("123456789")); got != 0x89a1897f {
+		t.Errorf("oggChecksum = %#x, want 0x89a1897f", got)
+	}
+}
+
+func TestSetOggComments(t *testing.T) {
+	ident := append([]byte("\x01vorbis"), bytes.Repeat([]byte{1}, 23)...)
+	setup := append([]byte("\x05vorbis"), bytes.Repeat([]byte{5}, 300)...)
+	comments := append([]byte("\x03vorbis"), vorbisCommentBlock("ffmpeg", "TITLE=Song", "ARTISTS=A; B")...)
+	comments = append(comments, 1)
+
+	// The comment and setup headers share a page, and audio pages of
+	// another stream are interleaved.
+	var file []byte
+	file = append(file, paginateOgg(3, 0, [][]byte{ident})[0].bytes()...)
+	file = append(file, paginateOgg(3, 1, [][]byte{comments, setup})[0].bytes()...)
+	for i, audio := range []string{"frame 1", "frame 2"} {
+		page := paginateOgg(3, uint32(2+i), [][]byte{[]byte(audio)})[0]
+		page.granule = uint64(1000 * (i + 1))
+		file = append(file, page.bytes()...)
+		file = append(file, paginateOgg(9, uint32(i), [][]byte{[]byte("other")})[0].bytes()...)
+	}
+	path := filepath.Join(t.TempDir(), "song.ogg")
+	if err := os.WriteFile(path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A long value spreads the comment header over several pages.
+	long := strings.Repeat("x", 70000)
+	values := map[string][]string{"ARTISTS": {"A", "B; C", long}, "SPOTIFY_ARTIST_ID": {"a1", "a2"}}
+	if err := setOggComments(path, values); err != nil {
+		t.Fatalf("setOggComments: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := readOggPages(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded []byte
+	var sequence []uint32
+	var audio []string
+	for i, page := range pages {
+		encoded = append(encoded, page.bytes()...)
+		if page.serial != 3 {
+			continue
+		}
+		sequence = append(sequence, page.sequence)
+		continued := i > 0 && pages[i-1].serial == 3 && pages[i-1].segments[len(pages[i-1].segments)-1] == 255
+		if continued != (page.flags&oggContinued != 0) {
+			t.Errorf("page %d has flags %#x", page.sequence, page.flags)
+		}
+		// Header pages no packet ends on have the granule position -1.
+		ends := slices.ContainsFunc(page.segments, func(n byte) bool { return n < 255 })
+		switch {
+		case !ends && page.granule != ^uint64(0):
+			t.Errorf("page %d ends no packet but has granule %d", page.sequence, page.granule)
+		case ends && page.granule != 0:
+			audio = append(audio, string(page.body))
+		}
+	}
+	if !bytes.Equal(encoded, data) {
+		t.Error("page checksums do not match")
+	}
+	if want := []uint32{0, 1, 2, 3, 4}; !slices.Equal(sequence, want) {
+		t.Errorf("page sequence = %v, want %v", sequence, want)
+	}
+	if want := []string{"frame 1", "frame 2"}; !slices.Equal(audio, want) {
+		t.Errorf("audio pages = %q, want %q", audio, want)
+	}
+
+	_, packets, err := oggHeaders(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packets[0], ident) || !bytes.Equal(packets[2], setup) {
+		t.Error("identification or setup header changed")
+	}
+	if !bytes.HasSuffix(packets[1], []byte{1}) {
+		t.Error("comment header lost its framing bit")
+	}
+	got, err := readOggComments(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"TITLE=Song", "ARTISTS=A", "ARTISTS=B; C", "ARTISTS=" + long, "SPOTIFY_ARTIST_ID=a1", "SPOTIFY_ARTIST_ID=a2"}; !slices.Equal(got, want) {
+		t.Errorf("comments = %.60q, want %.60q", got, want)
+	}
+	if tags := commentTags(got); tags["ARTISTS"] != "A\x00B; C\x00"+long {
+		t.Errorf("ARTISTS = %.40q, want three values", tags["ARTISTS"])
+	}
+}
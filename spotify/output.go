@@ -0,0 +1,197 @@
+package spotify
+
+import (
+	"fmt"
+	"github.com/XiaoMengXinX/spotdl/config"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// Target is an output file written for every downloaded item. The audio is
+// downloaded and decrypted once and converted for each target that needs a
+// different format.
+type Target struct {
+	// Format is the downloaded format, m4a or ogg, or the name of a
+	// transcoding profile such as mp3 or opus-128.
+	Format string
+	// Template is the output path relative to the output folder, without
+	// extension, e.g. "{artist}/{album}/{title}". Empty uses the configured
+	// template.
+	Template string
+}
+
+const (
+	defaultTemplate = "{title} - {artist}"
+	// defaultAudiobookTemplate puts the chapters of a book in its own
+	// folder, numbered in reading order.
+	defaultAudiobookTemplate = "{album}/{track} - {title}"
+)
+
+var (
+	// sourceFormats are the formats audio is downloaded in. Targets in them
+	// are written without transcoding.
+	sourceFormats = []string{"m4a", "ogg"}
+
+	// builtinProfiles are the transcoding profiles available without
+	// configuration. Profiles in the config file replace them by name.
+	builtinProfiles = map[string]config.Profile{
+		"mp3":      {Codec: "libmp3lame", Container: "mp3"},
+		"mp3-v0":   {Codec: "libmp3lame", Container: "mp3", Quality: "0"},
+		"opus-128": {Codec: "libopus", Container: "opus", Bitrate: "128k"},
+		"aac-256":  {Codec: "aac", Container: "m4a", Bitrate: "256k"},
+		"flac":     {Codec: "flac", Container: "flac"},
+		"wav":      {Codec: "pcm_s16le", Container: "wav"},
+	}
+
+	templateVar   = regexp.MustCompile(`\{(\w+)\}`)
+	templateNames = []string{"title", "artist", "album", "track", "disc", "id", "format"}
+)
+
+// SetTargets sets the files written for every item. Without targets, only
+// the downloaded format is kept. Formats are checked against the profiles
+// once the config file is read.
+func (d *Downloader) SetTargets(targets ...Target) error {
+	for _, target := range targets {
+		if err := validateTemplate(target.Template); err != nil {
+			return err
+		}
+	}
+	d.targets = targets
+	return nil
+}
+
+// SetTemplate sets the path template of targets without their own,
+// overriding the config file.
+func (d *Downloader) SetTemplate(tmpl string) error {
+	if err := validateTemplate(tmpl); err != nil {
+		return err
+	}
+	d.template = tmpl
+	return nil
+}
+
+func (d *Downloader) validateTarget(target Target) error {
+	if _, err := d.targetProfile(target.Format); err != nil {
+		return err
+	}
+	return validateTemplate(target.Template)
+}
+
+// targetProfile returns the profile of format. Source formats have a profile
+// without codec.
+func (d *Downloader) targetProfile(format string) (config.Profile, error) {
+	if slices.Contains(sourceFormats, format) {
+		return config.Profile{Container: format}, nil
+	}
+	profile, ok := d.output.Profiles[format]
+	if !ok {
+		profile, ok = builtinProfiles[format]
+	}
+	if !ok {
+		return profile, fmt.Errorf("%s is not a valid output format or profile", format)
+	}
+	if profile.Codec == "" || profile.Container == "" {
+		return profile, fmt.Errorf("profile %s needs a codec and a container", format)
+	}
+	return profile, nil
+}
+
+func validateTemplate(tmpl string) error {
+	for _, m := range templateVar.FindAllStringSubmatch(tmpl, -1) {
+		if !slices.Contains(templateNames, m[1]) {
+			return fmt.Errorf("unknown template variable {%s} in %q", m[1], tmpl)
+		}
+	}
+	return nil
+}
+
+// initOutput checks the output section of the config file.
+func (d *Downloader) initOutput() error {
+	d.output = d.TokenManager.ConfigManager.Get().Output
+	if err := validateTemplate(d.output.Template); err != nil {
+		return err
+	}
+	if err := validateTemplate(d.output.AudiobookTemplate); err != nil {
+		return err
+	}
+	if err := validateCreditRoles(d.output.Credits.Roles); err != nil {
+		return err
+	}
+	if err := validateArtists(d.output.Artists.FileName); err != nil {
+		return err
+	}
+	if d.chapterFile == ChapterFileNone {
+		if err := d.SetChapterFile(d.output.ChapterFile); err != nil {
+			return err
+		}
+	}
+	for format, tmpl := range d.output.Templates {
+		if err := d.validateTarget(Target{Format: format, Template: tmpl}); err != nil {
+			return err
+		}
+	}
+	if len(d.targets) == 0 {
+		for _, format := range d.output.Formats {
+			d.targets = append(d.targets, Target{Format: format})
+		}
+	}
+	for _, target := range d.targets {
+		if err := d.validateTarget(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputTargets returns the targets for content downloaded in source format,
+// with templates filled in from the config. Audiobook chapters use the
+// audiobook template instead of the per-format ones.
+func (d *Downloader) outputTargets(source string, content IDType) []Target {
+	targets := slices.Clone(d.targets)
+	if len(targets) == 0 {
+		targets = []Target{{Format: source}}
+	}
+	for i, target := range targets {
+		if target.Template == "" {
+			target.Template = d.template
+		}
+		if content == CHAPTER {
+			if target.Template == "" {
+				target.Template = d.output.AudiobookTemplate
+			}
+			if target.Template == "" {
+				target.Template = defaultAudiobookTemplate
+			}
+		}
+		if target.Template == "" {
+			target.Template = d.output.Templates[target.Format]
+		}
+		if target.Template == "" {
+			target.Template = d.output.Template
+		}
+		if target.Template == "" {
+			target.Template = defaultTemplate
+		}
+		targets[i] = target
+	}
+	return targets
+}
+
+// targetPath renders the path of target for an item described by vars.
+func (d *Downloader) targetPath(target Target, vars map[string]string) (string, error) {
+	profile, err := d.targetProfile(target.Format)
+	if err != nil {
+		return "", err
+	}
+	vars["format"] = target.Format
+	return filepath.Join(d.outputFolder, renderTemplate(target.Template, vars)) + "." + profile.Container, nil
+}
+
+// renderTemplate replaces the variables in tmpl. Values are cleaned so they
+// cannot add path separators.
+func renderTemplate(tmpl string, vars map[string]string) string {
+	return templateVar.ReplaceAllStringFunc(tmpl, func(m string) string {
+		return cleanFilename(vars[m[1:len(m)-1]])
+	})
+}
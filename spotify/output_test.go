@@ -0,0 +1,102 @@
+package spotify_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+	"github.com/XiaoMengXinX/spotdl/spotify"
+)
+
+func TestOutputTemplates(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Templates", 1)
+	id := album.TrackIDs[0]
+	track := fixtures.Tracks[id]
+	d, out := newTestDownloader(t, srv, map[string]any{
+		"output": map[string]any{"template": "{artist}/{album}/{title}"},
+	})
+
+	path, err := d.DownloadTrack(id)
+	if err != nil {
+		t.Fatalf("DownloadTrack: %v", err)
+	}
+	want := filepath.Join(out, track.Artists[0].Name, album.Name, track.Name+".m4a")
+	if path != want {
+		t.Errorf("DownloadTrack path = %s, want %s", path, want)
+	}
+	assertAudioFile(t, want)
+
+	// A target's own template wins over the config file.
+	if err := d.SetTargets(spotify.Target{Format: "m4a", Template: "archive/{id}"}); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	d.SetHooks(spotify.Hooks{OnComplete: func(ev spotify.Event, err error) { paths = ev.Paths }})
+	if _, err := d.DownloadTrack(id); err != nil {
+		t.Fatalf("DownloadTrack: %v", err)
+	}
+	want = filepath.Join(out, "archive", id+".m4a")
+	if len(paths) != 1 || paths[0] != want {
+		t.Errorf("output paths = %v, want [%s]", paths, want)
+	}
+	assertAudioFile(t, want)
+	if n := srv.Hits("license"); n != 2 {
+		t.Errorf("license endpoint hit %d times, want 2", n)
+	}
+}
+
+func TestInvalidTargets(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Invalid", 1)
+	d, _ := newTestDownloader(t, srv, map[string]any{
+		"output": map[string]any{"profiles": map[string]any{"opus-64": map[string]any{"codec": "libopus"}}},
+	})
+
+	if err := d.SetTemplate("{title} - {year}"); err == nil {
+		t.Error("SetTemplate accepted an unknown variable")
+	}
+	for _, targets := range [][]spotify.Target{
+		{{Format: "wma"}},
+		{{Format: "opus-64"}},
+		{{Format: "m4a"}, {Format: "aac-256"}},
+	} {
+		if err := d.SetTargets(targets...); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.DownloadTrack(album.TrackIDs[0]); err == nil {
+			t.Errorf("DownloadTrack with targets %+v succeeded", targets)
+		}
+	}
+}
+
+func TestDiscNumbers(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Box Set", 60)
+	album.Type = "compilation"
+	for i, id := range album.TrackIDs[30:] {
+		fixtures.Tracks[id].DiscNumber, fixtures.Tracks[id].TrackNumber = 2, i+1
+	}
+	d, out := newTestDownloader(t, srv, map[string]any{
+		"output": map[string]any{"template": "{album}/Disc {disc}/{track} - {title}"},
+	})
+
+	first, last := fixtures.Tracks[album.TrackIDs[0]], fixtures.Tracks[album.TrackIDs[59]]
+	for track, want := range map[*spotifytest.Track]string{first: "1/2", last: "2/2"} {
+		tags, err := d.TrackTags(track.ID)
+		if err != nil {
+			t.Fatalf("TrackTags: %v", err)
+		}
+		if tags["disc"] != want || tags["compilation"] != "1" {
+			t.Errorf("disc and compilation of %s = %q, %q, want %q, 1", track.Name, tags["disc"], tags["compilation"], want)
+		}
+	}
+
+	path, err := d.DownloadTrack(last.ID)
+	if err != nil {
+		t.Fatalf("DownloadTrack: %v", err)
+	}
+	if want := filepath.Join(out, album.Name, "Disc 2", "30 - "+last.Name+".m4a"); path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+}
@@ -0,0 +1,91 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+
+	log "github.com/XiaoMengXinX/spotdl/logger"
+)
+
+func fetchPage[T any](d *Downloader, url string) (pagingData[T], error) {
+	data, err := d.makeRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Debugf("Fetch page failed: %v", err)
+		return pagingData[T]{}, err
+	}
+
+	var page pagingData[T]
+	if err := json.Unmarshal(data, &page); err != nil {
+		return pagingData[T]{}, fmt.Errorf("failed to decode page: %w", err)
+	}
+	return page, nil
+}
+
+// paginate fetches the first page at url and returns the total item count
+// along with an iterator over the items of every page. Further pages are
+// requested lazily by following next until it is empty, a page is empty or
+// does not move past the one before it, or the total is reached.
+func paginate[T any](d *Downloader, url string) (int, iter.Seq2[[]T, error], error) {
+	first, err := fetchPage[T](d, url)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	pages := func(yield func([]T, error) bool) {
+		page := first
+		count := 0
+		for {
+			count += len(page.Items)
+			if !yield(page.Items, nil) || page.Next == "" || len(page.Items) == 0 || (page.Total > 0 && count >= page.Total) {
+				return
+			}
+			next, err := fetchPage[T](d, page.Next)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if next.Offset <= page.Offset {
+				log.Warnf("Page [%s] does not advance past offset %d, stopping after %d of %d items", page.Next, page.Offset, count, first.Total)
+				return
+			}
+			page = next
+		}
+	}
+	return first.Total, pages, nil
+}
+
+// paginateIDs is paginate for listings of tracks or episodes. Items without
+// an ID, such as removed playlist entries, are skipped. onPage, if not nil,
+// receives the IDs of each page before they are yielded.
+func paginateIDs[T any](d *Downloader, url string, id func(T) string, onPage func([]string)) (int, iter.Seq2[string, error], error) {
+	total, pages, err := paginate[T](d, url)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	ids := func(yield func(string, error) bool) {
+		for items, err := range pages {
+			if err != nil {
+				yield("", err)
+				return
+			}
+			pageIDs := make([]string, 0, len(items))
+			for _, item := range items {
+				if itemID := id(item); itemID != "" {
+					pageIDs = append(pageIDs, itemID)
+				}
+			}
+			if onPage != nil && len(pageIDs) > 0 {
+				onPage(pageIDs)
+			}
+			for _, itemID := range pageIDs {
+				if !yield(itemID, nil) {
+					return
+				}
+			}
+		}
+	}
+	return total, ids, nil
+}
@@ -0,0 +1,80 @@
+package spotify_test
+
+import (
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+)
+
+func TestTracksStreaming(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Stream", 250)
+	d, _ := newTestDownloader(t, srv)
+
+	total, ids, err := d.Tracks(spotifytest.URL("album", album.ID))
+	if err != nil {
+		t.Fatalf("Tracks: %v", err)
+	}
+	if total != 250 {
+		t.Errorf("total = %d, want 250", total)
+	}
+	for id, err := range ids {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != album.TrackIDs[0] {
+			t.Fatalf("first id = %s, want %s", id, album.TrackIDs[0])
+		}
+		break
+	}
+	if n := srv.Hits("web-album-tracks"); n != 1 {
+		t.Errorf("album tracks fetched in %d pages before the first item was consumed, want 1", n)
+	}
+}
+
+func TestTracksFollowsNext(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	// Pages shorter than the requested limit must not end the listing.
+	srv.MaxPageSize = 30
+	playlist := fixtures.AddPlaylist("Short Pages", fixtures.AddAlbum("Short", 95).TrackIDs)
+	d, _ := newTestDownloader(t, srv)
+
+	got, err := d.GetTracks(spotifytest.URL("playlist", playlist.ID))
+	if err != nil {
+		t.Fatalf("GetTracks: %v", err)
+	}
+	if len(got) != 95 {
+		t.Errorf("GetTracks returned %d tracks, want 95", len(got))
+	}
+	if n := srv.Hits("web-playlist-tracks"); n != 4 {
+		t.Errorf("playlist fetched in %d pages, want 4", n)
+	}
+}
+
+func TestTracksStopsOnRepeatedPage(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	srv.MaxPageSize = 30
+	srv.RepeatPages = true
+	playlist := fixtures.AddPlaylist("Stuck", fixtures.AddAlbum("Stuck", 95).TrackIDs)
+	d, _ := newTestDownloader(t, srv)
+
+	_, ids, err := d.Tracks(spotifytest.URL("playlist", playlist.ID))
+	if err != nil {
+		t.Fatalf("Tracks: %v", err)
+	}
+	n := 0
+	for _, err := range ids {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n++; n > 95 {
+			t.Fatal("Tracks kept following a page that links to itself")
+		}
+	}
+	if n != 30 {
+		t.Errorf("Tracks returned %d tracks, want the 30 of the first page", n)
+	}
+	if n := srv.Hits("web-playlist-tracks"); n != 2 {
+		t.Errorf("playlist fetched %d times, want 2", n)
+	}
+}
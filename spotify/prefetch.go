@@ -0,0 +1,102 @@
+package spotify
+
+import (
+	"slices"
+	"sync"
+
+	log "github.com/XiaoMengXinX/spotdl/logger"
+)
+
+// Maximum number of IDs accepted by the Web API multi-ID endpoints.
+const (
+	maxTracksPerRequest = 50
+	maxAlbumsPerRequest = 20
+)
+
+// metadataStore keeps Web API objects fetched in batches so that the
+// per-track pipeline does not have to request them one by one.
+type metadataStore struct {
+	mu     sync.RWMutex
+	tracks map[string]trackData
+	albums map[string]albumData
+}
+
+func newMetadataStore() *metadataStore {
+	return &metadataStore{
+		tracks: make(map[string]trackData),
+		albums: make(map[string]albumData),
+	}
+}
+
+// prefetchMetadata fetches the track objects of trackIDs and the albums they
+// belong to using the multi-ID endpoints. Failures are not fatal: anything
+// missing from the store is fetched individually later.
+func (d *Downloader) prefetchMetadata(trackIDs []string) {
+	seen := make(map[string]bool)
+	var missing, albumIDs []string
+
+	d.prefetched.mu.RLock()
+	for _, id := range trackIDs {
+		if _, ok := d.prefetched.tracks[id]; !ok && !seen[id] {
+			seen[id] = true
+			missing = append(missing, id)
+		}
+	}
+	d.prefetched.mu.RUnlock()
+
+	for batch := range slices.Chunk(missing, maxTracksPerRequest) {
+		tracks, err := d.queryTracksAPI(batch)
+		if err != nil {
+			log.Warnf("Failed to prefetch track data: %v", err)
+			continue
+		}
+		d.prefetched.mu.Lock()
+		for _, track := range tracks {
+			if track == nil || track.ID == "" {
+				continue
+			}
+			d.prefetched.tracks[track.ID] = *track
+			if _, ok := d.prefetched.albums[track.Album.ID]; !ok && track.Album.ID != "" && !seen[track.Album.ID] {
+				seen[track.Album.ID] = true
+				albumIDs = append(albumIDs, track.Album.ID)
+			}
+		}
+		d.prefetched.mu.Unlock()
+	}
+
+	for batch := range slices.Chunk(albumIDs, maxAlbumsPerRequest) {
+		albums, err := d.queryAlbumsAPI(batch)
+		if err != nil {
+			log.Warnf("Failed to prefetch album data: %v", err)
+			continue
+		}
+		d.prefetched.mu.Lock()
+		for _, album := range albums {
+			if album != nil && album.ID != "" {
+				d.prefetched.albums[album.ID] = *album
+			}
+		}
+		d.prefetched.mu.Unlock()
+	}
+	log.Debugf("Prefetched %d track(s) and %d album(s)", len(missing), len(albumIDs))
+}
+
+func (d *Downloader) lookupTrack(trackID string) (trackData, error) {
+	d.prefetched.mu.RLock()
+	track, ok := d.prefetched.tracks[trackID]
+	d.prefetched.mu.RUnlock()
+	if ok {
+		return track, nil
+	}
+	return d.queryTrackAPI(trackID)
+}
+
+func (d *Downloader) lookupAlbum(albumID string) (albumData, error) {
+	d.prefetched.mu.RLock()
+	album, ok := d.prefetched.albums[albumID]
+	d.prefetched.mu.RUnlock()
+	if ok {
+		return album, nil
+	}
+	return d.queryAlbumAPI(albumID)
+}
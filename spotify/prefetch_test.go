@@ -0,0 +1,61 @@
+package spotify_test
+
+import (
+	"testing"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+)
+
+func TestPrefetchMetadata(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	var trackIDs []string
+	for range 6 {
+		trackIDs = append(trackIDs, fixtures.AddAlbum("Batch", 50).TrackIDs...)
+	}
+	playlist := fixtures.AddPlaylist("Large", trackIDs)
+	d, _ := newTestDownloader(t, srv)
+
+	tracks, err := d.GetTracks(spotifytest.URL("playlist", playlist.ID))
+	if err != nil {
+		t.Fatalf("GetTracks: %v", err)
+	}
+	d.PrefetchMetadata(tracks)
+
+	// 300 tracks fit in six 50-ID requests, their six albums in one.
+	if n := srv.Hits("web-tracks"); n != 6 {
+		t.Errorf("web-tracks hit %d times, want 6", n)
+	}
+	if n := srv.Hits("web-albums"); n != 1 {
+		t.Errorf("web-albums hit %d times, want 1", n)
+	}
+
+	for _, id := range tracks {
+		tags, err := d.TrackTags(id)
+		if err != nil {
+			t.Fatalf("TrackTags(%s): %v", id, err)
+		}
+		track := fixtures.Tracks[id]
+		if want := fixtures.Albums[track.AlbumID].UPC; tags["UPC"] != want {
+			t.Fatalf("UPC = %q, want %q", tags["UPC"], want)
+		}
+		if tags["ISRC"] != track.ISRC {
+			t.Fatalf("ISRC = %q, want %q", tags["ISRC"], track.ISRC)
+		}
+	}
+	if n := srv.Hits("web-track") + srv.Hits("web-album"); n != 0 {
+		t.Errorf("per-ID Web API endpoints hit %d times after prefetch, want 0", n)
+	}
+}
+
+func TestPrefetchFallback(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Unprefetched", 2)
+	d, _ := newTestDownloader(t, srv)
+
+	if _, err := d.TrackTags(album.TrackIDs[0]); err != nil {
+		t.Fatalf("TrackTags: %v", err)
+	}
+	if n := srv.Hits("web-track"); n != 1 {
+		t.Errorf("web-track hit %d times without prefetch, want 1", n)
+	}
+}
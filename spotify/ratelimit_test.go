@@ -0,0 +1,51 @@
+package spotify_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitedRetry(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Throttled", 1)
+	d, out := newTestDownloader(t, srv, map[string]any{
+		"rateLimit": map[string]any{"requestsPerSecond": 50, "burst": 5},
+	})
+
+	srv.Throttle(1)
+	srv.ResetHits()
+	start := time.Now()
+	if _, err := d.DownloadTrack(album.TrackIDs[0]); err != nil {
+		t.Fatalf("DownloadTrack: %v", err)
+	}
+	assertAudioFile(t, trackFile(out, fixtures, album.TrackIDs[0]))
+	// The 429 pauses the host for the default backoff of one second.
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("download after a 429 took %v, want at least 1s", elapsed)
+	}
+	if n := srv.Hits("metadata"); n != 2 {
+		t.Errorf("throttled metadata request sent %d times, want 2", n)
+	}
+}
+
+func TestRateLimitDisabledRetryAfter(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Unlimited", 1)
+	d, _ := newTestDownloader(t, srv, map[string]any{
+		"rateLimit": map[string]any{"disabled": true},
+	})
+
+	// Without a rate limit, the retry still waits for the Retry-After.
+	srv.ThrottleRetryAfter(1, 2)
+	srv.ResetHits()
+	start := time.Now()
+	if _, err := d.DownloadTrack(album.TrackIDs[0]); err != nil {
+		t.Fatalf("DownloadTrack: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("download after a 429 with Retry-After: 2 took %v, want at least 2s", elapsed)
+	}
+	if n := srv.Hits("metadata"); n != 2 {
+		t.Errorf("throttled metadata request sent %d times, want 2", n)
+	}
+}
@@ -0,0 +1,148 @@
+package spotify
+
+import (
+	"fmt"
+	"github.com/Sorrow446/go-mp4tag"
+	"github.com/bogem/id3v2"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tagFormats are the file extensions readFileTags reads.
+var tagFormats = []string{".mp3", ".m4a", ".flac", ".ogg", ".opus", ".wav"}
+
+// readFileTags reads the tags of an audio file written by writeTags. Keys are
+// uppercased, so the common tags such as TITLE, ALBUM_ARTIST, TRACK, ISRC and
+// the SPOTIFY_* tags read the same from every container; values of
+// multi-value tags are joined by multiValueSeparator.
+func readFileTags(path string) (map[string]string, error) {
+	var tags map[string]string
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		var tag *id3v2.Tag
+		if tag, err = id3v2.Open(path, id3v2.Options{Parse: true}); err == nil {
+			tags = id3Tags(tag)
+			tag.Close()
+		}
+	case ".wav":
+		var tag *id3v2.Tag
+		if tag, err = readWavID3(path); err == nil {
+			tags = id3Tags(tag)
+		}
+	case ".m4a":
+		tags, err = readMP4Tags(path)
+	case ".flac":
+		var comments []string
+		if comments, err = readFlacComments(path); err == nil {
+			tags = commentTags(comments)
+		}
+	case ".ogg", ".opus":
+		var comments []string
+		if comments, err = readOggComments(path); err == nil {
+			tags = commentTags(comments)
+		}
+	default:
+		return nil, fmt.Errorf("reading tags of %s is not supported", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags of %s: %v", path, err)
+	}
+	return tags, nil
+}
+
+// id3Tags reads the tags of an MP3 file or of the ID3 chunk of a WAV file.
+func id3Tags(tag *id3v2.Tag) map[string]string {
+	// TPE1 holds one value per artist, like ARTISTS elsewhere.
+	tags := map[string]string{
+		"TITLE":        tag.Title(),
+		"ARTIST":       tag.Artist(),
+		"ARTISTS":      tag.Artist(),
+		"ALBUM":        tag.Album(),
+		"ALBUM_ARTIST": tag.GetTextFrame(tag.CommonID("Band/Orchestra/Accompaniment")).Text,
+		"DATE":         tag.Year(),
+		"TRACK":        tag.GetTextFrame(tag.CommonID("Track number/Position in set")).Text,
+		"DISC":         tag.GetTextFrame(tag.CommonID("Part of a set")).Text,
+		"GENRE":        tag.Genre(),
+		"ISRC":         tag.GetTextFrame(tag.CommonID("ISRC")).Text,
+		"LENGTH":       tag.GetTextFrame(tag.CommonID("Length")).Text,
+	}
+	for _, frame := range tag.GetFrames(tag.CommonID("User defined text information frame")) {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok {
+			tags[strings.ToUpper(udtf.Description)] = udtf.Value
+		}
+	}
+	return tags
+}
+
+func readMP4Tags(path string) (map[string]string, error) {
+	mp4, err := mp4tag.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer mp4.Close()
+	read, err := mp4.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]string{
+		"TITLE":        read.Title,
+		"ARTIST":       read.Artist,
+		"ALBUM":        read.Album,
+		"ALBUM_ARTIST": read.AlbumArtist,
+		"DATE":         read.Date,
+		"GENRE":        read.CustomGenre,
+		"TRACK":        numberOf(read.TrackNumber, read.TrackTotal),
+		"DISC":         numberOf(read.DiscNumber, read.DiscTotal),
+	}
+	// Further values of a freeform atom are its values after the first.
+	for key, value := range read.Custom {
+		key = strings.ToUpper(key)
+		tags[key] = strings.Join(append([]string{value}, read.OtherCustom[key]...), multiValueSeparator)
+	}
+	return tags, nil
+}
+
+// numberOf formats a track or disc number as it is tagged elsewhere.
+func numberOf(n, total int16) string {
+	switch {
+	case n == 0:
+		return ""
+	case total == 0:
+		return strconv.Itoa(int(n))
+	default:
+		return fmt.Sprintf("%d/%d", n, total)
+	}
+}
+
+// vorbisNames are the comment names ffmpeg writes for tags whose names
+// differ in other containers.
+var vorbisNames = map[string]string{
+	"ALBUMARTIST": "ALBUM_ARTIST",
+	"TRACKNUMBER": "TRACK",
+	"DISCNUMBER":  "DISC",
+}
+
+// commentTags turns Vorbis comments into tags. Repeated comments are the
+// values of a multi-value tag.
+func commentTags(comments []string) map[string]string {
+	tags := make(map[string]string)
+	for _, comment := range comments {
+		name, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		name = strings.ToUpper(name)
+		if tag, ok := vorbisNames[name]; ok {
+			name = tag
+		}
+		if tags[name] != "" {
+			tags[name] += multiValueSeparator + value
+		} else {
+			tags[name] = value
+		}
+	}
+	return tags
+}
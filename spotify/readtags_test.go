@@ -0,0 +1,148 @@
+package spotify
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bogem/id3v2"
+)
+
+// oggPages lays packets out on the pages of a logical stream.
+func oggPages(serial uint32, packets ...[]byte) []byte {
+	var data []byte
+	for _, page := range paginateOgg(serial, 0, packets) {
+		data = append(data, page.bytes()...)
+	}
+	return data
+}
+
+func TestFileIDType(t *testing.T) {
+	dir := t.TempDir()
+	metadata := map[string]string{
+		"title":             "Song",
+		"SPOTIFY_TRACK_ID":  "4uLU6hMCjMI75M1A2tKUQC",
+		"SPOTIFY_ARTIST_ID": "a1\x00a2",
+		"SPOTIFY_URI":       "spotify:track:6rqhFgbbKwnb9MLmUQDhG6",
+		"ISRC":              "TEST00000001",
+		"description":       "Notes",
+	}
+	comments := vorbisCommentBlock("ffmpeg", "TITLE=Song", "SPOTIFY_URI=spotify:chapter:ch1", "SPOTIFY_ARTIST_ID=a1", "SPOTIFY_ARTIST_ID=a2")
+
+	mp3 := filepath.Join(dir, "song.mp3")
+	if err := os.WriteFile(mp3, bytes.Repeat([]byte{0xff}, 64), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Tagging again replaces the frames written before instead of adding
+	// to them.
+	for range 2 {
+		if err := addMp3Id3v2(mp3, "", metadata, nil); err != nil {
+			t.Fatalf("addMp3Id3v2: %v", err)
+		}
+	}
+	tag, err := id3v2.Open(mp3, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tag.GetFrames("TXXX")); n != 3 {
+		t.Errorf("mp3 has %d TXXX frames after tagging twice, want 3", n)
+	}
+	if n := len(tag.GetFrames("COMM")); n != 1 {
+		t.Errorf("mp3 has %d comments after tagging twice, want 1", n)
+	}
+	tag.Close()
+	if tags, err := readFileTags(mp3); err != nil || tags["ISRC"] != metadata["ISRC"] {
+		t.Errorf("mp3 ISRC = %q (%v), want %s", tags["ISRC"], err, metadata["ISRC"])
+	}
+
+	// WAV files keep the tags in an ID3 chunk after the audio.
+	wav := filepath.Join(dir, "song.wav")
+	fmtChunk := bytes.Repeat([]byte{1}, 16)
+	if err := os.WriteFile(wav, writeWavChunks([]riffChunk{{"fmt ", fmtChunk}, {"data", []byte("audio")}}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := addWavID3(wav, "", metadata, nil); err != nil {
+			t.Fatalf("addWavID3: %v", err)
+		}
+	}
+	data, err := os.ReadFile(wav)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := readWavChunks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 || !bytes.Equal(chunks[0].data, fmtChunk) || string(chunks[1].data) != "audio" || chunks[2].id != wavID3Chunk {
+		t.Errorf("wav chunks = %q, want fmt, data and one ID3 chunk", chunks)
+	}
+
+	flac := filepath.Join(dir, "song.flac")
+	var file bytes.Buffer
+	file.WriteString("fLaC")
+	file.Write([]byte{0x80 | flacVorbisComment, 0, 0, byte(len(comments))})
+	file.Write(comments)
+	if err := os.WriteFile(flac, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opus := filepath.Join(dir, "song.opus")
+	tagsPacket := append([]byte("OpusTags"), vorbisCommentBlock("ffmpeg", "SPOTIFY_URI=spotify:episode:ep1", "SPOTIFY_ARTIST_ID=a1", "SPOTIFY_ARTIST_ID=a2")...)
+	tagsPacket = append(tagsPacket, bytes.Repeat([]byte{0}, 300)...)
+	var ogg []byte
+	ogg = append(ogg, oggPages(2, []byte("OpusHead"))...)
+	ogg = append(ogg, oggPages(7, []byte("other stream"))...)
+	ogg = append(ogg, oggPages(2, tagsPacket)...)
+	if err := os.WriteFile(opus, ogg, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		id     string
+		idType IDType
+	}{
+		{mp3, "6rqhFgbbKwnb9MLmUQDhG6", TRACK},
+		{wav, "6rqhFgbbKwnb9MLmUQDhG6", TRACK},
+		{flac, "ch1", CHAPTER},
+		{opus, "ep1", EPISODE},
+	} {
+		id, idType, err := ParseInput(tt.path)
+		if err != nil {
+			t.Errorf("ParseInput(%s): %v", filepath.Base(tt.path), err)
+			continue
+		}
+		if id != tt.id || idType != tt.idType {
+			t.Errorf("ParseInput(%s) = %s, %s, want %s, %s", filepath.Base(tt.path), id, idType, tt.id, tt.idType)
+		}
+		tags, err := readFileTags(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags["SPOTIFY_ARTIST_ID"] != "a1\x00a2" {
+			t.Errorf("%s SPOTIFY_ARTIST_ID = %q, want a1 and a2", filepath.Base(tt.path), tags["SPOTIFY_ARTIST_ID"])
+		}
+	}
+
+	// A file named like an ID is not taken for a path.
+	t.Chdir(dir)
+	if err := os.WriteFile("6rqhFgbbKwnb9MLmUQDhG6", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if id, idType, err := ParseInput("6rqhFgbbKwnb9MLmUQDhG6"); err != nil || id != "6rqhFgbbKwnb9MLmUQDhG6" || idType != TRACK {
+		t.Errorf("ParseInput of an ID matching a file = %s, %s, %v, want the track ID", id, idType, err)
+	}
+	if id, _, err := ParseInput("song.flac"); err != nil || id != "ch1" {
+		t.Errorf("ParseInput(song.flac) = %s, %v, want ch1", id, err)
+	}
+	// GetIDType only looks at the string.
+	if id, _, err := GetIDType("song.flac"); err != nil || id != "song.flac" {
+		t.Errorf("GetIDType(song.flac) = %s, %v, want the input as a track ID", id, err)
+	}
+
+	if _, _, err := ParseInput(filepath.Join(dir, "missing.mp3")); err != nil {
+		t.Errorf("ParseInput of a missing file should fall back to a track ID, got %v", err)
+	}
+}
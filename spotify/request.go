@@ -2,50 +2,137 @@ package spotify
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"time"
 
+	"github.com/XiaoMengXinX/spotdl/bandwidth"
+	"github.com/XiaoMengXinX/spotdl/httpclient"
 	log "github.com/XiaoMengXinX/spotdl/logger"
+	"github.com/XiaoMengXinX/spotdl/ratelimit"
+	"github.com/XiaoMengXinX/spotdl/token"
 )
 
+// maxRateLimitRetries is how many times a request answered with 429 is
+// retried after the rate limiter's backoff.
+const maxRateLimitRetries = 3
+
+// statusError is returned by makeRequest for non-200 responses.
+type statusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("request to [%s] failed with status [%d]", e.URL, e.StatusCode)
+}
+
 func (d *Downloader) makeRequest(method, url string, body []byte) ([]byte, error) {
-	accessToken, _ := d.TokenManager.GetAccessToken()
-	if accessToken == "" {
-		return nil, fmt.Errorf("invalid access token")
+	var acceptLanguage string
+	if languages := d.TokenManager.ConfigManager.Get().AcceptLanguage; len(languages) > 0 {
+		acceptLanguage = generateAcceptLanguageHeader(languages)
 	}
 
-	var requestBody io.Reader
-	if body != nil {
-		requestBody = bytes.NewBuffer(body)
+	endpoint := d.cacheEndpoint(method, url)
+	cacheKey := d.cacheKey(url, acceptLanguage)
+	if endpoint != "" {
+		if data, ok := d.cachedResponse(cacheKey); ok {
+			log.Debugf("[%s] %s (cached)", method, url)
+			return data, nil
+		}
+		if d.isOfflineMetadata {
+			return nil, fmt.Errorf("[%s] is not cached and offline metadata mode is enabled", url)
+		}
 	}
 
-	req, err := d.TokenManager.NewRequest(method, url, requestBody)
+	tok, err := d.TokenSource.Token()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	if acceptLanguage := d.TokenManager.ConfigManager.Get().AcceptLanguage; len(acceptLanguage) > 0 {
-		req.Header.Set("Accept-Language", generateAcceptLanguageHeader(acceptLanguage))
+
+	var data []byte
+	for attempt := 0; ; attempt++ {
+		var requestBody io.Reader
+		if body != nil {
+			requestBody = bytes.NewBuffer(body)
+		}
+
+		req, err := token.NewRequest(method, url, requestBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+		if tok.ClientToken != "" {
+			req.Header.Set("client-token", tok.ClientToken)
+		}
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+
+		data, err = d.doRequest(req)
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitRetries {
+			log.Warnf("Rate limited by [%s], retrying", req.URL.Host)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	if endpoint != "" {
+		d.storeResponse(cacheKey, endpoint, data)
+	}
+	return data, nil
+}
+
+// doRequest sends req through the request rate limiter.
+func (d *Downloader) doRequest(req *http.Request) ([]byte, error) {
+	host := req.URL.Host
+	if err := d.requestLimiter.Wait(req.Context(), host); err != nil {
+		return nil, err
 	}
 
-	log.Debugf("[%s] %s", method, url)
+	log.Debugf("[%s] %s", req.Method, req.URL)
 	log.Debugf("Headers: %+v", req.Header)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	// The API timeout only counts time on the network, not the bandwidth
+	// limiter's waits, which can be long with a low limit.
+	client := d.httpClient
+	if client.Timeout > 0 {
+		ctx, cancel := bandwidth.WithTimeout(req.Context(), client.Timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+		client = httpclient.WithoutTimeout(client)
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
+		if cause := context.Cause(req.Context()); cause == context.DeadlineExceeded {
+			return nil, fmt.Errorf("request failed: %w: %w", err, cause)
+		}
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		d.requestLimiter.Backoff(host, ratelimit.RetryAfter(resp))
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request to [%s] failed with status [%d]", url, resp.StatusCode)
+		return nil, &statusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
 	}
-	return io.ReadAll(resp.Body)
+	d.requestLimiter.Success(host)
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return data, nil
 }
 
 func (d *Downloader) downloadURL(url, filename string) error {
@@ -61,8 +148,7 @@ func (d *Downloader) downloadURL(url, filename string) error {
 	log.Debugf("[%s] %s", "GET", url)
 	log.Debugf("Headers: %+v", req.Header)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpclient.WithoutTimeout(d.httpClient).Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %v", err)
 	}
@@ -0,0 +1,251 @@
+package spotify
+
+import (
+	"fmt"
+	log "github.com/XiaoMengXinX/spotdl/logger"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// How a file was identified by Retag.
+const (
+	MatchTag    = "tag"
+	MatchISRC   = "isrc"
+	MatchSearch = "search"
+)
+
+// retagDiffTags are the tags compared for a dry run, named as in metadata
+// maps.
+var retagDiffTags = []string{
+	"title", "artist", "ARTISTS", "album", "album_artist", "date", "track", "disc", "genre", "ISRC", "UPC",
+	"SPOTIFY_TRACK_ID", "SPOTIFY_ALBUM_ID", "SPOTIFY_ARTIST_ID", "SPOTIFY_URI",
+}
+
+// retagLengthTolerance is how much the length of a file may differ from that
+// of a search result it is matched to.
+const retagLengthTolerance = 3 * time.Second
+
+// leadingNumber matches the track number file names may start with.
+var leadingNumber = regexp.MustCompile(`^\d+[\s.\-_]+`)
+
+// RetagResult is the outcome of tagging one file again.
+type RetagResult struct {
+	Path string
+	ID   string
+	Type IDType
+	// Match is how the file was identified: MatchTag, MatchISRC or
+	// MatchSearch.
+	Match   string
+	Changes []TagChange
+	Err     error
+}
+
+// TagChange is a tag whose value differs from the one in the file. Values of
+// multi-value tags are separated by null bytes.
+type TagChange struct {
+	Tag string
+	Old string
+	New string
+}
+
+// Retag tags the audio files under dir again without downloading them. Each
+// file is identified by its embedded Spotify ID, then by its ISRC tag, then by
+// searching for its file name. With dryRun, the tag changes are only
+// reported. Files that fail are reported in their result.
+func (d *Downloader) Retag(dir string, dryRun bool) ([]RetagResult, error) {
+	var results []RetagResult
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !slices.Contains(tagFormats, strings.ToLower(filepath.Ext(path))) || strings.Contains(entry.Name(), ".tmp.") {
+			return nil
+		}
+		result := d.retagFile(path, dryRun)
+		if result.Err != nil {
+			log.Errorf("Failed to retag [%s]: %v", path, result.Err)
+		}
+		results = append(results, result)
+		return nil
+	})
+	return results, err
+}
+
+func (d *Downloader) retagFile(path string, dryRun bool) (result RetagResult) {
+	result.Path = path
+	ext := strings.ToLower(filepath.Ext(path))
+
+	old, err := readFileTags(path)
+	if err != nil {
+		// Untagged or foreign files can still be matched by name.
+		log.Debugf("Reading tags of [%s] failed: %v", path, err)
+		old = make(map[string]string)
+	}
+	result.ID, result.Type, result.Match, result.Err = d.identifyFile(path, old)
+	if result.Err != nil {
+		return result
+	}
+	log.Debugf("Identified [%s] as %s %s by %s", path, result.Type, result.ID, result.Match)
+
+	var metadata map[string]string
+	var cover func() (string, error)
+	switch result.Type {
+	case TRACK:
+		trackMD, err := d.queryTrackMetadata(result.ID)
+		if err != nil {
+			result.Err = fmt.Errorf("failed to fetch track metadata: %v", err)
+			return result
+		}
+		if metadata, err = d.buildMetadata(trackMD); err != nil {
+			result.Err = err
+			return result
+		}
+		cover = func() (string, error) { return d.downloadCoverImage(trackMD) }
+	case EPISODE, CHAPTER:
+		_, _, _, episodeMD, err := d.getEpisodeOrChapter(result.Type, result.ID)
+		if err != nil {
+			result.Err = fmt.Errorf("failed to fetch %s metadata: %v", result.Type, err)
+			return result
+		}
+		if result.Type == EPISODE {
+			metadata = buildEpisodeMetadata(result.ID, episodeMD)
+		} else {
+			metadata = buildChapterMetadata(result.ID, episodeMD)
+		}
+		cover = func() (string, error) { return d.downloadEpisodeCover(episodeMD) }
+	default:
+		result.Err = fmt.Errorf("cannot retag %s content", result.Type)
+		return result
+	}
+
+	keys := retagDiffTags
+	if ext == ".mp3" {
+		// MP3 files only keep the list of artists.
+		keys = slices.DeleteFunc(slices.Clone(keys), func(key string) bool { return key == "artist" })
+	}
+	result.Changes = diffTags(old, metadata, keys)
+	if dryRun {
+		return result
+	}
+	if ext != ".mp3" && !hasFFmpeg {
+		result.Err = fmt.Errorf("ffmpeg not found, it is needed to tag %s files", ext)
+		return result
+	}
+
+	coverFileName, err := cover()
+	if err != nil {
+		log.Warnf("Failed to download cover image: %v, skip adding front cover", err)
+	}
+	if result.Err = d.writeTags(metadata, coverFileName, nil, path); result.Err == nil {
+		log.Infof("Retagged [%s] with %d change(s)", path, len(result.Changes))
+	}
+	return result
+}
+
+// identifyFile finds the content of a file from its tags, falling back to a
+// search for its title and artist. Search results are only taken if they
+// agree with the file, so that a wrong hit is not tagged over it.
+func (d *Downloader) identifyFile(path string, tags map[string]string) (string, IDType, string, error) {
+	if id, idType, err := taggedID(tags); err != nil || id != "" {
+		return id, idType, MatchTag, err
+	}
+	length := fileDuration(path, tags)
+	if isrc := tags["ISRC"]; isrc != "" {
+		tracks, err := d.searchTracks("isrc:" + isrc)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to search ISRC %s: %v", isrc, err)
+		}
+		// A file of unknown length needs its title and artist to agree.
+		for _, track := range tracks {
+			if strings.EqualFold(track.ExternalIDs.ISRC, isrc) &&
+				(length > 0 && sameLength(track, length) || length == 0 && namesTrack(path, tags, track)) {
+				return track.ID, TRACK, MatchISRC, nil
+			}
+		}
+	}
+
+	query := searchQuery(path, tags)
+	tracks, err := d.searchTracks(query)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to search %q: %v", query, err)
+	}
+	// The result with the longest title names the file most closely.
+	var match *trackData
+	for i, track := range tracks {
+		if namesTrack(path, tags, track) && (length == 0 || sameLength(track, length)) &&
+			(match == nil || len(simplifyName(track.Name)) > len(simplifyName(match.Name))) {
+			match = &tracks[i]
+		}
+	}
+	if match == nil {
+		return "", "", "", fmt.Errorf("unmatched, no search result for %q agrees with the file", query)
+	}
+	return match.ID, TRACK, MatchSearch, nil
+}
+
+// searchQuery is the title and artist tagged in a file, or else its file
+// name such as "01 - Title - Artist".
+func searchQuery(path string, tags map[string]string) string {
+	name := tags["TITLE"] + " " + tags["ARTIST"]
+	if tags["TITLE"] == "" || tags["ARTIST"] == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		name = leadingNumber.ReplaceAllString(name, "")
+	}
+	name = strings.NewReplacer(" - ", " ", "_", " ", multiValueSeparator, " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// namesTrack reports whether the title and artist of a file, or its file
+// name, contain the title and first artist of track.
+func namesTrack(path string, tags map[string]string, track trackData) bool {
+	if len(track.Artists) == 0 {
+		return false
+	}
+	title, artist := simplifyName(track.Name), simplifyName(track.Artists[0].Name)
+	if title == "" || artist == "" {
+		return false
+	}
+	if tags["TITLE"] != "" && tags["ARTIST"] != "" {
+		return strings.Contains(simplifyName(tags["TITLE"]), title) && strings.Contains(simplifyName(tags["ARTIST"]), artist)
+	}
+	name := simplifyName(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	return strings.Contains(name, title) && strings.Contains(name, artist)
+}
+
+// simplifyName lowercases s and drops everything but letters and digits, so
+// that names compare regardless of punctuation.
+func simplifyName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// sameLength reports whether a file of the given length can be track.
+func sameLength(track trackData, length time.Duration) bool {
+	diff := length - time.Duration(track.DurationMS)*time.Millisecond
+	return diff.Abs() <= retagLengthTolerance
+}
+
+// diffTags lists the keys of metadata whose values differ from the tags read
+// from a file.
+func diffTags(old, metadata map[string]string, keys []string) []TagChange {
+	var changes []TagChange
+	for _, key := range keys {
+		value := metadata[key]
+		if value == "" {
+			continue
+		}
+		if prev := old[strings.ToUpper(key)]; prev != value {
+			changes = append(changes, TagChange{Tag: key, Old: prev, New: value})
+		}
+	}
+	return changes
+}
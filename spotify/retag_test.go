@@ -0,0 +1,152 @@
+package spotify_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/bogem/id3v2"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+	"github.com/XiaoMengXinX/spotdl/spotify"
+)
+
+// writeMP3 writes an MP3 file holding an ID3 tag with the given frames.
+func writeMP3(t *testing.T, path string, frames map[string]string) {
+	t.Helper()
+	tag := id3v2.NewEmptyTag()
+	for id, value := range frames {
+		if id == "TXXX" {
+			tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{Encoding: id3v2.EncodingUTF8, Description: "SPOTIFY_URI", Value: value})
+		} else {
+			tag.AddTextFrame(id, id3v2.EncodingUTF8, value)
+		}
+	}
+	var file bytes.Buffer
+	if len(frames) > 0 {
+		if _, err := tag.WriteTo(&file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file.Write(bytes.Repeat([]byte{0xff}, 64))
+	if err := os.WriteFile(path, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetag(t *testing.T) {
+	srv, fixtures := newTestServer(t)
+	album := fixtures.AddAlbum("Old Library", 3)
+	tracks := []*spotifytest.Track{}
+	for _, id := range album.TrackIDs {
+		tracks = append(tracks, fixtures.Tracks[id])
+	}
+	d, out := newTestDownloader(t, srv)
+
+	dir := filepath.Join(out, "library")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	byID := filepath.Join(dir, "tagged.mp3")
+	writeMP3(t, byID, map[string]string{"TXXX": "spotify:track:" + tracks[0].ID, "TIT2": "Old Title"})
+	byISRC := filepath.Join(dir, "isrc.mp3")
+	writeMP3(t, byISRC, map[string]string{"TSRC": tracks[1].ISRC, "TLEN": strconv.Itoa(tracks[1].DurationMS + 1500)})
+	byName := filepath.Join(dir, "03 - "+tracks[2].Name+" - "+tracks[2].Artists[0].Name+".mp3")
+	writeMP3(t, byName, nil)
+	// Search results that disagree with a file are not taken: an ISRC hit
+	// of another length, a hit for the file name of another length and no
+	// hit at all.
+	unmatched := []string{
+		filepath.Join(dir, "other isrc.mp3"),
+		filepath.Join(dir, "02 - "+tracks[1].Name+" - "+tracks[1].Artists[0].Name+" (live).mp3"),
+		filepath.Join(dir, "unknown.mp3"),
+	}
+	writeMP3(t, unmatched[0], map[string]string{"TSRC": tracks[0].ISRC, "TLEN": "60000"})
+	writeMP3(t, unmatched[1], map[string]string{"TLEN": "420000"})
+	writeMP3(t, unmatched[2], nil)
+	if err := os.WriteFile(filepath.Join(dir, "cover.jpg"), []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := os.ReadFile(byID)
+	results, err := d.Retag(dir, true)
+	if err != nil {
+		t.Fatalf("Retag: %v", err)
+	}
+	if after, _ := os.ReadFile(byID); !bytes.Equal(before, after) {
+		t.Error("dry run changed a file")
+	}
+
+	want := map[string]struct {
+		id    string
+		match string
+	}{
+		byID:   {tracks[0].ID, spotify.MatchTag},
+		byISRC: {tracks[1].ID, spotify.MatchISRC},
+		byName: {tracks[2].ID, spotify.MatchSearch},
+	}
+	if len(results) != 6 {
+		t.Fatalf("got %d results, want 6", len(results))
+	}
+	for _, r := range results {
+		if slices.Contains(unmatched, r.Path) {
+			if r.Err == nil {
+				t.Errorf("%s matched %s, want no match", filepath.Base(r.Path), r.ID)
+			}
+			continue
+		}
+		w := want[r.Path]
+		if r.Err != nil || r.ID != w.id || r.Match != w.match {
+			t.Errorf("%s = %s by %s (%v), want %s by %s", filepath.Base(r.Path), r.ID, r.Match, r.Err, w.id, w.match)
+		}
+		if r.Path == byID {
+			var title *spotify.TagChange
+			for i, c := range r.Changes {
+				if c.Tag == "title" {
+					title = &r.Changes[i]
+				}
+			}
+			if title == nil || title.Old != "Old Title" || title.New != tracks[0].Name {
+				t.Errorf("title change = %+v, want Old Title -> %s", title, tracks[0].Name)
+			}
+		}
+	}
+
+	// MP3 files are tagged without ffmpeg; tagging twice keeps one of each
+	// frame.
+	for range 2 {
+		if _, err := d.Retag(dir, false); err != nil {
+			t.Fatalf("Retag: %v", err)
+		}
+	}
+	for path, w := range want {
+		id, idType, err := spotify.ParseInput(path)
+		if err != nil || id != w.id || idType != spotify.TRACK {
+			t.Errorf("ParseInput(%s) = %s, %s, %v, want track %s", filepath.Base(path), id, idType, err, w.id)
+		}
+		tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(tag.GetFrames("TXXX")); n != 5 {
+			t.Errorf("%s has %d TXXX frames, want UPC and the 4 Spotify IDs", filepath.Base(path), n)
+		}
+		if n := len(tag.GetFrames("APIC")); n != 1 {
+			t.Errorf("%s has %d covers, want 1", filepath.Base(path), n)
+		}
+		tag.Close()
+	}
+
+	results, err = d.Retag(dir, true)
+	if err != nil {
+		t.Fatalf("Retag: %v", err)
+	}
+	for _, r := range results {
+		if r.Err == nil && len(r.Changes) > 0 {
+			t.Errorf("%s still has changes after retagging: %+v", filepath.Base(r.Path), r.Changes)
+		}
+	}
+}
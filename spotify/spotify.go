@@ -3,10 +3,17 @@ package spotify
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/XiaoMengXinX/spotdl/bandwidth"
+	"github.com/XiaoMengXinX/spotdl/cache"
+	"github.com/XiaoMengXinX/spotdl/config"
+	"github.com/XiaoMengXinX/spotdl/httpclient"
 	log "github.com/XiaoMengXinX/spotdl/logger"
+	"github.com/XiaoMengXinX/spotdl/ratelimit"
 	"github.com/XiaoMengXinX/spotdl/token"
+	"iter"
 	"net/http"
 	"path/filepath"
+	"time"
 )
 
 const (
@@ -36,29 +43,79 @@ var (
 
 type Downloader struct {
 	TokenManager *token.Manager
+	TokenSource  token.TokenSource
+
+	endpoints    config.Endpoints
+	httpClient   *http.Client
+	customClient *http.Client
+	// requestLimiter spaces out API requests made by makeRequest.
+	requestLimiter *ratelimit.Limiter
+	rateLimit      int64
+	network        config.Network
+	download       config.Download
+	hooks          Hooks
+	cache          *cache.Cache
+	cacheTTL       map[string]time.Duration
+	prefetched     *metadataStore
+	outputFolder   string
+	output         config.Output
+	targets        []Target
+	template       string
+	chapterFile    string
+	feedBaseURL    string
+	quality        string
+	clientBases    *clientBasePool
 
-	outputFolder string
-	quality      string
-	clientBases  []string
-	licenseURL   string
-
-	isConvertToMP3       bool
 	isSkipAddingMetadata bool
+	replayGain           bool
+	creditsFile          bool
+	feed                 bool
+	isOfflineMetadata    bool
 }
 
-func NewDownloader() *Downloader {
+// NewDownloader creates a downloader. Endpoints passed in override the
+// default Spotify service URLs, e.g. to point at a local test server.
+func NewDownloader(endpoints ...config.Endpoints) *Downloader {
+	ep := config.ResolveEndpoints(endpoints...)
+	tm := token.NewTokenManager(ep)
 	return &Downloader{
-		TokenManager: token.NewTokenManager(),
-		quality:      Quality128MP4,
-		outputFolder: filepath.Clean("./output"),
+		TokenManager:   tm,
+		TokenSource:    tm,
+		endpoints:      ep,
+		httpClient:     httpclient.Default(),
+		cacheTTL:       make(map[string]time.Duration),
+		prefetched:     newMetadataStore(),
+		clientBases:    newClientBasePool(nil),
+		requestLimiter: ratelimit.New(ratelimit.Rate{}, nil),
+		quality:        Quality128MP4,
+		outputFolder:   filepath.Clean("./output"),
 	}
 }
 
 func (d *Downloader) Initialize() *Downloader {
 	d.TokenManager.ConfigManager.Initialize()
-	d.TokenManager.QuerySpDc()
-	d.clientBases = requestClientBases()
-	d.licenseURL = d.buildLicenseURL()
+	if err := d.TokenManager.ConfigManager.ReadConfig(); err != nil {
+		log.Errorf("Failed to read config: %v", err)
+	}
+	if err := d.initHTTPClient(); err != nil {
+		log.Fatalf("Failed to create http client: %v", err)
+	}
+	d.initCache()
+	d.initRequestLimiter()
+	if err := d.initOutput(); err != nil {
+		log.Fatalf("Invalid output config: %v", err)
+	}
+	// In offline metadata mode a token is only requested once a download
+	// needs one.
+	if d.TokenSource == token.TokenSource(d.TokenManager) && !d.isOfflineMetadata {
+		d.TokenManager.QuerySpDc()
+	}
+	bases := d.requestClientBases()
+	if len(bases) == 0 {
+		log.Warn("No client bases available, use built-in url")
+		bases = []string{d.endpoints.ClientBase}
+	}
+	d.clientBases = newClientBasePool(bases)
 	_ = readCDMs()
 	if err := checkDirExist(d.outputFolder); err != nil {
 		log.Fatalln(err)
@@ -66,6 +123,121 @@ func (d *Downloader) Initialize() *Downloader {
 	return d
 }
 
+// SetTokenSource replaces the sp_dc based token manager as the source of
+// access tokens for API requests.
+func (d *Downloader) SetTokenSource(ts token.TokenSource) *Downloader {
+	d.TokenSource = ts
+	return d
+}
+
+// initHTTPClient builds the shared HTTP client from the network settings in
+// the config file, overridden by SetNetwork, unless one was injected, and
+// applies the bandwidth limit to it.
+func (d *Downloader) initHTTPClient() error {
+	network := d.TokenManager.ConfigManager.Get().Network
+	if d.network.Proxy != "" {
+		network.Proxy = d.network.Proxy
+	}
+	if d.network.Timeout > 0 {
+		network.Timeout = d.network.Timeout
+	}
+	if d.network.ConnectTimeout > 0 {
+		network.ConnectTimeout = d.network.ConnectTimeout
+	}
+	if d.network.StallTimeout > 0 {
+		network.StallTimeout = d.network.StallTimeout
+	}
+	network.DisableHTTP2 = network.DisableHTTP2 || d.network.DisableHTTP2
+	d.network = network
+
+	client := d.customClient
+	if client == nil {
+		var err error
+		if client, err = httpclient.New(network); err != nil {
+			return err
+		}
+		if network.Proxy != "" {
+			log.Debugf("Using proxy: %s", network.Proxy)
+		}
+	}
+
+	schedule, err := bandwidth.NewSchedule(d.TokenManager.ConfigManager.Get().Bandwidth)
+	if err != nil {
+		return fmt.Errorf("invalid bandwidth config: %w", err)
+	}
+	if d.rateLimit > 0 {
+		schedule.Default = d.rateLimit
+	}
+	if !schedule.Unlimited() {
+		limited := *client
+		limited.Transport = bandwidth.Transport(client.Transport, bandwidth.NewLimiter(schedule))
+		client = &limited
+		log.Debugf("Limiting bandwidth: %+v", schedule)
+	}
+
+	d.httpClient = client
+	d.TokenManager.SetHTTPClient(client)
+	return nil
+}
+
+func (d *Downloader) initRequestLimiter() {
+	conf := d.TokenManager.ConfigManager.Get().RateLimit
+	rate := func(limit config.RateLimit) ratelimit.Rate {
+		if limit.Disabled || conf.Disabled {
+			return ratelimit.Rate{}
+		}
+		if limit.RequestsPerSecond == 0 {
+			limit.RequestsPerSecond = conf.RequestsPerSecond
+		}
+		if limit.Burst == 0 {
+			limit.Burst = conf.Burst
+		}
+		return ratelimit.Rate{PerSecond: limit.RequestsPerSecond, Burst: limit.Burst}
+	}
+	hosts := make(map[string]ratelimit.Rate, len(conf.Hosts))
+	for host, limit := range conf.Hosts {
+		hosts[host] = rate(limit)
+	}
+	d.requestLimiter = ratelimit.New(rate(conf), hosts)
+	log.Debugf("Request rate limit: %.2f req/s, burst %d, per host overrides: %+v", conf.RequestsPerSecond, conf.Burst, hosts)
+}
+
+// SetRateLimit caps the total download rate in bytes per second across all
+// requests, overriding the configured default limit. Scheduled windows still
+// apply.
+func (d *Downloader) SetRateLimit(bytesPerSecond int64) *Downloader {
+	d.rateLimit = bytesPerSecond
+	return d
+}
+
+// SetSegments overrides how many ranges of how many bytes are downloaded
+// concurrently for each audio file. Zero values keep the configured setting.
+func (d *Downloader) SetSegments(count int, size int64) *Downloader {
+	d.download = config.Download{Segments: count, SegmentSize: size}
+	return d
+}
+
+// SetHTTPClient sets the client used for every request made by the
+// downloader and its token manager.
+func (d *Downloader) SetHTTPClient(client *http.Client) *Downloader {
+	d.httpClient = client
+	d.customClient = client
+	d.TokenManager.SetHTTPClient(client)
+	return d
+}
+
+// SetNetwork overrides the network settings from the config file. Zero
+// fields keep the configured values.
+func (d *Downloader) SetNetwork(network config.Network) *Downloader {
+	d.network = network
+	return d
+}
+
+// Endpoints returns the Spotify service URLs used by the downloader.
+func (d *Downloader) Endpoints() config.Endpoints {
+	return d.endpoints
+}
+
 func (d *Downloader) SetQuality(quality string) error {
 	if mp4FormatSet[quality] != true && oggFormatSet[quality] != true {
 		return fmt.Errorf("%s is not a valid quality format", quality)
@@ -79,8 +251,13 @@ func (d *Downloader) SetOutputPath(outputPath string) *Downloader {
 	return nil
 }
 
+// ConvertToMP3 replaces the downloaded file with an mp3 copy. Use SetTargets
+// to keep both.
 func (d *Downloader) ConvertToMP3(b bool) *Downloader {
-	d.isConvertToMP3 = b
+	d.targets = nil
+	if b {
+		d.targets = []Target{{Format: "mp3"}}
+	}
 	return d
 }
 
@@ -89,76 +266,61 @@ func (d *Downloader) SkipAddingMetadata(b bool) *Downloader {
 	return d
 }
 
+// GetTracks returns the IDs of every track or episode behind url.
 func (d *Downloader) GetTracks(url string) ([]string, error) {
-	url, idType, err := GetIDType(url)
-	if err != nil {
-		log.Debugf("Get IDType failed: %v", err)
-		return nil, err
-	}
-	switch idType {
-	case ALBUM:
-		return d.fetchAlbumTracks(url, 0, []string{})
-	case PLAYLIST:
-		return d.fetchPlaylistTracks(url, 0, []string{})
-	case SHOW:
-		return d.fetchShowEpisodes(url, 0, []string{})
-	default:
-		return []string{url}, nil
-	}
-}
-
-func (d *Downloader) fetchAlbumTracks(albumID string, offset int, tracks []string) ([]string, error) {
-	albumData, err := d.queryAlbumTracksAPI(albumID, offset)
+	total, ids, err := d.Tracks(url)
 	if err != nil {
 		return nil, err
 	}
-
-	for _, item := range albumData.Items {
-		tracks = append(tracks, item.Id)
-	}
-
-	if len(albumData.Items) >= 50 {
-		return d.fetchAlbumTracks(albumID, offset+50, tracks)
-	}
-	return tracks, nil
-}
-
-func (d *Downloader) fetchPlaylistTracks(playlistID string, offset int, tracks []string) ([]string, error) {
-	playlistData, err := d.queryPlaylistTracksAPI(playlistID, offset)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, item := range playlistData.Items {
-		if item.Track.Id != "" {
-			tracks = append(tracks, item.Track.Id)
+	tracks := make([]string, 0, total)
+	for id, err := range ids {
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	if len(playlistData.Items) >= 100 {
-		return d.fetchPlaylistTracks(playlistID, offset+100, tracks)
+		tracks = append(tracks, id)
 	}
 	return tracks, nil
 }
 
-func (d *Downloader) fetchShowEpisodes(showID string, offset int, episodes []string) ([]string, error) {
-	showData, err := d.queryShowTracksAPI(showID, offset)
+// Tracks returns the number of tracks or episodes behind url and an iterator
+// over their IDs. Only the first page is fetched up front; the rest are
+// requested as the iterator advances. url is parsed with ParseInput.
+func (d *Downloader) Tracks(url string) (total int, ids iter.Seq2[string, error], err error) {
+	id, idType, err := ParseInput(url)
 	if err != nil {
-		return nil, err
+		log.Debugf("Get IDType failed: %v", err)
+		return 0, nil, err
 	}
+	return d.tracks(id, idType)
+}
 
-	for _, item := range showData.Items {
-		episodes = append(episodes, item.Id)
+func (d *Downloader) tracks(id string, idType IDType) (total int, ids iter.Seq2[string, error], err error) {
+	var onPage func([]string)
+	if hasFFmpeg && !d.isSkipAddingMetadata {
+		onPage = d.prefetchMetadata
 	}
 
-	if len(showData.Items) >= 50 {
-		return d.fetchShowEpisodes(showID, offset+50, episodes)
+	var url string
+	switch idType {
+	case ALBUM:
+		url = fmt.Sprintf("%s/v1/albums/%s/tracks?offset=0&limit=50", d.endpoints.WebAPI, id)
+		return paginateIDs(d, url, func(item albumTrackItem) string { return item.Id }, onPage)
+	case PLAYLIST:
+		url = fmt.Sprintf("%s/v1/playlists/%s/tracks?offset=0&limit=100", d.endpoints.WebAPI, id)
+		return paginateIDs(d, url, func(item playlistTrackItem) string { return item.Track.Id }, onPage)
+	case SHOW:
+		url = fmt.Sprintf("%s/v1/shows/%s/episodes?offset=0&limit=50", d.endpoints.WebAPI, id)
+		return paginateIDs(d, url, func(item showEpisodeItem) string { return item.Id }, nil)
+	case AUDIOBOOK:
+		url = fmt.Sprintf("%s/v1/audiobooks/%s/chapters?offset=0&limit=50", d.endpoints.WebAPI, id)
+		return paginateIDs(d, url, func(item audiobookChapterItem) string { return item.Id }, nil)
+	default:
+		return 1, func(yield func(string, error) bool) { yield(id, nil) }, nil
 	}
-	return episodes, nil
 }
 
 func (d *Downloader) getTrackCredits(trackID string) (credits trackCredits, err error) {
-	url := fmt.Sprintf("https://spclient.wg.spotify.com/track-credits-view/v0/experimental/%s/credits", trackID)
+	url := fmt.Sprintf("%s/track-credits-view/v0/experimental/%s/credits", d.endpoints.SpClient, trackID)
 	resp, err := d.makeRequest(http.MethodGet, url, nil)
 	if err != nil {
 		log.Debugf("Fetch track credits failed: %v", err)
@@ -173,17 +335,11 @@ func (d *Downloader) getTrackCredits(trackID string) (credits trackCredits, err
 }
 
 func (d *Downloader) getTrackMetadata(trackID string) (name string, artist string, fileID string, metadata trackMetadata, err error) {
-	url := fmt.Sprintf("https://spclient.wg.spotify.com/metadata/4/track/%s", SpIDToHex(trackID))
-	resp, err := d.makeRequest(http.MethodGet, url, nil)
+	metadata, err = d.queryTrackMetadata(trackID)
 	if err != nil {
-		log.Debugf("Fetch track metadata failed: %v", err)
 		return "", "", "", metadata, err
 	}
 
-	if err := json.Unmarshal(resp, &metadata); err != nil {
-		return "", "", "", metadata, fmt.Errorf("failed to decode track metadata: %w", err)
-	}
-
 	if len(metadata.Artists) != 0 {
 		artist = metadata.Artists[0].Name
 	}
@@ -203,11 +359,33 @@ func (d *Downloader) getTrackMetadata(trackID string) (name string, artist strin
 	return metadata.Name, artist, fileID, metadata, nil
 }
 
+// queryTrackMetadata fetches the metadata of a track without its media
+// manifest.
+func (d *Downloader) queryTrackMetadata(trackID string) (metadata trackMetadata, err error) {
+	url := fmt.Sprintf("%s/metadata/4/track/%s", d.endpoints.SpClient, SpIDToHex(trackID))
+	resp, err := d.makeRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Debugf("Fetch track metadata failed: %v", err)
+		return metadata, err
+	}
+
+	if err := json.Unmarshal(resp, &metadata); err != nil {
+		return metadata, fmt.Errorf("failed to decode track metadata: %w", err)
+	}
+	return metadata, nil
+}
+
 func (d *Downloader) getEpisodeMetadata(episodeID string) (name string, creator string, fileID string, metadata episodeMetadata, err error) {
-	url := "https://api-partner.spotify.com/pathfinder/v1/query"
+	return d.getEpisodeOrChapter(EPISODE, episodeID)
+}
+
+// getEpisodeOrChapter fetches a podcast episode or an audiobook chapter,
+// which share a pathfinder query. The creator of a chapter is its authors.
+func (d *Downloader) getEpisodeOrChapter(content IDType, ID string) (name string, creator string, fileID string, metadata episodeMetadata, err error) {
+	url := d.endpoints.Pathfinder
 	var paramsVar []byte
 	paramsVar, _ = json.Marshal(map[string]string{
-		"uri": fmt.Sprintf("spotify:episode:%s", episodeID),
+		"uri": fmt.Sprintf("spotify:%s:%s", content, ID),
 	})
 	var paramsExtensions []byte
 	paramsExtensions, _ = json.Marshal(map[string]interface{}{
@@ -223,12 +401,12 @@ func (d *Downloader) getEpisodeMetadata(episodeID string) (name string, creator
 	}
 	resp, err := d.makeRequest(http.MethodGet, url+"?"+buildQueryParams(params), nil)
 	if err != nil {
-		log.Debugf("Fetch episode metadata failed: %v", err)
+		log.Debugf("Fetch %s metadata failed: %v", content, err)
 		return "", "", "", metadata, err
 	}
 
 	if err := json.Unmarshal(resp, &metadata); err != nil {
-		return "", "", "", metadata, fmt.Errorf("failed to decode episode metadata: %w", err)
+		return "", "", "", metadata, fmt.Errorf("failed to decode %s metadata: %w", content, err)
 	}
 
 	episode := metadata.Data.Episode
@@ -237,6 +415,9 @@ func (d *Downloader) getEpisodeMetadata(episodeID string) (name string, creator
 		return "", "", "", metadata, err
 	}
 
+	if episode.Creator == "" && content == CHAPTER {
+		episode.Creator = joinNames(episode.Audiobook.Data.Authors)
+	}
 	if episode.Creator == "" {
 		episode.Creator = episode.Podcast.Data.Name
 	}
@@ -245,13 +426,16 @@ func (d *Downloader) getEpisodeMetadata(episodeID string) (name string, creator
 }
 
 func (d *Downloader) getMediaManifest(mediaType, mediaID string) (*mediaManifest, error) {
-	url := fmt.Sprintf("%s/track-playback/v1/media/spotify:%s:%s", d.randomClientBase(), mediaType, mediaID)
 	params := map[string]interface{}{
 		"manifestFileFormat": "file_ids_mp4",
 	}
 
-	fullURL := url + "?" + buildQueryParams(params)
-	respBody, err := d.makeRequest(http.MethodGet, fullURL, nil)
+	var respBody []byte
+	err := d.withClientBase(func(base string) (err error) {
+		url := fmt.Sprintf("%s/track-playback/v1/media/spotify:%s:%s", base, mediaType, mediaID)
+		respBody, err = d.makeRequest(http.MethodGet, url+"?"+buildQueryParams(params), nil)
+		return err
+	})
 	if err != nil {
 		log.Debugf("Fetch media manifest failed: %v", err)
 		return nil, err
@@ -265,24 +449,3 @@ func (d *Downloader) getMediaManifest(mediaType, mediaID string) (*mediaManifest
 
 	return &manifestResp, nil
 }
-
-func (d *Downloader) requestCDNURL(fileID string) (string, error) {
-	url := fmt.Sprintf("%s/storage-resolve/files/audio/interactive/%s", d.randomClientBase(), fileID)
-	params := buildQueryParams(map[string]interface{}{"alt": "json"})
-
-	respBody, err := d.makeRequest(http.MethodGet, url+"?"+params, nil)
-	if err != nil {
-		log.Debugf("Fetch CDN URL Failed: %v", err)
-		return "", err
-	}
-
-	var cdnResponse cdnURL
-	_ = json.Unmarshal(respBody, &cdnResponse)
-
-	if len(cdnResponse.CdnURL) == 0 {
-		return "", fmt.Errorf("no CDN URL found in response")
-	}
-	log.Debugf("Get CDN URL successfully: %v", cdnResponse.CdnURL)
-
-	return cdnResponse.CdnURL[0], nil
-}
@@ -0,0 +1,13 @@
+package spotify_test
+
+import (
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+	"github.com/XiaoMengXinX/spotdl/token"
+)
+
+func staticToken() token.TokenSource {
+	return token.StaticTokenSource(token.Token{
+		AccessToken: spotifytest.AccessToken,
+		ClientToken: spotifytest.ClientToken,
+	})
+}
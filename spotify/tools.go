@@ -5,13 +5,11 @@ import (
 	"fmt"
 	log "github.com/XiaoMengXinX/spotdl/logger"
 	"math/big"
-	"math/rand"
 	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
 )
 
 var spBase62Charset = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -123,34 +121,13 @@ func checkDirExist(dirPath string) error {
 	return nil
 }
 
-func formatArtistsStr(artists []artistData) string {
-	if len(artists) == 0 {
-		return ""
-	}
-
-	artistNames := make([]string, len(artists))
-	for i, ar := range artists {
-		artistNames[i] = ar.Name
+// joinNames joins the names of authors or narrators.
+func joinNames(names []nameData) string {
+	joined := make([]string, len(names))
+	for i, n := range names {
+		joined[i] = n.Name
 	}
-
-	return strings.Join(artistNames, ", ")
-}
-
-func formatComposersStr(credits trackCredits) string {
-	if len(credits.RoleCredits) == 0 {
-		return ""
-	}
-
-	artistNames := make([]string, 0)
-	for _, r := range credits.RoleCredits {
-		if r.RoleTitle == "Writers" {
-			for _, ar := range r.Artists {
-				artistNames = append(artistNames, ar.Name)
-			}
-		}
-	}
-
-	return strings.Join(artistNames, ", ")
+	return strings.Join(joined, ", ")
 }
 
 func cleanFilename(filename string) string {
@@ -205,21 +182,6 @@ func (e *fileEntry) testFileIDOrFileId() string {
 	return e.FileId
 }
 
-func (d *Downloader) randomClientBase() string {
-	if len(d.clientBases) == 0 {
-		log.Warn("No client bases available, use built-in url")
-		d.clientBases = []string{"gew4-spclient.spotify.com:443"}
-	}
-
-	rand.Seed(time.Now().UnixNano())
-	randomIndex := rand.Intn(len(d.clientBases))
-	return d.clientBases[randomIndex]
-}
-
-func (d *Downloader) buildLicenseURL() string {
-	return fmt.Sprintf("%s/widevine-license/v1/audio/license", d.randomClientBase())
-}
-
 func (d *Downloader) isSupportedFormat(format string) bool {
 	switch {
 	case mp4FormatSet[d.quality]:
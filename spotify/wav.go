@@ -0,0 +1,110 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/bogem/id3v2"
+	"os"
+	"slices"
+	"strings"
+)
+
+// wavID3Chunk is the RIFF chunk taggers keep an ID3 tag of a WAV file in.
+const wavID3Chunk = "id3 "
+
+// riffChunk is a chunk of a WAV file.
+type riffChunk struct {
+	id   string
+	data []byte
+}
+
+// addWavID3 writes the tags of a WAV file into an ID3 chunk, replacing the
+// one written before.
+func addWavID3(inputFile, coverFilePath string, metadata map[string]string, chapters []chapter) error {
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	chunks, err := readWavChunks(data)
+	if err != nil {
+		return fmt.Errorf("%v in %s", err, inputFile)
+	}
+
+	tag := id3v2.NewEmptyTag()
+	chunks = slices.DeleteFunc(chunks, func(c riffChunk) bool {
+		if !strings.EqualFold(c.id, wavID3Chunk) {
+			return false
+		}
+		if parsed, err := id3v2.ParseReader(bytes.NewReader(c.data), id3v2.Options{Parse: true}); err == nil {
+			tag = parsed
+		}
+		return true
+	})
+	if err := setID3Frames(tag, coverFilePath, metadata, chapters); err != nil {
+		return err
+	}
+	var id3 bytes.Buffer
+	if _, err := tag.WriteTo(&id3); err != nil {
+		return fmt.Errorf("failed to encode id3v2: %v", err)
+	}
+	chunks = append(chunks, riffChunk{id: wavID3Chunk, data: id3.Bytes()})
+
+	tempFile := inputFile + ".tmp.wav"
+	if err := os.WriteFile(tempFile, writeWavChunks(chunks), 0644); err != nil {
+		return err
+	}
+	return replaceFile(tempFile, inputFile)
+}
+
+// readWavID3 returns the ID3 tag of a WAV file.
+func readWavID3(path string) (*id3v2.Tag, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := readWavChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		if strings.EqualFold(c.id, wavID3Chunk) {
+			return id3v2.ParseReader(bytes.NewReader(c.data), id3v2.Options{Parse: true})
+		}
+	}
+	return nil, fmt.Errorf("no ID3 chunk")
+}
+
+// readWavChunks splits a WAV file into its chunks.
+func readWavChunks(data []byte) ([]riffChunk, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("no WAVE header")
+	}
+	var chunks []riffChunk
+	for pos := 12; pos+8 <= len(data); {
+		end := pos + 8 + int(binary.LittleEndian.Uint32(data[pos+4:pos+8]))
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated %q chunk", data[pos:pos+4])
+		}
+		chunks = append(chunks, riffChunk{id: string(data[pos : pos+4]), data: data[pos+8 : end]})
+		// Chunks are padded to an even size.
+		pos = end + (end-pos)%2
+	}
+	return chunks, nil
+}
+
+func writeWavChunks(chunks []riffChunk) []byte {
+	var out bytes.Buffer
+	out.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range chunks {
+		out.WriteString(c.id)
+		_ = binary.Write(&out, binary.LittleEndian, uint32(len(c.data)))
+		out.Write(c.data)
+		if len(c.data)%2 == 1 {
+			out.WriteByte(0)
+		}
+	}
+	data := out.Bytes()
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)-8))
+	return data
+}
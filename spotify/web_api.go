@@ -5,6 +5,8 @@ import (
 	"fmt"
 	log "github.com/XiaoMengXinX/spotdl/logger"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 func (d *Downloader) WebAPIGetTrackInfo(trackID string) (WebAPITrackInfo, error) {
@@ -48,77 +50,104 @@ func (d *Downloader) WebAPIGetTrackInfo(trackID string) (WebAPITrackInfo, error)
 	return trackInfo, nil
 }
 
-func (d *Downloader) queryAlbumTracksAPI(albumID string, offset int) (albumTracksData, error) {
-	url := fmt.Sprintf("https://api.spotify.com/v1/albums/%s/tracks?offset=%d&limit=50", albumID, offset)
+func (d *Downloader) queryAlbumAPI(albumID string) (albumData, error) {
+	url := fmt.Sprintf("%s/v1/albums/%s", d.endpoints.WebAPI, albumID)
 	data, err := d.makeRequest(http.MethodGet, url, nil)
 	if err != nil {
-		log.Debugf("Fetch album tracks failed: %v", err)
-		return albumTracksData{}, err
+		log.Debugf("Fetch album failed: %v", err)
+		return albumData{}, err
 	}
 
-	var albumTracks albumTracksData
-	if err := json.Unmarshal(data, &albumTracks); err != nil {
-		return albumTracks, fmt.Errorf("failed to decode album data: %w", err)
+	var album albumData
+	if err := json.Unmarshal(data, &album); err != nil {
+		return albumData{}, fmt.Errorf("failed to decode album data: %w", err)
+	}
+	return album, nil
+}
+
+// albumDiscCount returns the number of discs of album, the disc number of its
+// last track. Only albums longer than the first page of their listing need
+// a request.
+func (d *Downloader) albumDiscCount(album albumData) (int, error) {
+	items := album.Tracks.Items
+	if len(items) < album.TotalTracks {
+		url := fmt.Sprintf("%s/v1/albums/%s/tracks?offset=%d&limit=1", d.endpoints.WebAPI, album.ID, album.TotalTracks-1)
+		page, err := fetchPage[albumTrackItem](d, url)
+		if err != nil {
+			return 0, err
+		}
+		items = page.Items
+	}
+	discs := 0
+	for _, item := range items {
+		discs = max(discs, item.DiscNumber)
 	}
-	return albumTracks, nil
+	return discs, nil
 }
 
-func (d *Downloader) queryPlaylistTracksAPI(playlistID string, offset int) (playlistTracksData, error) {
-	url := fmt.Sprintf("https://api.spotify.com/v1/playlists/%s/tracks?offset=%d&limit=100", playlistID, offset)
+func (d *Downloader) queryTrackAPI(trackID string) (trackData, error) {
+	url := fmt.Sprintf("%s/v1/tracks/%s", d.endpoints.WebAPI, trackID)
 	data, err := d.makeRequest(http.MethodGet, url, nil)
 	if err != nil {
-		log.Debugf("Fetch playlist tracks failed: %v", err)
-		return playlistTracksData{}, err
+		log.Debugf("Fetch track failed: %v", err)
+		return trackData{}, err
 	}
 
-	var playlistTracks playlistTracksData
-	if err := json.Unmarshal(data, &playlistTracks); err != nil {
-		return playlistTracks, fmt.Errorf("failed to decode playlist data: %w", err)
+	var track trackData
+	if err := json.Unmarshal(data, &track); err != nil {
+		return trackData{}, fmt.Errorf("failed to decode track data: %w", err)
 	}
-	return playlistTracks, nil
+	return track, nil
 }
 
-func (d *Downloader) queryShowTracksAPI(showID string, offset int) (showTracksData, error) {
-	url := fmt.Sprintf("https://api.spotify.com/v1/shows/%s/episodes?offset=%d&limit=50", showID, offset)
-	data, err := d.makeRequest(http.MethodGet, url, nil)
+// searchLimit is the number of results asked for by searchTracks.
+const searchLimit = 10
+
+// searchTracks returns the best matches for a track search query. Queries can
+// use field filters such as isrc:.
+func (d *Downloader) searchTracks(query string) ([]trackData, error) {
+	searchURL := fmt.Sprintf("%s/v1/search?q=%s&type=track&limit=%d", d.endpoints.WebAPI, url.QueryEscape(query), searchLimit)
+	data, err := d.makeRequest(http.MethodGet, searchURL, nil)
 	if err != nil {
-		log.Debugf("Fetch show episodes failed: %v", err)
-		return showTracksData{}, err
+		log.Debugf("Search tracks failed: %v", err)
+		return nil, err
 	}
 
-	var showTracks showTracksData
-	if err := json.Unmarshal(data, &showTracks); err != nil {
-		return showTracks, fmt.Errorf("failed to decode show data: %w", err)
+	var result struct {
+		Tracks pagingData[trackData] `json:"tracks"`
 	}
-	return showTracks, nil
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+	return result.Tracks.Items, nil
 }
 
-func (d *Downloader) queryAlbumAPI(albumID string) (albumData, error) {
-	url := fmt.Sprintf("https://api.spotify.com/v1/albums/%s", albumID)
+func (d *Downloader) queryTracksAPI(trackIDs []string) ([]*trackData, error) {
+	url := fmt.Sprintf("%s/v1/tracks?ids=%s", d.endpoints.WebAPI, strings.Join(trackIDs, ","))
 	data, err := d.makeRequest(http.MethodGet, url, nil)
 	if err != nil {
-		log.Debugf("Fetch album failed: %v", err)
-		return albumData{}, err
+		log.Debugf("Fetch tracks failed: %v", err)
+		return nil, err
 	}
 
-	var album albumData
-	if err := json.Unmarshal(data, &album); err != nil {
-		return albumData{}, fmt.Errorf("failed to decode album data: %w", err)
+	var tracks tracksData
+	if err := json.Unmarshal(data, &tracks); err != nil {
+		return nil, fmt.Errorf("failed to decode tracks data: %w", err)
 	}
-	return album, nil
+	return tracks.Tracks, nil
 }
 
-func (d *Downloader) queryTrackAPI(trackID string) (trackData, error) {
-	url := fmt.Sprintf("https://api.spotify.com/v1/tracks/%s", trackID)
+func (d *Downloader) queryAlbumsAPI(albumIDs []string) ([]*albumData, error) {
+	url := fmt.Sprintf("%s/v1/albums?ids=%s", d.endpoints.WebAPI, strings.Join(albumIDs, ","))
 	data, err := d.makeRequest(http.MethodGet, url, nil)
 	if err != nil {
-		log.Debugf("Fetch track failed: %v", err)
-		return trackData{}, err
+		log.Debugf("Fetch albums failed: %v", err)
+		return nil, err
 	}
 
-	var track trackData
-	if err := json.Unmarshal(data, &track); err != nil {
-		return trackData{}, fmt.Errorf("failed to decode track data: %w", err)
+	var albums albumsData
+	if err := json.Unmarshal(data, &albums); err != nil {
+		return nil, fmt.Errorf("failed to decode albums data: %w", err)
 	}
-	return track, nil
+	return albums.Albums, nil
 }
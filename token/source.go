@@ -0,0 +1,111 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Token is a bearer token for the Spotify APIs together with the client token
+// that accompanies it.
+type Token struct {
+	AccessToken string
+	ClientToken string
+	Expiry      time.Time
+}
+
+// Valid reports whether the token is set and not yet expired. A zero Expiry
+// means the token never expires.
+func (t Token) Valid() bool {
+	return t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Before(t.Expiry))
+}
+
+// TokenSource supplies access tokens, in the spirit of oauth2.TokenSource.
+// Implementations must be safe for concurrent use.
+type TokenSource interface {
+	Token() (Token, error)
+}
+
+// Token implements TokenSource using the sp_dc cookie flow. The access and
+// client tokens returned always come from the same refresh.
+func (tm *Manager) Token() (Token, error) {
+	token := tm.currentToken()
+	if token.AccessToken == "" {
+		return Token{}, fmt.Errorf("invalid access token")
+	}
+	return token, nil
+}
+
+type staticTokenSource struct {
+	token Token
+}
+
+// StaticTokenSource returns a TokenSource that always returns the same token.
+func StaticTokenSource(t Token) TokenSource {
+	return staticTokenSource{token: t}
+}
+
+func (s staticTokenSource) Token() (Token, error) {
+	if !s.token.Valid() {
+		return Token{}, fmt.Errorf("static access token is empty or expired")
+	}
+	return s.token, nil
+}
+
+// tokenFile is the on-disk format read by FileTokenSource. The field names
+// match the ones used in the config file.
+type tokenFile struct {
+	AccessToken       string `json:"accessToken"`
+	ClientToken       string `json:"clientToken"`
+	AccessTokenExpire int64  `json:"accessTokenExpire"`
+}
+
+type fileTokenSource struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	token   Token
+}
+
+// FileTokenSource returns a TokenSource backed by a JSON file with the
+// accessToken, clientToken and accessTokenExpire (milliseconds) fields. The
+// file is re-read whenever it changes, so an external broker can rotate it.
+func FileTokenSource(path string) TokenSource {
+	return &fileTokenSource{path: path}
+}
+
+func (s *fileTokenSource) Token() (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to stat token file: %w", err)
+	}
+	if !info.ModTime().Equal(s.modTime) {
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return Token{}, fmt.Errorf("failed to read token file: %w", err)
+		}
+		var tf tokenFile
+		if err := json.Unmarshal(data, &tf); err != nil {
+			return Token{}, fmt.Errorf("failed to parse token file: %w", err)
+		}
+		s.token = Token{
+			AccessToken: tf.AccessToken,
+			ClientToken: tf.ClientToken,
+		}
+		if tf.AccessTokenExpire > 0 {
+			s.token.Expiry = time.UnixMilli(tf.AccessTokenExpire)
+		}
+		s.modTime = info.ModTime()
+	}
+
+	if !s.token.Valid() {
+		return Token{}, fmt.Errorf("access token in %s is empty or expired", s.path)
+	}
+	return s.token, nil
+}
@@ -7,9 +7,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/XiaoMengXinX/spotdl/config"
+	"github.com/XiaoMengXinX/spotdl/httpclient"
 	"github.com/XiaoMengXinX/spotdl/injector"
 	log "github.com/XiaoMengXinX/spotdl/logger"
 	"github.com/pquerna/otp/totp"
@@ -30,16 +32,42 @@ var defaultHeaders = http.Header{
 	"spotify-app-version": []string{ClientVersion},
 }
 
+// defaultRefreshWindow is how long before expiry a cached access token is
+// considered stale and proactively refreshed.
+const defaultRefreshWindow = 5 * time.Minute
+
+// Manager issues Spotify access tokens from the sp_dc cookie. It is safe for
+// concurrent use: tokens are cached in memory, refreshed by at most one caller
+// at a time, and written to the config file only when they change. The token
+// state is read and replaced through methods such as SpDc, SetSpDc,
+// GetAccessToken, ClientToken and ClientID rather than fields. The config
+// file is read on the first token request unless GetConfig or QuerySpDc ran
+// before.
 type Manager struct {
-	SessionTokenURL   string
-	ClientTokenURL    string
-	ServerTimeURL     string
-	SpDc              string
-	AccessToken       string
-	ClientToken       string
-	ClientId          string
-	AccessTokenExpire int64
-	ConfigManager     *config.Manager
+	SessionTokenURL string
+	ClientTokenURL  string
+	ServerTimeURL   string
+	RefreshWindow   time.Duration
+	ConfigManager   *config.Manager
+
+	httpClient *http.Client
+
+	mu                sync.RWMutex
+	loaded            bool
+	spDc              string
+	accessToken       string
+	clientToken       string
+	clientId          string
+	accessTokenExpire int64
+
+	refreshMu sync.Mutex
+	refresh   *refreshCall
+}
+
+// refreshCall is an in-flight token refresh shared by all concurrent callers.
+type refreshCall struct {
+	done  chan struct{}
+	token Token
 }
 
 type accessTokenData struct {
@@ -69,41 +97,75 @@ type clientTokenRequest struct {
 	} `json:"client_data"`
 }
 
-func NewTokenManager() *Manager {
+// NewTokenManager creates a token manager. Endpoints passed in override the
+// default token, server time and client token URLs.
+func NewTokenManager(endpoints ...config.Endpoints) *Manager {
 	log.Debugln("New Token Manager Created")
+	ep := config.ResolveEndpoints(endpoints...)
 	return &Manager{
-		SessionTokenURL: "https://open.spotify.com/api/token",
-		ServerTimeURL:   "https://open.spotify.com/api/server-time",
-		ClientTokenURL:  "https://clienttoken.spotify.com/v1/clienttoken",
+		SessionTokenURL: ep.SessionToken,
+		ServerTimeURL:   ep.ServerTime,
+		ClientTokenURL:  ep.ClientToken,
+		RefreshWindow:   defaultRefreshWindow,
 		ConfigManager:   config.NewConfigManager(),
+		httpClient:      httpclient.Default(),
 	}
 }
 
+// SetHTTPClient sets the client used for all token requests.
+func (tm *Manager) SetHTTPClient(client *http.Client) *Manager {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.httpClient = client
+	return tm
+}
+
+func (tm *Manager) client() *http.Client {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.httpClient
+}
+
 func (tm *Manager) GetConfig() (conf config.Data, err error) {
 	conf, err = tm.ConfigManager.ReadAndGet()
 	if err != nil {
 		return
 	}
-	tm.ClientToken = conf.ClientToken
-	tm.ClientId = conf.ClientID
-	tm.SpDc = conf.SpDc
-	tm.AccessToken = conf.AccessToken
-	tm.AccessTokenExpire = conf.AccessTokenExpire
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.loaded = true
+	tm.clientToken = conf.ClientToken
+	tm.clientId = conf.ClientID
+	tm.spDc = conf.SpDc
+	tm.accessToken = conf.AccessToken
+	tm.accessTokenExpire = conf.AccessTokenExpire
 	return
 }
 
-func (tm *Manager) NewRequest(method, url string, body io.Reader) (*http.Request, error) {
+// NewRequest creates a request carrying the default web player headers.
+func NewRequest(method, url string, body io.Reader) (*http.Request, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header = defaultHeaders.Clone()
+	return req, nil
+}
+
+func (tm *Manager) NewRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
 	currentTime := time.Now().UnixNano() / 1e6
-	if tm.ClientToken != "" && currentTime < tm.AccessTokenExpire {
-		req.Header.Set("client-token", tm.ClientToken)
+	if tm.clientToken != "" && currentTime < tm.accessTokenExpire {
+		req.Header.Set("client-token", tm.clientToken)
 	}
-	if tm.SpDc != "" {
-		req.Header.Set("Cookie", fmt.Sprintf("sp_dc=%s", tm.SpDc))
+	if tm.spDc != "" {
+		req.Header.Set("Cookie", fmt.Sprintf("sp_dc=%s", tm.spDc))
 	}
 	return req, nil
 }
@@ -115,25 +177,66 @@ func (tm *Manager) QuerySpDc() {
 		log.Errorf("Failed to read config: %v", err)
 	}
 	if conf.SpDc == "" {
-		if tm.SpDc == "" {
+		spDc := tm.SpDc()
+		if spDc == "" {
 			log.Warnln("sp_dc cookie not found, prompting user input")
 			fmt.Print("sp_dc: ")
-			_, _ = fmt.Scanln(&tm.SpDc)
-			conf.SpDc = tm.SpDc
+			_, _ = fmt.Scanln(&spDc)
 		}
-		conf.SpDc = tm.SpDc
+		tm.mu.Lock()
+		tm.spDc = spDc
+		tm.mu.Unlock()
+		conf.SpDc = spDc
 		tm.ConfigManager.Set(conf)
 		log.Debugln("sp_dc cookie saved to config")
 	} else {
 		log.Debugln("sp_dc cookie found in config")
-		tm.SpDc = conf.SpDc
 	}
-	tm.AccessToken, tm.AccessTokenExpire = tm.GetAccessToken()
+	tm.GetAccessToken()
+}
+
+// SpDc returns the sp_dc cookie tokens are issued for.
+func (tm *Manager) SpDc() string {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.spDc
+}
+
+// SetSpDc replaces the sp_dc cookie and saves it to the config file. The
+// cached access token belonged to the old cookie and is dropped.
+func (tm *Manager) SetSpDc(spDc string) *Manager {
+	tm.mu.Lock()
+	tm.spDc = spDc
+	tm.accessToken = ""
+	tm.accessTokenExpire = 0
+	tm.mu.Unlock()
+
+	conf := tm.ConfigManager.Get()
+	conf.SpDc = spDc
+	conf.AccessToken = ""
+	conf.AccessTokenExpire = 0
+	tm.ConfigManager.Set(conf)
+	return tm
+}
+
+// ClientToken returns the cached client token.
+func (tm *Manager) ClientToken() string {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.clientToken
+}
+
+// ClientID returns the client ID the cached access token was issued to.
+func (tm *Manager) ClientID() string {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.clientId
 }
 
-func (tm *Manager) requestAccessToken() (string, int64, error) {
+// requestAccessToken fetches a fresh access token and its client token. It
+// does not touch the cached state; see refreshAccessToken.
+func (tm *Manager) requestAccessToken() (tokenResp accessTokenData, clientToken string, err error) {
 	log.Debugln("Requesting access token from Spotify")
-	client := &http.Client{}
 
 	serverTime, err := tm.getServerTime()
 	if err != nil {
@@ -142,7 +245,7 @@ func (tm *Manager) requestAccessToken() (string, int64, error) {
 	totpServer, err := tm.getTotp(serverTime)
 	totpStr, err := tm.getTotp(time.Now())
 	if err != nil {
-		return "", -1, fmt.Errorf("failed to get totp: %w", err)
+		return tokenResp, "", fmt.Errorf("failed to get totp: %w", err)
 	}
 
 	reqUrl := tm.SessionTokenURL + "?" + url.Values{
@@ -155,15 +258,15 @@ func (tm *Manager) requestAccessToken() (string, int64, error) {
 
 	req, err := tm.NewRequest("GET", reqUrl, nil)
 	if err != nil {
-		return "", -1, fmt.Errorf("failed to create request: %w", err)
+		return tokenResp, "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	log.Debugf("Requesting new access token with sp_dc: %s", tm.SpDc)
+	log.Debugf("Requesting new access token with sp_dc: %s", tm.SpDc())
 	log.Debugf("[GET] %s", reqUrl)
 
-	resp, err := client.Do(req)
+	resp, err := tm.client().Do(req)
 	if err != nil {
-		return "", -1, fmt.Errorf("failed to send request: %w", err)
+		return tokenResp, "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -172,49 +275,35 @@ func (tm *Manager) requestAccessToken() (string, int64, error) {
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		log.Debugf("Failed to request token (status %d): %s", resp.StatusCode, string(body))
-		return "", -1, fmt.Errorf("failed to make request: HTTP status code %d", resp.StatusCode)
+		return tokenResp, "", fmt.Errorf("failed to make request: HTTP status code %d", resp.StatusCode)
 	}
 
-	var tokenResp accessTokenData
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", -1, fmt.Errorf("failed to parse token response: %v", err)
+		return tokenResp, "", fmt.Errorf("failed to parse token response: %v", err)
 	}
 
 	log.Debugf("Token response: %+v", tokenResp)
 
 	if tokenResp.IsAnonymous {
-		tm.ConfigManager.Set(config.Data{
-			DefaultQuality:    tm.ConfigManager.Get().DefaultQuality,
-			SpDc:              "",
-			AccessToken:       "",
-			AccessTokenExpire: 0,
-			AcceptLanguage:    tm.ConfigManager.Get().AcceptLanguage,
-		})
+		// Only the rejected cookie and its token are cleared; the rest of
+		// the config file is kept.
+		tm.SetSpDc("")
 		log.Fatal("Invalid sp_dc cookie")
 	}
 
-	conf, _ := tm.GetConfig()
-	tm.ClientId = tokenResp.ClientId
-	tm.ClientToken, err = tm.requestClientToken(tokenResp.ClientId)
+	clientToken, err = tm.requestClientToken(tokenResp.ClientId)
 	if err != nil {
 		log.Errorf("Failed to request client token: %v", err)
-		return "", -1, fmt.Errorf("failed to get client token: %v", err)
+		return tokenResp, "", fmt.Errorf("failed to get client token: %v", err)
 	}
 	log.Debugln("New client token obtained")
 
-	conf.AccessToken = tokenResp.AccessToken
-	conf.AccessTokenExpire = tokenResp.ExpireTime
-	conf.ClientID = tokenResp.ClientId
-	conf.ClientToken = tm.ClientToken
-	tm.ConfigManager.Set(conf)
-
-	log.Debugln("Access token successfully retrieved and saved to config")
-	return tokenResp.AccessToken, tokenResp.ExpireTime, nil
+	log.Debugln("Access token successfully retrieved")
+	return tokenResp, clientToken, nil
 }
 
 func (tm *Manager) requestClientToken(clientId string) (string, error) {
 	log.Debugln("Requesting client token from Spotify")
-	client := &http.Client{}
 
 	reqBody := clientTokenRequest{}
 	reqBody.ClientData.ClientVersion = ClientVersion
@@ -229,7 +318,7 @@ func (tm *Manager) requestClientToken(clientId string) (string, error) {
 
 	log.Debugf("[POST] %s", tm.ClientTokenURL)
 
-	resp, err := client.Do(req)
+	resp, err := tm.client().Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
@@ -255,59 +344,159 @@ func (tm *Manager) requestClientToken(clientId string) (string, error) {
 	return tokenResp.GrantedToken.Token, nil
 }
 
+// GetAccessToken returns a valid access token and its expiration time in
+// milliseconds, refreshing it when it is about to expire.
 func (tm *Manager) GetAccessToken() (string, int64) {
-	log.Debugln("Checking access token")
+	token := tm.currentToken()
+	return token.AccessToken, token.Expiry.UnixMilli()
+}
 
-	conf, err := tm.GetConfig()
-	if err != nil {
-		log.Fatalf("Failed to read config: %v", err)
+// currentToken returns the access token with the client token issued along
+// with it, refreshing them when they are about to expire.
+func (tm *Manager) currentToken() Token {
+	tm.mu.RLock()
+	loaded := tm.loaded
+	tm.mu.RUnlock()
+	if !loaded {
+		if _, err := tm.GetConfig(); err != nil {
+			log.Errorf("Failed to read config: %v", err)
+		}
+	}
+
+	if token, ok := tm.cachedAccessToken(); ok {
+		log.Debugln("Using cached access token")
+		return token
 	}
+	return tm.refreshAccessToken()
+}
+
+// cachedAccessToken returns the in-memory token and whether it is still
+// outside the refresh window.
+func (tm *Manager) cachedAccessToken() (Token, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
 
 	currentTime := time.Now().UnixNano() / 1e6
-	log.Debugf("Current time (ms): %d, Token expiration time: %d", currentTime, conf.AccessTokenExpire)
-
-	if currentTime >= conf.AccessTokenExpire {
-		log.Warnln("Access token expired, requesting new token")
-
-		var err error
-		maxRetries := 3
-		for i := 0; i <= maxRetries; i++ {
-			tm.AccessToken, tm.AccessTokenExpire, err = tm.requestAccessToken()
-			if err == nil {
-				log.Debugln("New access token obtained")
-				return tm.AccessToken, tm.AccessTokenExpire
+	log.Debugf("Current time (ms): %d, Token expiration time: %d", currentTime, tm.accessTokenExpire)
+
+	token := tm.snapshot()
+	if tm.accessToken == "" || currentTime+tm.RefreshWindow.Milliseconds() >= tm.accessTokenExpire {
+		return token, false
+	}
+	return token, true
+}
+
+// snapshot returns the cached tokens. The caller must hold mu.
+func (tm *Manager) snapshot() Token {
+	return Token{
+		AccessToken: tm.accessToken,
+		ClientToken: tm.clientToken,
+		Expiry:      time.UnixMilli(tm.accessTokenExpire),
+	}
+}
+
+// refreshAccessToken refreshes the access token. Concurrent callers share a
+// single in-flight refresh and all receive its result.
+func (tm *Manager) refreshAccessToken() Token {
+	tm.refreshMu.Lock()
+	if call := tm.refresh; call != nil {
+		tm.refreshMu.Unlock()
+		<-call.done
+		return call.token
+	}
+	if token, ok := tm.cachedAccessToken(); ok {
+		tm.refreshMu.Unlock()
+		return token
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	tm.refresh = call
+	tm.refreshMu.Unlock()
+
+	call.token = tm.doRefresh()
+
+	tm.refreshMu.Lock()
+	tm.refresh = nil
+	tm.refreshMu.Unlock()
+	close(call.done)
+
+	return call.token
+}
+
+func (tm *Manager) doRefresh() Token {
+	log.Warnln("Access token expired or about to expire, requesting new token")
+
+	var err error
+	maxRetries := 3
+	for i := 0; i <= maxRetries; i++ {
+		var tokenResp accessTokenData
+		var clientToken string
+		tokenResp, clientToken, err = tm.requestAccessToken()
+		if err == nil {
+			log.Debugln("New access token obtained")
+			tm.storeAccessToken(tokenResp, clientToken)
+			return Token{
+				AccessToken: tokenResp.AccessToken,
+				ClientToken: clientToken,
+				Expiry:      time.UnixMilli(tokenResp.ExpireTime),
 			}
-			if i < maxRetries {
-				log.Warnf("Failed to request new access token, trying to refresh TOTP secret (attempt %d/%d)", i+1, maxRetries)
-				newTotp, err := injector.QuickIntercept()
-				if err != nil {
-					log.Errorf("Error while refreshing TOTP secret: %v", err)
-				} else {
-					for _, s := range newTotp {
-						if s.Version > tm.ConfigManager.Get().TOTP.Version {
-							c := tm.ConfigManager.Get()
-							c.TOTP.Version = s.Version
-							c.TOTP.Secret = s.Secret
-							tm.ConfigManager.Set(c)
-						}
+		}
+		if i < maxRetries {
+			log.Warnf("Failed to request new access token, trying to refresh TOTP secret (attempt %d/%d)", i+1, maxRetries)
+			newTotp, err := injector.QuickIntercept()
+			if err != nil {
+				log.Errorf("Error while refreshing TOTP secret: %v", err)
+			} else {
+				for _, s := range newTotp {
+					if s.Version > tm.ConfigManager.Get().TOTP.Version {
+						c := tm.ConfigManager.Get()
+						c.TOTP.Version = s.Version
+						c.TOTP.Secret = s.Secret
+						tm.ConfigManager.Set(c)
 					}
-					log.Infof("TOTP secret refreshed to version %d", tm.ConfigManager.Get().TOTP.Version)
-					log.Debugf("TOTP secret: %s", tm.ConfigManager.Get().TOTP.Secret)
 				}
-			} else {
-				log.Errorf("Error while requesting new access token after %d attempts: %v", maxRetries, err)
+				log.Infof("TOTP secret refreshed to version %d", tm.ConfigManager.Get().TOTP.Version)
+				log.Debugf("TOTP secret: %s", tm.ConfigManager.Get().TOTP.Secret)
 			}
+		} else {
+			log.Errorf("Error while requesting new access token after %d attempts: %v", maxRetries, err)
 		}
-		return "", 0
 	}
 
-	log.Debugln("Using cached access token")
-	return conf.AccessToken, conf.AccessTokenExpire
+	// Keep serving the old token if the refresh failed inside the window.
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if time.Now().UnixNano()/1e6 < tm.accessTokenExpire {
+		return tm.snapshot()
+	}
+	return Token{Expiry: time.UnixMilli(0)}
 }
 
-func (tm *Manager) getServerTime() (time.Time, error) {
-	client := &http.Client{}
+// storeAccessToken caches a new token in memory and persists it to the config
+// file if it differs from what is already stored there.
+func (tm *Manager) storeAccessToken(tokenResp accessTokenData, clientToken string) {
+	tm.mu.Lock()
+	tm.accessToken = tokenResp.AccessToken
+	tm.accessTokenExpire = tokenResp.ExpireTime
+	tm.clientId = tokenResp.ClientId
+	tm.clientToken = clientToken
+	tm.mu.Unlock()
+
+	conf := tm.ConfigManager.Get()
+	if conf.AccessToken == tokenResp.AccessToken &&
+		conf.AccessTokenExpire == tokenResp.ExpireTime &&
+		conf.ClientID == tokenResp.ClientId &&
+		conf.ClientToken == clientToken {
+		return
+	}
+	conf.AccessToken = tokenResp.AccessToken
+	conf.AccessTokenExpire = tokenResp.ExpireTime
+	conf.ClientID = tokenResp.ClientId
+	conf.ClientToken = clientToken
+	tm.ConfigManager.Set(conf)
+	log.Debugln("Access token saved to config")
+}
 
+func (tm *Manager) getServerTime() (time.Time, error) {
 	req, _ := http.NewRequest("GET", tm.ServerTimeURL, nil)
 	req.Header = http.Header{
 		"referer":             {"https://open.spotify.com/"},
@@ -317,7 +506,7 @@ func (tm *Manager) getServerTime() (time.Time, error) {
 		"spotify-app-version": {"1.2.61.20.g3b4cd5b2"},
 		"user-agent":          {UserAgent},
 	}
-	resp, err := client.Do(req)
+	resp, err := tm.client().Do(req)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -0,0 +1,186 @@
+package token_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/XiaoMengXinX/spotdl/internal/spotifytest"
+	"github.com/XiaoMengXinX/spotdl/token"
+)
+
+func newTestManager(t *testing.T) (*token.Manager, *spotifytest.Server, string) {
+	t.Helper()
+	srv := spotifytest.NewServer(spotifytest.NewFixtures())
+	t.Cleanup(srv.Close)
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	conf, _ := json.Marshal(map[string]any{
+		"sp_dc": "spotifytest",
+		"totp":  map[string]any{"secret": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "version": 1},
+	})
+	if err := os.WriteFile(configPath, conf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := token.NewTokenManager(srv.Endpoints())
+	tm.ConfigManager.SetConfigPath(configPath)
+	if _, err := tm.GetConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return tm, srv, configPath
+}
+
+func TestManagerSingleFlightRefresh(t *testing.T) {
+	tm, srv, _ := newTestManager(t)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 32)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = tm.GetAccessToken()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, tok := range tokens {
+		if tok != spotifytest.AccessToken {
+			t.Fatalf("caller %d got token %q", i, tok)
+		}
+	}
+	if n := srv.Hits("token"); n != 1 {
+		t.Errorf("token endpoint hit %d times, want 1", n)
+	}
+	if n := srv.Hits("clienttoken"); n != 1 {
+		t.Errorf("client token endpoint hit %d times, want 1", n)
+	}
+}
+
+func TestManagerPersistsOnlyOnChange(t *testing.T) {
+	tm, srv, configPath := newTestManager(t)
+
+	if tok, _ := tm.GetAccessToken(); tok != spotifytest.AccessToken {
+		t.Fatalf("got token %q", tok)
+	}
+	conf, err := tm.ConfigManager.ReadAndGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.AccessToken != spotifytest.AccessToken || conf.ClientToken != spotifytest.ClientToken {
+		t.Fatalf("token not persisted: %+v", conf)
+	}
+
+	info, _ := os.Stat(configPath)
+	for i := 0; i < 10; i++ {
+		tm.GetAccessToken()
+	}
+	after, _ := os.Stat(configPath)
+	if !after.ModTime().Equal(info.ModTime()) {
+		t.Errorf("config rewritten while serving a cached token")
+	}
+	if n := srv.Hits("token"); n != 1 {
+		t.Errorf("token endpoint hit %d times, want 1", n)
+	}
+}
+
+func TestManagerSetSpDc(t *testing.T) {
+	tm, srv, _ := newTestManager(t)
+	tm.GetAccessToken()
+	if tm.ClientToken() != spotifytest.ClientToken {
+		t.Errorf("ClientToken() = %q, want %q", tm.ClientToken(), spotifytest.ClientToken)
+	}
+
+	tm.SetSpDc("replaced")
+	if tm.SpDc() != "replaced" {
+		t.Errorf("SpDc() = %q, want replaced", tm.SpDc())
+	}
+	conf, err := tm.ConfigManager.ReadAndGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.SpDc != "replaced" || conf.AccessToken != "" {
+		t.Errorf("config sp_dc = %q, access token = %q, want the new cookie and no token", conf.SpDc, conf.AccessToken)
+	}
+	tm.GetAccessToken()
+	if n := srv.Hits("token"); n != 2 {
+		t.Errorf("token endpoint hit %d times, want a new token for the new cookie", n)
+	}
+}
+
+func TestManagerLoadsConfigOnFirstToken(t *testing.T) {
+	_, srv, configPath := newTestManager(t)
+
+	// A manager that never read its config still uses the cookie in it.
+	tm := token.NewTokenManager(srv.Endpoints())
+	tm.ConfigManager.SetConfigPath(configPath)
+	tok, err := tm.Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if tok.AccessToken != spotifytest.AccessToken || tok.ClientToken == "" {
+		t.Errorf("Token() = %+v, want the fake server's tokens", tok)
+	}
+}
+
+func TestManagerRefreshWindow(t *testing.T) {
+	tm, srv, _ := newTestManager(t)
+	// Tokens from the fake server live for an hour, so a two hour window
+	// forces a refresh on every call.
+	tm.RefreshWindow = 2 * time.Hour
+
+	tm.GetAccessToken()
+	tm.GetAccessToken()
+	if n := srv.Hits("token"); n != 2 {
+		t.Errorf("token endpoint hit %d times, want 2", n)
+	}
+}
+
+func TestStaticTokenSource(t *testing.T) {
+	ts := token.StaticTokenSource(token.Token{AccessToken: "a", ClientToken: "c"})
+	tok, err := ts.Token()
+	if err != nil || tok.AccessToken != "a" || tok.ClientToken != "c" {
+		t.Fatalf("Token() = %+v, %v", tok, err)
+	}
+
+	expired := token.StaticTokenSource(token.Token{AccessToken: "a", Expiry: time.Now().Add(-time.Minute)})
+	if _, err := expired.Token(); err == nil {
+		t.Errorf("expired static token accepted")
+	}
+}
+
+func TestFileTokenSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	write := func(access string, expire time.Time) {
+		data, _ := json.Marshal(map[string]any{
+			"accessToken":       access,
+			"clientToken":       "client",
+			"accessTokenExpire": expire.UnixMilli(),
+		})
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := token.FileTokenSource(path)
+	if _, err := ts.Token(); err == nil {
+		t.Fatalf("missing token file accepted")
+	}
+
+	write("first", time.Now().Add(time.Hour))
+	tok, err := ts.Token()
+	if err != nil || tok.AccessToken != "first" || tok.ClientToken != "client" {
+		t.Fatalf("Token() = %+v, %v", tok, err)
+	}
+
+	write("second", time.Now().Add(time.Hour))
+	// Make sure the modification time changes on coarse file systems.
+	_ = os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	if tok, _ := ts.Token(); tok.AccessToken != "second" {
+		t.Errorf("rotated token not picked up, got %q", tok.AccessToken)
+	}
+}